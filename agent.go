@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// agentMaxSteps bounds how many commands one --agent run may execute.
+	agentMaxSteps = 10
+	// agentOutputSteps is how many of the latest steps include their output
+	// in the next request.
+	agentOutputSteps = 3
+	// agentDonePrefix marks the model's final answer instead of a command.
+	agentDonePrefix = "DONE:"
+)
+
+// agent runs the --agent loop: the model proposes one command at a time, the
+// user approves it, and its output is sent back for the next step until the
+// model reports the task done, the user declines a step, or agentMaxSteps is
+// reached. With -y, steps that need no extra caution run without asking.
+func (s *session) agent(task string) int {
+	limit, err := captureLimit()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+
+	var steps []replTurn
+	for i := 1; i <= agentMaxSteps; i++ {
+		commands, ok := s.generate(agentTask(task, steps), 1)
+		if !ok {
+			return 1
+		}
+		cmd := commands[0]
+		if answer, done := strings.CutPrefix(cmd, agentDonePrefix); done {
+			fmt.Fprintln(s.ui, strings.TrimSpace(answer))
+			return 0
+		}
+
+		fmt.Fprintf(s.ui, "Step %d: %s\n", i, cmd)
+		rec := auditRecord{Mode: "agent", Task: task, Suggestions: commands, Command: cmd}
+		cmd, ok = s.fill(cmd)
+		if !ok {
+			s.audit(rec)
+			return 1
+		}
+		rec.Command = cmd
+		if !approveCommand(s.cfg, cmd, !s.flags.yes, "Run it?") {
+			s.audit(rec)
+			fmt.Fprintln(os.Stderr, "Stopped.")
+			return 1
+		}
+
+		out := newTailBuffer(limit)
+		step := replTurn{task: task, command: cmd}
+		step.exitCode = s.auditRun(rec, func() int {
+			if err := runCommandCapture(cmd, out); err != nil {
+				return exitCode(err)
+			}
+			return 0
+		})
+		if step.exitCode != 0 {
+			fmt.Fprintf(s.ui, "[exit %d]\n", step.exitCode)
+		}
+		step.output = redactSecrets(out.String())
+		steps = append(steps, step)
+	}
+	fmt.Fprintf(os.Stderr, "Stopped after %d steps without finishing.\n", agentMaxSteps)
+	return 1
+}
+
+// agentTask wraps task with the agent instructions and the steps taken so far.
+func agentTask(task string, steps []replTurn) string {
+	var b strings.Builder
+	b.WriteString(task)
+	b.WriteString("\n\nWork on this task step by step. Reply with the single next command to run; " +
+		"its output will be sent back to you. Only inspect the system: use read-only commands " +
+		"unless the task explicitly asks for a change. When the task is complete, or it can't " +
+		"be advanced further, reply with one line starting with " + agentDonePrefix +
+		" followed by a short answer for the user instead of a command.\n")
+	if len(steps) == 0 {
+		return b.String()
+	}
+	b.WriteString("\nSteps so far:\n")
+	for i, st := range steps {
+		fmt.Fprintf(&b, "%d. Command: %s\n   Exit code: %d\n", i+1, st.command, st.exitCode)
+		if i >= len(steps)-agentOutputSteps && strings.TrimSpace(st.output) != "" {
+			fmt.Fprintf(&b, "   Output:\n%s\n", indent(strings.TrimRight(st.output, "\n"), "     "))
+		}
+	}
+	return b.String()
+}
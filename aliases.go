@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+const (
+	// shellProbeTimeout bounds how long an interactive shell may take to start.
+	shellProbeTimeout = 3 * time.Second
+	// maxShellNames caps how many alias or function names go into the prompt.
+	maxShellNames = 50
+)
+
+// gatherShellNames returns comma-separated alias and function names defined
+// in the user's interactive shell. Only names are collected; alias bodies and
+// function definitions never leave the machine. Only POSIX-style shells are
+// probed.
+func gatherShellNames(shell string) (aliases, functions string) {
+	if ai.DialectOf(shell) != ai.DialectPOSIX {
+		return "", ""
+	}
+	aliasOut := probeShell(shell, "alias")
+	aliases = joinNames(parseAliasNames(aliasOut))
+
+	var funcCmd string
+	switch filepath.Base(shell) {
+	case "bash":
+		funcCmd = "declare -F"
+	case "zsh":
+		funcCmd = "print -l ${(k)functions}"
+	case "fish":
+		funcCmd = "functions -n"
+	default:
+		return aliases, ""
+	}
+	functions = joinNames(parseFunctionNames(probeShell(shell, funcCmd)))
+	return aliases, functions
+}
+
+// probeShell runs script in an interactive instance of shell so rc files are
+// loaded, returning stdout or "" on failure.
+func probeShell(shell, script string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), shellProbeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, shell, "-ic", script).Output()
+	if err != nil && len(out) == 0 {
+		return ""
+	}
+	return string(out)
+}
+
+// parseAliasNames extracts names from `alias` output in bash (alias ll='ls -l'),
+// zsh (ll='ls -l') and fish (alias ll 'ls -l') formats.
+func parseAliasNames(out string) []string {
+	var names []string
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimPrefix(strings.TrimSpace(sc.Text()), "alias ")
+		end := strings.IndexAny(line, "= ")
+		if end < 0 {
+			end = len(line)
+		}
+		if name := strings.Trim(line[:end], `'"`); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// parseFunctionNames extracts function names, one per line, accepting bash's
+// "declare -f name" form. Private helpers starting with "_" are skipped.
+func parseFunctionNames(out string) []string {
+	var names []string
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		name := fields[len(fields)-1]
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// joinNames renders names as a comma-separated list truncated to maxShellNames.
+func joinNames(names []string) string {
+	slices.Sort(names)
+	names = slices.Compact(names)
+	if len(names) > maxShellNames {
+		extra := len(names) - maxShellNames
+		return strings.Join(names[:maxShellNames], ", ") + " (+" + strconv.Itoa(extra) + " more)"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// stdinPiped reports whether stdin is a pipe or a file, as in
+// `cat error.log | ai "why is this failing"`, rather than a terminal.
+func stdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeNamedPipe != 0 || info.Mode().IsRegular()
+}
+
+// readPipedInput reads stdin for use in a prompt: only the last limit bytes
+// are kept and anything that looks like a secret is redacted. Once it is
+// read, prompts switch to the terminal.
+func readPipedInput(limit int) (string, error) {
+	buf := newTailBuffer(limit)
+	if _, err := io.Copy(buf, os.Stdin); err != nil {
+		return "", err
+	}
+	promptFromTerminal()
+	return redactSecrets(buf.String()), nil
+}
+
+// answer handles a task given together with piped data: instead of
+// suggesting a command, the model answers the task about the data, and the
+// answer is printed.
+func (s *session) answer(task string) int {
+	limit, err := captureLimit()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	input, err := readPipedInput(limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	reply, ok := s.complete(buildAnswerPrompt(task, input, s.cfg.PromptExtra))
+	if !ok {
+		return 1
+	}
+	fmt.Println(reply)
+	return 0
+}
+
+// buildAnswerPrompt asks for a direct answer to task about input.
+func buildAnswerPrompt(task, input, extra string) string {
+	var b strings.Builder
+	b.WriteString("You help a user on the command line with data they piped in.\n")
+	b.WriteString("Answer the request about the input below directly and concisely.\n")
+	b.WriteString("If the answer is transformed data, output only that data.\n")
+	b.WriteString("Plain text only, no Markdown headings.\n")
+	if extra = strings.TrimSpace(extra); extra != "" {
+		b.WriteString("\nAdditional instructions:\n")
+		b.WriteString(extra)
+		b.WriteString("\n")
+	}
+	b.WriteString("\nRequest:\n" + task + "\n")
+	if input = strings.TrimSpace(input); input != "" {
+		b.WriteString("\nInput:\n" + input + "\n")
+	} else {
+		b.WriteString("\nThe input was empty.\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// auditRecord is one line of the audit log: a task, the commands suggested
+// for it and the command picked, with its exit code and duration when it
+// ran.
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	Host        string    `json:"host"`
+	Cwd         string    `json:"cwd"`
+	Mode        string    `json:"mode"` // run, interactive, agent, plan, mcp or history
+	Task        string    `json:"task"`
+	Suggestions []string  `json:"suggestions,omitempty"`
+	Command     string    `json:"command,omitempty"`   // picked; "" when none was
+	ExitCode    *int      `json:"exit_code,omitempty"` // nil when the command didn't run
+	DurationMS  int64     `json:"duration_ms,omitempty"`
+}
+
+// auditLogPath returns where the audit log goes, or "" when it is off. An
+// audit_log set by the system policy can't be changed by the user;
+// otherwise AI_AUDIT_LOG overrides the config file.
+func auditLogPath(cfg config) string {
+	if cfg.auditLocked {
+		return cfg.AuditLog
+	}
+	return firstNonEmpty(os.Getenv("AI_AUDIT_LOG"), cfg.AuditLog)
+}
+
+// openAuditLog opens the audit log at path for appending, creating it and
+// its directory as needed.
+func openAuditLog(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+	return f, nil
+}
+
+// audit appends rec to the audit log, if there is one, filling in when,
+// who and where. Records without suggestions or a command are skipped. Each
+// record is a single write, so concurrent runs don't interleave lines.
+func (s *session) audit(rec auditRecord) {
+	if s.auditLog == nil || (len(rec.Suggestions) == 0 && rec.Command == "") {
+		return
+	}
+	rec.Time = time.Now()
+	if u, err := user.Current(); err == nil {
+		rec.User = u.Username
+	}
+	rec.Host, _ = os.Hostname()
+	rec.Cwd, _ = os.Getwd()
+	data, err := json.Marshal(rec)
+	if err == nil {
+		_, err = s.auditLog.Write(append(data, '\n'))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: could not write audit log:", err)
+	}
+}
+
+// auditRun calls run, which runs rec.Command and returns its exit code, and
+// appends the outcome to the audit log.
+func (s *session) auditRun(rec auditRecord, run func() int) int {
+	start := time.Now()
+	code := run()
+	rec.ExitCode = &code
+	rec.DurationMS = time.Since(start).Milliseconds()
+	s.audit(rec)
+	return code
+}
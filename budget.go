@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+const (
+	usageFileName = "usage.json"
+	dayLayout     = "2006-01-02"
+	// usageRetention bounds how many days of accounting are kept; enough to
+	// cover the current and previous calendar month.
+	usageRetention = 62 * 24 * time.Hour
+)
+
+// tokenBudget holds the configured limits; zero means unlimited.
+type tokenBudget struct {
+	Daily       int
+	Monthly     int
+	MonthlyCost float64 // US dollars of estimated cost
+	Warn        bool    // warn instead of refusing once a limit is reached
+}
+
+// usageLedger is the persisted token accounting, keyed by local date. Days
+// holds the total tokens the budget is checked against; Details breaks them
+// down for `ai usage` and may be missing for days recorded by older versions.
+type usageLedger struct {
+	Days    map[string]int      `json:"days"`
+	Details map[string]dayUsage `json:"details,omitempty"`
+}
+
+// dayUsage is the usage recorded on one day.
+type dayUsage struct {
+	Requests     int     `json:"requests"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost_usd"`           // estimated, for the calls that could be priced
+	Unpriced     int     `json:"unpriced,omitempty"` // requests whose model had no known price
+}
+
+// stateDir returns the directory used for persistent local state.
+func stateDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "ai"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "state", "ai"), nil
+}
+
+// loadBudget reads the budget from AI_DAILY_TOKEN_BUDGET and
+// AI_MONTHLY_TOKEN_BUDGET, falling back to the monthly limits of cfg.
+func loadBudget(cfg config) (tokenBudget, error) {
+	var b tokenBudget
+	var err error
+	if b.Daily, err = budgetFromEnv("AI_DAILY_TOKEN_BUDGET"); err != nil {
+		return b, err
+	}
+	if b.Monthly, err = budgetFromEnv("AI_MONTHLY_TOKEN_BUDGET"); err != nil {
+		return b, err
+	}
+	if cfg.MonthlyTokenBudget < 0 || cfg.MonthlyCostBudget < 0 {
+		return b, errors.New("monthly_token_budget and monthly_cost_budget must not be negative")
+	}
+	if b.Monthly == 0 {
+		b.Monthly = cfg.MonthlyTokenBudget
+	}
+	b.MonthlyCost = cfg.MonthlyCostBudget
+	switch cfg.BudgetAction {
+	case "", "refuse":
+	case "warn":
+		b.Warn = true
+	default:
+		return b, fmt.Errorf("budget_action must be refuse or warn, got %q", cfg.BudgetAction)
+	}
+	return b, nil
+}
+
+func budgetFromEnv(name string) (int, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return n, nil
+}
+
+func (b tokenBudget) enabled() bool {
+	return b.Daily > 0 || b.Monthly > 0 || b.MonthlyCost > 0
+}
+
+func usageFilePath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, usageFileName), nil
+}
+
+// errNoStateDir is returned by loadUsage when there is no state directory
+// to keep the ledger in, such as with neither XDG_STATE_HOME nor HOME set.
+var errNoStateDir = errors.New("no state directory")
+
+// loadUsage reads the usage ledger; a missing file yields an empty ledger.
+// Without a state directory it returns an empty ledger and an error wrapping
+// errNoStateDir. On other errors it returns no ledger, so one that couldn't
+// be read is never saved over the file.
+func loadUsage() (*usageLedger, error) {
+	ledger := &usageLedger{Days: map[string]int{}}
+	path, err := usageFilePath()
+	if err != nil {
+		return ledger, fmt.Errorf("%w: %w", errNoStateDir, err)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, ledger); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if ledger.Days == nil {
+		ledger.Days = map[string]int{}
+	}
+	return ledger, nil
+}
+
+// save writes the ledger atomically, dropping entries past the retention window.
+func (l *usageLedger) save(now time.Time) error {
+	path, err := usageFilePath()
+	if err != nil {
+		return err
+	}
+	cutoff := now.Add(-usageRetention).Format(dayLayout)
+	for day := range l.Days {
+		if day < cutoff {
+			delete(l.Days, day)
+		}
+	}
+	for day := range l.Details {
+		if day < cutoff {
+			delete(l.Details, day)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// add records one request's usage and its estimated cost; known is false
+// when the model's price isn't known.
+func (l *usageLedger) add(now time.Time, usage ai.Usage, usd float64, known bool) {
+	day := now.Format(dayLayout)
+	l.Days[day] += usage.TotalTokens
+	if l.Details == nil {
+		l.Details = map[string]dayUsage{}
+	}
+	d := l.Details[day]
+	d.Requests++
+	d.InputTokens += usage.InputTokens
+	d.OutputTokens += usage.OutputTokens
+	d.Cost += usd
+	if !known {
+		d.Unpriced++
+	}
+	l.Details[day] = d
+}
+
+func (l *usageLedger) daily(now time.Time) int {
+	return l.Days[now.Format(dayLayout)]
+}
+
+func (l *usageLedger) monthly(now time.Time) int {
+	prefix := now.Format("2006-01-")
+	total := 0
+	for day, tokens := range l.Days {
+		if strings.HasPrefix(day, prefix) {
+			total += tokens
+		}
+	}
+	return total
+}
+
+// monthlyCost returns the estimated cost recorded this month.
+func (l *usageLedger) monthlyCost(now time.Time) float64 {
+	prefix := now.Format("2006-01-")
+	total := 0.0
+	for day, d := range l.Details {
+		if strings.HasPrefix(day, prefix) {
+			total += d.Cost
+		}
+	}
+	return total
+}
+
+// check returns an error when the daily or monthly budget is already used up.
+func (b tokenBudget) check(l *usageLedger, now time.Time) error {
+	if b.Daily > 0 && l.daily(now) >= b.Daily {
+		return fmt.Errorf("daily token budget exhausted (%d/%d tokens used)", l.daily(now), b.Daily)
+	}
+	if b.Monthly > 0 && l.monthly(now) >= b.Monthly {
+		return fmt.Errorf("monthly token budget exhausted (%d/%d tokens used)", l.monthly(now), b.Monthly)
+	}
+	if b.MonthlyCost > 0 && l.monthlyCost(now) >= b.MonthlyCost {
+		return fmt.Errorf("monthly cost budget exhausted ($%.2f/$%.2f estimated)", l.monthlyCost(now), b.MonthlyCost)
+	}
+	return nil
+}
+
+// remaining returns how many tokens are left under the tighter of the daily
+// and monthly budgets, or false when no budget is set.
+func (b tokenBudget) remaining(l *usageLedger, now time.Time) (int, bool) {
+	left, ok := 0, false
+	if b.Daily > 0 {
+		left, ok = max(b.Daily-l.daily(now), 0), true
+	}
+	if b.Monthly > 0 {
+		m := max(b.Monthly-l.monthly(now), 0)
+		if !ok || m < left {
+			left = m
+		}
+		ok = true
+	}
+	return left, ok
+}
+
+// describe renders the remaining budget for verbose output.
+func (b tokenBudget) describe(l *usageLedger, now time.Time) string {
+	var parts []string
+	if b.Daily > 0 {
+		parts = append(parts, fmt.Sprintf("daily %d/%d tokens remaining", max(b.Daily-l.daily(now), 0), b.Daily))
+	}
+	if b.Monthly > 0 {
+		parts = append(parts, fmt.Sprintf("monthly %d/%d tokens remaining", max(b.Monthly-l.monthly(now), 0), b.Monthly))
+	}
+	if b.MonthlyCost > 0 {
+		parts = append(parts, fmt.Sprintf("monthly $%.2f/$%.2f remaining", max(b.MonthlyCost-l.monthlyCost(now), 0), b.MonthlyCost))
+	}
+	if len(parts) == 0 {
+		return "unlimited"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// responseCacheTTL is how long generated suggestions are reused for an
+// identical request.
+const responseCacheTTL = time.Hour
+
+// cacheEntry is one cached set of suggestions.
+type cacheEntry struct {
+	Created  time.Time `json:"created"`
+	Commands []string  `json:"commands"`
+}
+
+// responseCacheDir returns where cached suggestions are kept:
+// $XDG_CACHE_HOME/ai/responses or the platform's equivalent.
+func responseCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ai", "responses"), nil
+}
+
+// cacheKey hashes everything that determines a reply. Only the hash is
+// written to disk, so the prompt and its environment details are not.
+func cacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadCached returns the suggestions cached under key, if there are any
+// younger than responseCacheTTL.
+func loadCached(key string, now time.Time) (cacheEntry, bool) {
+	dir, err := responseCacheDir()
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	data, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(data, &e); err != nil || len(e.Commands) == 0 || now.Sub(e.Created) > responseCacheTTL {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+// storeCached saves commands under key and removes expired entries.
+func storeCached(key string, commands []string, now time.Time) error {
+	dir, err := responseCacheDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			if info, err := entry.Info(); err == nil && now.Sub(info.ModTime()) > responseCacheTTL {
+				_ = os.Remove(filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	data, err := json.Marshal(cacheEntry{Created: now, Commands: commands})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, key+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultCaptureKB is how much trailing command output is kept for follow-ups.
+const defaultCaptureKB = 16
+
+// tailBuffer is an io.Writer that keeps only the last limit bytes written to
+// it, so capturing the output of commands like `find /` stays bounded.
+type tailBuffer struct {
+	mu      sync.Mutex
+	buf     []byte
+	limit   int
+	dropped int64
+}
+
+func newTailBuffer(limit int) *tailBuffer {
+	return &tailBuffer{limit: limit}
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := len(p)
+	if len(p) >= t.limit {
+		t.dropped += int64(len(t.buf) + len(p) - t.limit)
+		t.buf = append(t.buf[:0], p[len(p)-t.limit:]...)
+		return n, nil
+	}
+	if over := len(t.buf) + len(p) - t.limit; over > 0 {
+		t.dropped += int64(over)
+		t.buf = append(t.buf[:0], t.buf[over:]...)
+	}
+	t.buf = append(t.buf, p...)
+	return n, nil
+}
+
+// String returns the captured output, prefixed with a note when earlier
+// output was discarded.
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dropped == 0 {
+		return string(t.buf)
+	}
+	return fmt.Sprintf("[... %d earlier bytes truncated ...]\n%s", t.dropped, t.buf)
+}
+
+// captureLimit returns the capture size in bytes from AI_CAPTURE_KB.
+func captureLimit() (int, error) {
+	v := strings.TrimSpace(os.Getenv("AI_CAPTURE_KB"))
+	if v == "" {
+		return defaultCaptureKB * 1024, nil
+	}
+	kb, err := strconv.Atoi(v)
+	if err != nil || kb < 1 {
+		return 0, fmt.Errorf("AI_CAPTURE_KB must be a positive integer")
+	}
+	return kb * 1024, nil
+}
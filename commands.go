@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// command is a subcommand of ai. Its run func receives the arguments after
+// the subcommand name and returns the process exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+	// fits reports whether the arguments after the name are meant for the
+	// subcommand rather than the rest of a task starting with its name, as
+	// in "ai commit my work". Nil accepts any arguments.
+	fits func(args []string) bool
+}
+
+// subcommands lists the commands ai dispatches to. A first argument that
+// isn't one of these names, or whose arguments don't fit it, is the start
+// of a task for the run command.
+func subcommands() []command {
+	return []command{
+		{"run", "suggest and run a command for a task (the default)", runTask, nil},
+		{"fix", "suggest a corrected version of a failed command", runFix, nil},
+		{"commit", "write a commit message for the staged changes and commit", runCommit, leadingWord()},
+		{"script", "write a commented shell script for a task", runScript, nil},
+		{"summarize", "summarize piped command output", runSummarize, nil},
+		{"explain", "explain what a shell command does", runExplain, nil},
+		{"config", "show or change settings in the config file", runConfigCommand, leadingWord("list", "get", "set")},
+		{"history", "list, search and re-run commands picked before", runHistory, leadingWord("search", "run")},
+		{"init", "print shell integration that puts suggestions on the command line", runInit, onlyWord(initShells()...)},
+		{"completion", "print a tab-completion script for bash, zsh or fish", runCompletion, onlyWord(initShells()...)},
+		{"usage", "show token usage and estimated cost for this month", runUsage, leadingWord()},
+		{"mcp", "serve command suggestions to editors and agents over MCP", runMCP, leadingWord()},
+		{"serve", "run a daemon that keeps provider connections warm between runs", runServe, leadingWord()},
+		{"doctor", "check that ai is set up correctly", func(args []string) int {
+			if len(args) > 0 {
+				fmt.Fprintln(os.Stderr, "Usage: ai doctor")
+				return 2
+			}
+			return runDoctor()
+		}, leadingWord()},
+	}
+}
+
+// leadingWord returns a fits func accepting no arguments, arguments starting
+// with a flag, and arguments starting with one of words.
+func leadingWord(words ...string) func(args []string) bool {
+	return func(args []string) bool {
+		return len(args) == 0 || strings.HasPrefix(args[0], "-") || slices.Contains(words, args[0])
+	}
+}
+
+// onlyWord returns a fits func accepting no arguments, a flag, or one of
+// words on its own.
+func onlyWord(words ...string) func(args []string) bool {
+	return func(args []string) bool {
+		return len(args) == 0 || len(args) == 1 && (strings.HasPrefix(args[0], "-") || slices.Contains(words, args[0]))
+	}
+}
+
+// dispatch runs the subcommand named by args[0] if the arguments after it
+// fit the subcommand, falling back to run.
+func dispatch(args []string) int {
+	if len(args) == 0 {
+		newFlagSet(&cliFlags{}, os.Stderr).Usage()
+		return 2
+	}
+	for _, c := range subcommands() {
+		if c.name == args[0] && (c.fits == nil || c.fits(args[1:])) {
+			return c.run(args[1:])
+		}
+	}
+	return runTask(args)
+}
+
+// printCommands writes the subcommand list for usage messages.
+func printCommands(w io.Writer) {
+	for _, c := range subcommands() {
+		_, _ = fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// commitDiffBytes bounds how much of the staged diff is sent; the diffstat
+// is always included, so larger changes are still described in outline.
+const commitDiffBytes = 32 * 1024
+
+// commitSeparatorRe splits the model's reply into alternative messages.
+var commitSeparatorRe = regexp.MustCompile(`(?m)^\s*---+\s*$`)
+
+// runCommit implements "ai commit": it asks the model for commit messages
+// describing the staged changes, lets the user pick one from the menu, and
+// runs git commit with it, opening git's editor to adjust it first.
+func runCommit(args []string) int {
+	flags := &cliFlags{}
+	fs := newProviderFlagSet("ai commit", flags)
+	fs.IntVar(&flags.numCommands, "n", 3, "number of messages to suggest")
+	fs.BoolVar(&flags.yes, "y", false, "commit with the first suggestion without showing the menu or the editor")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: ai commit [flags]")
+		fmt.Fprintln(out, "\nSuggest a Conventional Commits message for the staged changes and commit them.")
+		fmt.Fprintln(out, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 || flags.numCommands < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	stat, err := gitOutput("diff", "--cached", "--stat")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	if strings.TrimSpace(stat) == "" {
+		fmt.Fprintln(os.Stderr, "Error: nothing staged to commit (use git add)")
+		return 1
+	}
+	diff, err := gitOutput("diff", "--cached")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	if len(diff) > commitDiffBytes {
+		diff = diff[:commitDiffBytes] + fmt.Sprintf("\n[... %d more bytes of diff truncated ...]\n", len(diff)-commitDiffBytes)
+	}
+
+	s, code := newSession(flags)
+	if s == nil {
+		return code
+	}
+	msg, code := s.chooseCommitMessage(stat, redactSecrets(diff))
+	if msg == "" {
+		return code
+	}
+
+	gitArgs := []string{"commit", "-m", msg}
+	if !flags.yes {
+		gitArgs = append(gitArgs, "--edit")
+	}
+	c := exec.Command("git", gitArgs...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return exitCode(err)
+	}
+	return 0
+}
+
+// chooseCommitMessage generates messages and returns the one the user
+// picks, or "" and the exit code to use.
+func (s *session) chooseCommitMessage(stat, diff string) (string, int) {
+	var feedback []followUp
+	for {
+		reply, ok := s.complete(buildCommitPrompt(stat, diff, s.flags.numCommands, feedback))
+		if !ok {
+			return "", 1
+		}
+		messages := parseCommitMessages(reply)
+		if len(messages) == 0 {
+			fmt.Fprintln(os.Stderr, "No commit message generated")
+			return "", 1
+		}
+		if s.flags.yes {
+			return messages[0], 0
+		}
+
+		subjects := make([]string, len(messages))
+		for i, m := range messages {
+			subjects[i], _, _ = strings.Cut(m, "\n")
+		}
+		sel, err := selectCommand(s.ui, subjects, nil, false, nil)
+		if errors.Is(err, errAborted) {
+			fmt.Fprintln(os.Stderr, "Aborted.")
+			return "", 1
+		}
+		if errors.Is(err, errNoTerminal) {
+			fmt.Fprintln(os.Stderr, "Error: stdin is not a terminal, so no message can be picked from the menu; pass -y to use the first one")
+			return "", 1
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Selection error:", err)
+			return "", 1
+		}
+		switch {
+		case sel.regenerate:
+			if sel.hint != "" {
+				feedback = append(feedback, followUp{note: sel.hint})
+			}
+			continue
+		case sel.correction != "":
+			feedback = append(feedback, followUp{suggestions: subjects, note: sel.correction})
+			continue
+		}
+		for i, subject := range subjects {
+			if subject == sel.command {
+				return messages[i], 0
+			}
+		}
+		return sel.command, 0 // edited in the menu
+	}
+}
+
+// gitOutput runs git with args and returns its stdout.
+func gitOutput(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return string(out), err
+}
+
+// buildCommitPrompt asks for n alternative commit messages for the staged
+// changes, taking feedback from earlier rounds into account.
+func buildCommitPrompt(stat, diff string, n int, feedback []followUp) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Write %d alternative git commit messages for the staged changes below.\n", n)
+	b.WriteString("Rules:\n")
+	b.WriteString("- Follow Conventional Commits: type(optional scope): subject, e.g. \"fix(parser): handle empty input\".\n")
+	b.WriteString("- The subject is imperative and at most 72 characters.\n")
+	b.WriteString("- Optionally add a blank line and a short body saying why the change was made.\n")
+	b.WriteString("- Separate the messages with a line containing only ---. No other text.\n")
+	b.WriteString(taskWithFollowUps("\nSummary:\n"+stat+"\nDiff:\n"+diff, feedback))
+	b.WriteString("\n")
+	return b.String()
+}
+
+// parseCommitMessages splits the model's reply into messages, dropping
+// code fences and duplicates.
+func parseCommitMessages(reply string) []string {
+	var messages []string
+	seen := map[string]bool{}
+	for _, part := range commitSeparatorRe.Split(reply, -1) {
+		var lines []string
+		for _, line := range strings.Split(part, "\n") {
+			if !strings.HasPrefix(strings.TrimSpace(line), "```") {
+				lines = append(lines, strings.TrimRight(line, " \t"))
+			}
+		}
+		msg := strings.TrimSpace(strings.Join(lines, "\n"))
+		if msg != "" && !seen[msg] {
+			seen[msg] = true
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	ansiReset = "\033[0m"
+	ansiBold  = "\033[1m"
+	ansiDim   = "\033[2m"
+	ansiDiff  = "\033[1;33m" // bold yellow
+
+	ansiHighRisk   = "\033[1;31m" // bold red
+	ansiMediumRisk = "\033[33m"   // yellow
+)
+
+var wordSpanRe = regexp.MustCompile(`\S+`)
+
+// noColor is set by --no-color.
+var noColor bool
+
+// colorEnabled reports whether ANSI colors should be written to f: it must be
+// a terminal, and neither --no-color nor NO_COLOR (https://no-color.org) may
+// be set.
+func colorEnabled(f *os.File) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// printComparison renders cmds as a numbered list that highlights how they
+// differ: the word prefix shared by all candidates is dimmed and words that
+// not every candidate contains are emphasized. Without color, the differing
+// words are underlined with carets on the following line. Entries are
+// tagged as by suggestionTags, and non-empty notes are shown dimmed under
+// their entry.
+func printComparison(w io.Writer, cmds, notes []string, source func(string) string, color bool) {
+	lines, marks := comparisonLines(cmds, color)
+	for i := range cmds {
+		label := fmt.Sprintf("  %d) ", i+1)
+		tags, _ := suggestionTags(cmds[i], source, color)
+		fmt.Fprintln(w, label+lines[i]+tags)
+		if !color && marks[i] != "" {
+			fmt.Fprintln(w, strings.Repeat(" ", len(label))+marks[i])
+		}
+		if note := noteAt(notes, i); note != "" {
+			fmt.Fprintln(w, strings.Repeat(" ", len(label))+paint(note, ansiDim, color))
+		}
+	}
+}
+
+// comparisonLines returns each candidate with its differences highlighted,
+// plus the matching caret line (empty when nothing differs) for use without
+// color.
+func comparisonLines(cmds []string, color bool) (lines, marks []string) {
+	spans := make([][][]int, len(cmds))
+	words := make([][]string, len(cmds))
+	for i, c := range cmds {
+		spans[i] = wordSpanRe.FindAllStringIndex(c, -1)
+		for _, sp := range spans[i] {
+			words[i] = append(words[i], c[sp[0]:sp[1]])
+		}
+	}
+
+	prefix := commonWordPrefix(words)
+	// counts[word] is the number of candidates containing word at least once.
+	counts := map[string]int{}
+	for _, ws := range words {
+		seen := map[string]bool{}
+		for _, word := range ws {
+			if !seen[word] {
+				seen[word] = true
+				counts[word]++
+			}
+		}
+	}
+
+	for i, c := range cmds {
+		var line, mark strings.Builder
+		last := 0
+		for j, sp := range spans[i] {
+			gap := c[last:sp[0]]
+			line.WriteString(gap)
+			mark.WriteString(strings.Repeat(" ", len(gap)))
+			word := c[sp[0]:sp[1]]
+			switch {
+			case j < prefix:
+				line.WriteString(paint(word, ansiDim, color))
+				mark.WriteString(strings.Repeat(" ", len(word)))
+			case counts[word] < len(cmds):
+				line.WriteString(paint(word, ansiDiff, color))
+				mark.WriteString(strings.Repeat("^", len(word)))
+			default:
+				line.WriteString(word)
+				mark.WriteString(strings.Repeat(" ", len(word)))
+			}
+			last = sp[1]
+		}
+		line.WriteString(c[last:])
+		lines = append(lines, line.String())
+		marks = append(marks, strings.TrimRight(mark.String(), " "))
+	}
+	return lines, marks
+}
+
+// commonWordPrefix returns how many leading words all candidates share.
+func commonWordPrefix(words [][]string) int {
+	n := 0
+	for {
+		for _, ws := range words {
+			if n >= len(ws) || ws[n] != words[0][n] {
+				return n
+			}
+		}
+		n++
+	}
+}
+
+func paint(s, style string, color bool) string {
+	if !color || s == "" {
+		return s
+	}
+	return style + s + ansiReset
+}
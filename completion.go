@@ -0,0 +1,207 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// completionFlag is a task flag as the completion scripts offer it.
+type completionFlag struct {
+	name   string // with its dashes, such as -v or --model
+	usage  string
+	value  string // what the flag takes, or "" for a switch
+	values string // space-separated choices for the value, if known
+}
+
+// completionFlags lists the flags of ai run, as the shells spell them.
+func completionFlags() []completionFlag {
+	var flags []completionFlag
+	newFlagSet(&cliFlags{}, io.Discard).VisitAll(func(f *flag.Flag) {
+		value, usage := flag.UnquoteUsage(f)
+		c := completionFlag{name: "--" + f.Name, usage: usage}
+		if len(f.Name) == 1 {
+			c.name = "-" + f.Name
+		}
+		if !isBoolFlag(f) {
+			c.value = value
+		}
+		switch f.Name {
+		case "provider":
+			c.values = strings.Join(ai.ProviderNames, " ")
+		case "log-format":
+			c.values = "text json"
+		}
+		flags = append(flags, c)
+	})
+	return flags
+}
+
+// runCompletion implements `ai completion <shell>`: it prints a script that
+// makes the shell complete subcommands, flags and their values. The scripts
+// call `ai completion --list-profiles` for the profile names, so profiles
+// added later complete without regenerating them.
+func runCompletion(args []string) int {
+	shells := initShells()
+	if len(args) == 1 && args[0] == "--list-profiles" {
+		cfg, err := loadConfig()
+		if err != nil {
+			return 1
+		}
+		for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+			fmt.Println(name)
+		}
+		return 0
+	}
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: ai completion <%s>\n", strings.Join(shells, "|"))
+		return 2
+	}
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion()
+	case "zsh":
+		script = zshCompletion()
+	case "fish":
+		script = fishCompletion()
+	default:
+		fmt.Fprintf(os.Stderr, "Error: no completion for %q; supported shells: %s\n", args[0], strings.Join(shells, ", "))
+		return 2
+	}
+	fmt.Print(script)
+	return 0
+}
+
+// commandNames returns the subcommand names, space-separated.
+func commandNames() string {
+	var names []string
+	for _, c := range subcommands() {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, " ")
+}
+
+func bashCompletion() string {
+	var b strings.Builder
+	b.WriteString("# ai completion for bash; load it with eval \"$(ai completion bash)\"\n")
+	b.WriteString("_ai_completion() {\n")
+	b.WriteString("  local cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	b.WriteString("  case $prev in\n")
+	var names, takesValue []string
+	for _, f := range completionFlags() {
+		names = append(names, f.name)
+		switch {
+		case f.name == "--profile":
+			b.WriteString("    --profile) COMPREPLY=($(compgen -W \"$(command ai completion --list-profiles 2>/dev/null)\" -- \"$cur\")); return ;;\n")
+		case f.values != "":
+			fmt.Fprintf(&b, "    %s) COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", f.name, f.values)
+		case f.value == "file":
+			fmt.Fprintf(&b, "    %s) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n", f.name)
+		case f.value != "":
+			takesValue = append(takesValue, f.name)
+		}
+	}
+	fmt.Fprintf(&b, "    %s) return ;;\n", strings.Join(takesValue, "|"))
+	b.WriteString("  esac\n")
+	b.WriteString("  if [[ $COMP_CWORD -eq 1 && $cur != -* ]]; then\n")
+	fmt.Fprintf(&b, "    COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", commandNames())
+	b.WriteString("    return\n")
+	b.WriteString("  fi\n")
+	b.WriteString("  case ${COMP_WORDS[1]} in\n")
+	fmt.Fprintf(&b, "    init|completion) [[ $COMP_CWORD -eq 2 ]] && COMPREPLY=($(compgen -W %q -- \"$cur\")); return ;;\n", strings.Join(initShells(), " "))
+	b.WriteString("  esac\n")
+	b.WriteString("  if [[ $cur == -* ]]; then\n")
+	fmt.Fprintf(&b, "    COMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(names, " "))
+	b.WriteString("  fi\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -o default -F _ai_completion ai\n")
+	return b.String()
+}
+
+func zshCompletion() string {
+	// Descriptions go inside single quotes and _arguments brackets.
+	escape := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`, ":", `\:`).Replace
+	var b strings.Builder
+	b.WriteString("#compdef ai\n")
+	b.WriteString("# ai completion for zsh; load it with eval \"$(ai completion zsh)\" after compinit\n")
+	b.WriteString("_ai_profiles() {\n")
+	b.WriteString("  local -a profiles\n")
+	b.WriteString("  profiles=(${(f)\"$(command ai completion --list-profiles 2>/dev/null)\"})\n")
+	b.WriteString("  _describe -t profiles 'profile' profiles\n")
+	b.WriteString("}\n")
+	b.WriteString("_ai() {\n")
+	b.WriteString("  local -a commands\n")
+	b.WriteString("  commands=(\n")
+	for _, c := range subcommands() {
+		fmt.Fprintf(&b, "    '%s:%s'\n", c.name, escape(c.summary))
+	}
+	b.WriteString("  )\n")
+	b.WriteString("  local state\n")
+	b.WriteString("  _arguments -s \\\n")
+	for _, f := range completionFlags() {
+		spec := f.name + "[" + escape(f.usage) + "]"
+		switch {
+		case f.name == "--profile":
+			spec += ":profile:_ai_profiles"
+		case f.values != "":
+			spec += ":" + f.value + ":(" + f.values + ")"
+		case f.value == "file":
+			spec += ":file:_files"
+		case f.value != "":
+			spec += ":" + f.value + ": "
+		}
+		fmt.Fprintf(&b, "    '%s' \\\n", spec)
+	}
+	b.WriteString("    '1: :->first' \\\n")
+	b.WriteString("    '*:: :->rest'\n")
+	b.WriteString("  case $state in\n")
+	b.WriteString("    first) _describe -t commands 'ai command' commands ;;\n")
+	b.WriteString("    rest)\n")
+	b.WriteString("      case $words[1] in\n")
+	fmt.Fprintf(&b, "        init|completion) (( CURRENT == 2 )) && _values 'shell' %s ;;\n", strings.Join(initShells(), " "))
+	b.WriteString("      esac ;;\n")
+	b.WriteString("  esac\n")
+	b.WriteString("}\n")
+	b.WriteString("compdef _ai ai\n")
+	return b.String()
+}
+
+func fishCompletion() string {
+	quote := func(s string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+	}
+	var b strings.Builder
+	b.WriteString("# ai completion for fish; load it with ai completion fish | source\n")
+	b.WriteString("complete -c ai -e\n")
+	for _, c := range subcommands() {
+		fmt.Fprintf(&b, "complete -c ai -f -n __fish_use_subcommand -a %s -d %s\n", c.name, quote(c.summary))
+	}
+	fmt.Fprintf(&b, "complete -c ai -f -n '__fish_seen_subcommand_from init completion' -a %s\n", quote(strings.Join(initShells(), " ")))
+	// Task flags apply to ai run and to a task given without it.
+	cond := quote("__fish_use_subcommand; or __fish_seen_subcommand_from run")
+	for _, f := range completionFlags() {
+		option := "-l " + strings.TrimPrefix(f.name, "--")
+		if len(f.name) == 2 {
+			option = "-s " + f.name[1:]
+		}
+		switch {
+		case f.name == "--profile":
+			option += " -x -a '(command ai completion --list-profiles 2>/dev/null)'"
+		case f.values != "":
+			option += " -x -a " + quote(f.values)
+		case f.value == "file":
+			option += " -r -F"
+		case f.value != "":
+			option += " -x"
+		}
+		fmt.Fprintf(&b, "complete -c ai -n %s %s -d %s\n", cond, option, quote(f.usage))
+	}
+	return b.String()
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// projectConfigNames are the per-project config files looked up from the
+// current directory upwards, in order of preference within one directory.
+var projectConfigNames = []string{".ai.toml", filepath.Join(".ai", "config.toml")}
+
+// config holds the settings read from the config files. Empty values mean
+// "not set" so flags, environment variables and defaults can fill them in.
+type config struct {
+	Provider        string   `toml:"provider"`
+	Model           string   `toml:"model"`
+	BaseURL         string   `toml:"base_url"`
+	PromptExtra     string   `toml:"prompt_extra"`
+	ConfirmPatterns []string `toml:"confirm_patterns"`
+
+	// Shell is the shell commands are written for and run in, such as nu
+	// or pwsh, when it isn't the login shell from $SHELL.
+	Shell string `toml:"shell"`
+
+	// DenyPatterns block matching commands: they are dropped from the
+	// suggestions and refused when typed or edited in. AllowPatterns let
+	// commands they match in full run without safety prompts; a deny
+	// pattern still wins.
+	DenyPatterns  []string `toml:"deny_patterns"`
+	AllowPatterns []string `toml:"allow_patterns"`
+
+	// ExplainFailures offers to explain a command that exits non-zero; it
+	// sends the command's stderr to the provider, so it is off unless set.
+	ExplainFailures *bool `toml:"explain_failures"`
+
+	// History keeps the commands picked for tasks for `ai history`; it is
+	// on unless set to false.
+	History *bool `toml:"history"`
+
+	// AppendShellHistory adds each command run to the history file of the
+	// user's shell, so it can be recalled there; it is off unless set.
+	AppendShellHistory *bool `toml:"append_shell_history"`
+
+	// MonthlyTokenBudget and MonthlyCostBudget (in US dollars, checked
+	// against estimated costs) limit usage per calendar month; zero means
+	// unlimited. BudgetAction is "refuse" (the default) or "warn".
+	MonthlyTokenBudget int     `toml:"monthly_token_budget"`
+	MonthlyCostBudget  float64 `toml:"monthly_cost_budget"`
+	BudgetAction       string  `toml:"budget_action"`
+
+	// AuditLog is a file that every suggestion and executed command is
+	// appended to, one JSON record per line; empty means no audit log.
+	AuditLog string `toml:"audit_log"`
+
+	// MCPServers are Model Context Protocol servers whose resources are
+	// added to the environment context, keyed by a name of the user's choice.
+	MCPServers map[string]mcpServer `toml:"mcp_servers"`
+
+	// Context turns on optional parts of the environment context for every
+	// request, as --ctx does: dir, git, files, recent, aliases and history.
+	Context []string `toml:"context"`
+
+	// PromptTemplate is a Go text/template file that replaces the built-in
+	// prompt for command suggestions; relative to the global config's
+	// directory unless absolute.
+	PromptTemplate string `toml:"prompt_template"`
+
+	// Prefer lists the user's preferences for suggestions, such as "rg over
+	// grep" or "long flags", which every prompt asks the model to follow.
+	Prefer []string `toml:"prefer"`
+
+	// ContextTokens caps the environment context sent with a request, in
+	// tokens estimated from its length; zero means defaultContextTokens.
+	// Past it, the least important parts are cut off or left out.
+	ContextTokens int `toml:"context_tokens"`
+
+	// SingleSuggestion says what happens when a request leaves a single
+	// suggestion: "run" (the default) skips the menu, "confirm" asks before
+	// using it and "menu" shows the menu anyway. Safety prompts apply
+	// either way.
+	SingleSuggestion string `toml:"single_suggestion"`
+
+	// FanOut names the profiles or providers (optionally with a model, as
+	// in ollama:llama3.2) that the calls for several suggestions are
+	// spread over, in turn.
+	FanOut []string `toml:"fan_out"`
+
+	// Tasks are saved tasks run with -t name, as text/template text in which
+	// {{.arg1}}, {{.arg2}}, ... stand for the arguments after the name.
+	Tasks map[string]string `toml:"tasks"`
+
+	// Profile names the profile used when --profile and AI_PROFILE are unset.
+	Profile  string             `toml:"profile"`
+	Profiles map[string]profile `toml:"profiles"`
+
+	active   *profile         // selected profile, if any
+	spread   []string         // fan_out entries calls are spread over, if any
+	confirm  []*regexp.Regexp // compiled ConfirmPatterns
+	deny     []*regexp.Regexp // compiled DenyPatterns
+	allow    []*regexp.Regexp // compiled AllowPatterns, anchored at both ends
+	warnings []string         // problems that don't prevent running
+
+	auditLocked bool // AuditLog comes from the system policy
+}
+
+// profile is a named set of provider settings, selected with --profile.
+// Its values take precedence over the environment and the top-level config.
+type profile struct {
+	Provider    string `toml:"provider"`
+	Model       string `toml:"model"`
+	BaseURL     string `toml:"base_url"`
+	APIKeyEnv   string `toml:"api_key_env"` // environment variable holding the API key
+	APIKeyCmd   string `toml:"api_key_cmd"` // shell command printing the API key
+	PromptExtra string `toml:"prompt_extra"`
+}
+
+// systemConfigPath is where administrators keep a policy for every user of
+// the machine.
+const systemConfigPath = "/etc/ai/config.toml"
+
+// apiKeyCmdTimeout bounds api_key_cmd, which may talk to a password manager.
+const apiKeyCmdTimeout = 10 * time.Second
+
+// configPath returns the global config file location: $AI_CONFIG, or
+// config.toml in the user config directory (~/.config/ai on Linux).
+func configPath() (string, error) {
+	if p := os.Getenv("AI_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ai", "config.toml"), nil
+}
+
+// findProjectConfig returns the nearest project config file at or above dir,
+// or "" when there is none.
+func findProjectConfig(dir string) string {
+	for {
+		for _, name := range projectConfigNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return path
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// loadConfig reads the global config file, adds the system policy and
+// merges the nearest project config over it. Missing files are not an
+// error.
+func loadConfig() (config, error) {
+	var cfg config
+	if path, err := configPath(); err == nil {
+		if cfg, err = decodeConfigFile(path); err != nil {
+			return cfg, err
+		}
+	}
+	system, err := decodeConfigFile(systemConfigPath)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.mergeSystem(system, systemConfigPath)
+
+	if wd, err := os.Getwd(); err == nil {
+		if path := findProjectConfig(wd); path != "" {
+			project, err := decodeConfigFile(path)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.mergeProject(project, path)
+		}
+	}
+
+	configuredShell = cfg.Shell
+	if err := new(contextOptions).enable(cfg.Context); err != nil {
+		return cfg, fmt.Errorf("context: %w", err)
+	}
+	if cfg.ContextTokens < 0 {
+		return cfg, errors.New("context_tokens must not be negative")
+	}
+	switch cfg.SingleSuggestion {
+	case "", "run", "confirm", "menu":
+	default:
+		return cfg, fmt.Errorf("single_suggestion must be run, confirm or menu, got %q", cfg.SingleSuggestion)
+	}
+	if cfg.confirm, err = compilePatterns("confirm_patterns", cfg.ConfirmPatterns, "%s"); err != nil {
+		return cfg, err
+	}
+	if cfg.deny, err = compilePatterns("deny_patterns", cfg.DenyPatterns, "%s"); err != nil {
+		return cfg, err
+	}
+	// Allowing "ls" must not allow "ls; rm -rf ~", so allow patterns have
+	// to match the whole command.
+	if cfg.allow, err = compilePatterns("allow_patterns", cfg.AllowPatterns, "^(?:%s)$"); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// compilePatterns compiles the regular expressions of the config key,
+// each wrapped in format.
+func compilePatterns(key string, patterns []string, format string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		res = append(res, regexp.MustCompile(fmt.Sprintf(format, p)))
+	}
+	return res, nil
+}
+
+// decodeConfigFile parses one config file, rejecting unknown keys so typos
+// don't go unnoticed. A missing file yields an empty config.
+func decodeConfigFile(path string) (config, error) {
+	var cfg config
+	md, err := toml.DecodeFile(path, &cfg)
+	if errors.Is(err, os.ErrNotExist) {
+		return config{}, nil
+	}
+	if err != nil {
+		return config{}, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return config{}, fmt.Errorf("%s: unknown keys: %s", path, strings.Join(keys, ", "))
+	}
+	return cfg, nil
+}
+
+// mergeSystem adds the policy from the system config at path. Only the
+// command patterns, audit_log, prefer and tasks are read from it; other
+// keys are ignored with a warning. Its patterns and preferences add to the
+// user's, so a user can't drop a deny pattern set by an administrator, its
+// audit_log replaces theirs, and its tasks are there for the names the user
+// hasn't taken.
+func (c *config) mergeSystem(p config, path string) {
+	c.Prefer = append(c.Prefer, p.Prefer...)
+	// Saved tasks are shared defaults; the user's own of the same name win.
+	for name, text := range p.Tasks {
+		if _, ok := c.Tasks[name]; !ok {
+			if c.Tasks == nil {
+				c.Tasks = make(map[string]string)
+			}
+			c.Tasks[name] = text
+		}
+	}
+	c.ConfirmPatterns = append(c.ConfirmPatterns, p.ConfirmPatterns...)
+	c.DenyPatterns = append(c.DenyPatterns, p.DenyPatterns...)
+	c.AllowPatterns = append(c.AllowPatterns, p.AllowPatterns...)
+	if p.AuditLog != "" {
+		c.AuditLog, c.auditLocked = p.AuditLog, true
+	}
+	p.ConfirmPatterns, p.DenyPatterns, p.AllowPatterns, p.AuditLog = nil, nil, nil, ""
+	p.Prefer, p.Tasks = nil, nil
+	if !reflect.ValueOf(p).IsZero() {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring settings other than command patterns, audit_log, prefer and tasks in %s", path))
+	}
+}
+
+// mergeProject applies a project config found at path. Project files come
+// with the repository rather than from the user, so they may not redirect
+// requests: provider, base_url, fan_out and profiles are ignored with a
+// warning. So are settings that are the user's to choose: explain_failures,
+// which sends command output away, the budget settings, MCP servers, which
+// would run programs, the shell, which would be run, allow patterns, which
+// would skip safety prompts, context, which sends more about the machine,
+// single_suggestion, the history, append_shell_history, the audit log and
+// prompt_template, which could drop the safety rules of the prompt.
+// Prompt extras, preferences and confirm and deny patterns add to the global
+// ones, and saved tasks to the global ones of other names.
+func (c *config) mergeProject(p config, path string) {
+	if p.Provider != "" {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring provider in %s; set it in the global config instead", path))
+	}
+	if p.BaseURL != "" {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring base_url in %s; set it in the global config instead", path))
+	}
+	if len(p.FanOut) > 0 {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring fan_out in %s; set it in the global config instead", path))
+	}
+	if p.Profile != "" || len(p.Profiles) > 0 {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring profiles in %s; set them in the global config instead", path))
+	}
+	if p.ExplainFailures != nil {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring explain_failures in %s; set it in the global config instead", path))
+	}
+	if p.MonthlyTokenBudget != 0 || p.MonthlyCostBudget != 0 || p.BudgetAction != "" {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring budget settings in %s; set them in the global config instead", path))
+	}
+	if len(p.MCPServers) > 0 {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring mcp_servers in %s; set them in the global config instead", path))
+	}
+	if p.Shell != "" {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring shell in %s; set it in the global config instead", path))
+	}
+	if p.History != nil {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring history in %s; set it in the global config instead", path))
+	}
+	if p.AppendShellHistory != nil {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring append_shell_history in %s; set it in the global config instead", path))
+	}
+	if p.AuditLog != "" {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring audit_log in %s; set it in the global config instead", path))
+	}
+	if len(p.Context) > 0 {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring context in %s; set it in the global config instead", path))
+	}
+	if p.SingleSuggestion != "" {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring single_suggestion in %s; set it in the global config instead", path))
+	}
+	if len(p.AllowPatterns) > 0 {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring allow_patterns in %s; set them in the global config instead", path))
+	}
+	if p.PromptTemplate != "" {
+		c.warnings = append(c.warnings, fmt.Sprintf("ignoring prompt_template in %s; set it in the global config instead", path))
+	}
+	if p.Model != "" {
+		c.Model = p.Model
+	}
+	if p.ContextTokens != 0 {
+		c.ContextTokens = p.ContextTokens
+	}
+	if p.PromptExtra != "" {
+		c.PromptExtra = strings.TrimSpace(strings.TrimSpace(c.PromptExtra) + "\n" + p.PromptExtra)
+	}
+	c.Prefer = append(c.Prefer, p.Prefer...)
+	if len(p.Tasks) > 0 {
+		c.Tasks = maps.Clone(c.Tasks)
+		if c.Tasks == nil {
+			c.Tasks = make(map[string]string)
+		}
+		maps.Copy(c.Tasks, p.Tasks)
+	}
+	c.ConfirmPatterns = append(c.ConfirmPatterns, p.ConfirmPatterns...)
+	c.DenyPatterns = append(c.DenyPatterns, p.DenyPatterns...)
+}
+
+// keepHistory reports whether picked commands are saved for `ai history`.
+func (c config) keepHistory() bool {
+	return c.History == nil || *c.History
+}
+
+// appendShellHistory reports whether commands run are added to the shell's
+// history file.
+func (c config) appendShellHistory() bool {
+	return c.AppendShellHistory != nil && *c.AppendShellHistory
+}
+
+// explainFailures reports whether failed commands should be explained.
+func (c config) explainFailures() bool {
+	return c.ExplainFailures != nil && *c.ExplainFailures
+}
+
+// confirmReason reports which confirm pattern cmd matches, or "" if none.
+func (c config) confirmReason(cmd string) string {
+	for _, re := range c.confirm {
+		if re.MatchString(cmd) {
+			return fmt.Sprintf("matches confirm pattern %q", re.String())
+		}
+	}
+	return ""
+}
+
+// denyReason reports which deny pattern blocks cmd, or "" if none.
+func (c config) denyReason(cmd string) string {
+	for _, re := range c.deny {
+		if re.MatchString(cmd) {
+			return fmt.Sprintf("matches deny pattern %q", re.String())
+		}
+	}
+	return ""
+}
+
+// allowed reports whether an allow pattern lets cmd run without safety
+// prompts.
+func (c config) allowed(cmd string) bool {
+	return slices.ContainsFunc(c.allow, func(re *regexp.Regexp) bool { return re.MatchString(cmd) })
+}
+
+// dropBlocked returns cmds without the ones a deny pattern blocks, and the
+// reason the first of those was blocked.
+func (c config) dropBlocked(cmds []string) ([]string, string) {
+	var kept []string
+	var reason string
+	for _, cmd := range cmds {
+		if r := c.denyReason(cmd); r == "" {
+			kept = append(kept, cmd)
+		} else if reason == "" {
+			reason = r
+		}
+	}
+	return kept, reason
+}
+
+// selectProfile activates the named profile, falling back to AI_PROFILE and
+// the profile key. It is a no-op when no profile is requested.
+func (c *config) selectProfile(name string) error {
+	name = firstNonEmpty(name, os.Getenv("AI_PROFILE"), c.Profile)
+	if name == "" {
+		return nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		names := slices.Sorted(maps.Keys(c.Profiles))
+		if len(names) == 0 {
+			return fmt.Errorf("unknown profile %q: no profiles configured", name)
+		}
+		return fmt.Errorf("unknown profile %q (want one of: %s)", name, strings.Join(names, ", "))
+	}
+	if p.APIKeyEnv != "" && p.APIKeyCmd != "" {
+		return fmt.Errorf("profile %q: set api_key_env or api_key_cmd, not both", name)
+	}
+	if p.PromptExtra != "" {
+		c.PromptExtra = strings.TrimSpace(strings.TrimSpace(c.PromptExtra) + "\n" + p.PromptExtra)
+	}
+	c.active = &p
+	return nil
+}
+
+// resolveProvider picks the provider and its options with the precedence
+// flag > profile > environment > config file > built-in default.
+func resolveProvider(cfg config, providerFlag, modelFlag string, opts ai.Options) (ai.Provider, error) {
+	provider, err := newProvider(cfg, providerFlag, modelFlag, opts)
+	if err != nil {
+		return nil, err
+	}
+	return recordReplies(provider), nil
+}
+
+// newProvider builds the provider resolveProvider picks, without recording.
+func newProvider(cfg config, providerFlag, modelFlag string, opts ai.Options) (ai.Provider, error) {
+	var p profile
+	if cfg.active != nil {
+		p = *cfg.active
+	}
+	opts.Model = firstNonEmpty(modelFlag, p.Model, os.Getenv("AI_MODEL"), cfg.Model)
+	opts.BaseURL = firstNonEmpty(p.BaseURL, os.Getenv("AI_BASE_URL"), cfg.BaseURL)
+	key, err := p.apiKey()
+	if err != nil {
+		return nil, err
+	}
+	opts.APIKey = key
+	opts.Transport = clientTransport
+	return ai.NewProvider(resolveProviderName(cfg, providerFlag), opts)
+}
+
+// recordReplies wraps provider to save its replies to the fixture named by
+// AI_RECORD, if set.
+func recordReplies(provider ai.Provider) ai.Provider {
+	if path := os.Getenv("AI_RECORD"); path != "" {
+		r := ai.NewRecorder(provider, path)
+		r.OnSaveError = func(err error) {
+			fmt.Fprintln(os.Stderr, "Warning: AI_RECORD:", err)
+		}
+		return r
+	}
+	return provider
+}
+
+// resolveProviderName returns the provider name with the same precedence as
+// resolveProvider, defaulting to "openai". Setting AI_FIXTURE selects the
+// mock provider unless --provider names another.
+func resolveProviderName(cfg config, providerFlag string) string {
+	if providerFlag == "" && os.Getenv("AI_FIXTURE") != "" {
+		return "mock"
+	}
+	var fromProfile string
+	if cfg.active != nil {
+		fromProfile = cfg.active.Provider
+	}
+	return firstNonEmpty(providerFlag, fromProfile, os.Getenv("AI_PROVIDER"), cfg.Provider, "openai")
+}
+
+// apiKey returns the key from the profile's key source, or "" when the
+// profile doesn't set one and the provider's own variable should be used.
+func (p profile) apiKey() (string, error) {
+	switch {
+	case p.APIKeyEnv != "":
+		key := strings.TrimSpace(os.Getenv(p.APIKeyEnv))
+		if key == "" {
+			return "", fmt.Errorf("%s not set", p.APIKeyEnv)
+		}
+		return key, nil
+	case p.APIKeyCmd != "":
+		ctx, cancel := context.WithTimeout(context.Background(), apiKeyCmdTimeout)
+		defer cancel()
+		shell := ai.DefaultShell()
+		cmd := exec.CommandContext(ctx, shell, append(ai.ShellArgs(shell), p.APIKeyCmd)...)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("api_key_cmd failed: %w", err)
+		}
+		key := strings.TrimSpace(string(out))
+		if key == "" {
+			return "", errors.New("api_key_cmd printed no key")
+		}
+		return key, nil
+	}
+	return "", nil
+}
+
+// firstNonEmpty returns the first argument that isn't blank.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
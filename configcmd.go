@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// configKey describes one key that `ai config` can read and write.
+type configKey struct {
+	name     string
+	validate func(value string, cfg config) error
+	bare     bool // written unquoted, as a TOML boolean or number
+}
+
+var (
+	tableHeaderRe = regexp.MustCompile(`^\s*\[\[?\s*([^\[\]]+?)\s*\]\]?\s*(#.*)?$`)
+	envNameRe     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	profileNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// topLevelKeys and profileKeys are the scalar settings `ai config set`
+// accepts; profile keys are addressed as profiles.<name>.<key>.
+var (
+	topLevelKeys = []configKey{
+		{"provider", validateProvider, false},
+		{"model", nil, false},
+		{"base_url", validateBaseURL, false},
+		{"prompt_extra", nil, false},
+		{"prompt_template", nil, false},
+		{"shell", nil, false},
+		{"explain_failures", validateBool, true},
+		{"history", validateBool, true},
+		{"append_shell_history", validateBool, true},
+		{"context_tokens", validateCount, true},
+		{"monthly_token_budget", validateCount, true},
+		{"monthly_cost_budget", func(v string, _ config) error {
+			if f, err := strconv.ParseFloat(v, 64); err != nil || f < 0 || strconv.FormatFloat(f, 'f', -1, 64) != v {
+				return fmt.Errorf("%q is not a non-negative amount such as 20 or 12.5", v)
+			}
+			return nil
+		}, true},
+		{"budget_action", func(v string, _ config) error {
+			if v != "refuse" && v != "warn" {
+				return fmt.Errorf("%q is not refuse or warn", v)
+			}
+			return nil
+		}, false},
+		{"single_suggestion", func(v string, _ config) error {
+			if v != "run" && v != "confirm" && v != "menu" {
+				return fmt.Errorf("%q is not run, confirm or menu", v)
+			}
+			return nil
+		}, false},
+		{"profile", func(v string, cfg config) error {
+			if _, ok := cfg.Profiles[v]; !ok {
+				return fmt.Errorf("no profile %q is defined; add profiles.%s.* keys first", v, v)
+			}
+			return nil
+		}, false},
+	}
+	profileKeys = []configKey{
+		{"provider", validateProvider, false},
+		{"model", nil, false},
+		{"base_url", validateBaseURL, false},
+		{"api_key_env", func(v string, _ config) error {
+			if !envNameRe.MatchString(v) {
+				return fmt.Errorf("%q is not a valid environment variable name", v)
+			}
+			return nil
+		}, false},
+		{"api_key_cmd", nil, false},
+		{"prompt_extra", nil, false},
+	}
+)
+
+func validateProvider(v string, _ config) error {
+	if !slices.Contains(ai.ProviderNames, v) {
+		return fmt.Errorf("unknown provider %q (want one of: %s)", v, strings.Join(ai.ProviderNames, ", "))
+	}
+	return nil
+}
+
+func validateCount(v string, _ config) error {
+	if n, err := strconv.Atoi(v); err != nil || n < 0 {
+		return fmt.Errorf("%q is not a non-negative whole number", v)
+	}
+	return nil
+}
+
+func validateBool(v string, _ config) error {
+	if v != "true" && v != "false" {
+		return fmt.Errorf("%q is not true or false", v)
+	}
+	return nil
+}
+
+func validateBaseURL(v string, _ config) error {
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", v)
+	}
+	return nil
+}
+
+// runConfigCommand implements `ai config get|set|list` on the global config
+// file and returns the process exit code.
+func runConfigCommand(args []string) int {
+	usage := "Usage: ai config list\n       ai config get <key>\n       ai config set <key> <value>"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	path, err := configPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		cfg, err := decodeConfigFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		for _, kv := range configEntries(cfg) {
+			def, _, _ := lookupConfigKey(kv[0])
+			fmt.Printf("%s = %s\n", kv[0], tomlLiteral(def, kv[1]))
+		}
+		return 0
+	case args[0] == "get" && len(args) == 2:
+		if _, _, err := lookupConfigKey(args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 2
+		}
+		cfg, err := decodeConfigFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+		value, ok := configValue(cfg, args[1])
+		if !ok {
+			return 1
+		}
+		fmt.Println(value)
+		return 0
+	case args[0] == "set" && len(args) == 3:
+		if err := setConfigValue(path, args[1], args[2]); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 2
+		}
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
+
+// lookupConfigKey resolves a dotted key to its definition and TOML table;
+// the table is "" for top-level keys and "profiles.<name>" for profile keys.
+func lookupConfigKey(key string) (configKey, string, error) {
+	defs, table, name := topLevelKeys, "", key
+	if rest, ok := strings.CutPrefix(key, "profiles."); ok {
+		profile, field, ok := strings.Cut(rest, ".")
+		if !ok || !profileNameRe.MatchString(profile) {
+			return configKey{}, "", fmt.Errorf("profile keys look like profiles.<name>.<key>, got %q", key)
+		}
+		defs, table, name = profileKeys, "profiles."+profile, field
+	}
+	for _, d := range defs {
+		if d.name == name {
+			return d, table, nil
+		}
+	}
+	names := make([]string, len(defs))
+	for i, d := range defs {
+		names[i] = d.name
+	}
+	return configKey{}, "", fmt.Errorf("unknown config key %q (want one of: %s)", key, strings.Join(names, ", "))
+}
+
+// configEntries flattens the scalar settings of cfg into sorted dotted keys.
+func configEntries(cfg config) [][2]string {
+	var entries [][2]string
+	add := func(key, value string) {
+		if value != "" {
+			entries = append(entries, [2]string{key, value})
+		}
+	}
+	if cfg.AppendShellHistory != nil {
+		add("append_shell_history", strconv.FormatBool(*cfg.AppendShellHistory))
+	}
+	add("base_url", cfg.BaseURL)
+	add("budget_action", cfg.BudgetAction)
+	if cfg.ContextTokens != 0 {
+		add("context_tokens", strconv.Itoa(cfg.ContextTokens))
+	}
+	if cfg.ExplainFailures != nil {
+		add("explain_failures", strconv.FormatBool(*cfg.ExplainFailures))
+	}
+	if cfg.History != nil {
+		add("history", strconv.FormatBool(*cfg.History))
+	}
+	add("model", cfg.Model)
+	if cfg.MonthlyCostBudget != 0 {
+		add("monthly_cost_budget", strconv.FormatFloat(cfg.MonthlyCostBudget, 'f', -1, 64))
+	}
+	if cfg.MonthlyTokenBudget != 0 {
+		add("monthly_token_budget", strconv.Itoa(cfg.MonthlyTokenBudget))
+	}
+	add("profile", cfg.Profile)
+	add("prompt_extra", cfg.PromptExtra)
+	add("prompt_template", cfg.PromptTemplate)
+	add("provider", cfg.Provider)
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		p := cfg.Profiles[name]
+		prefix := "profiles." + name + "."
+		add(prefix+"api_key_cmd", p.APIKeyCmd)
+		add(prefix+"api_key_env", p.APIKeyEnv)
+		add(prefix+"base_url", p.BaseURL)
+		add(prefix+"model", p.Model)
+		add(prefix+"prompt_extra", p.PromptExtra)
+		add(prefix+"provider", p.Provider)
+	}
+	add("shell", cfg.Shell)
+	add("single_suggestion", cfg.SingleSuggestion)
+	return entries
+}
+
+// configValue returns the value of a dotted key and whether it is set.
+func configValue(cfg config, key string) (string, bool) {
+	for _, kv := range configEntries(cfg) {
+		if kv[0] == key {
+			return kv[1], true
+		}
+	}
+	return "", false
+}
+
+// setConfigValue validates value and writes it to the config file at path,
+// keeping the rest of the file, comments included, as it was.
+func setConfigValue(path, key, value string) error {
+	def, table, err := lookupConfigKey(key)
+	if err != nil {
+		return err
+	}
+	cfg, err := decodeConfigFile(path)
+	if err != nil {
+		return err
+	}
+	if def.validate != nil {
+		if err := def.validate(value, cfg); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	updated, err := setTOMLKey(string(data), table, def.name, tomlLiteral(def, value))
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(updated), 0o600); err != nil {
+		return err
+	}
+	// Re-read the edited file so a construct the line editor doesn't handle
+	// (inline tables, dotted keys) never leaves a broken or stale config.
+	check, err := decodeConfigFile(tmp)
+	if got, _ := configValue(check, key); err != nil || got != value {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("could not update %s automatically; edit %s by hand", key, path)
+	}
+	return os.Rename(tmp, path)
+}
+
+// setTOMLKey sets key = literal in table within the TOML document content,
+// replacing an existing assignment or adding one (and the table) if needed.
+func setTOMLKey(content, table, key, literal string) (string, error) {
+	lines := strings.Split(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	keyRe := regexp.MustCompile(`^\s*(` + regexp.QuoteMeta(key) + `|"` + regexp.QuoteMeta(key) + `")\s*=(.*)$`)
+	assignment := key + " = " + literal
+
+	current := ""
+	tableFound := table == ""
+	insertAt := -1 // index after the last non-blank line of the target table
+	if table == "" {
+		insertAt = 0
+	}
+	for i, line := range lines {
+		if m := tableHeaderRe.FindStringSubmatch(line); m != nil {
+			current = m[1]
+			if current == table {
+				tableFound = true
+				insertAt = i + 1
+			}
+			continue
+		}
+		if current != table {
+			continue
+		}
+		if m := keyRe.FindStringSubmatch(line); m != nil {
+			v := strings.TrimSpace(m[2])
+			if strings.HasPrefix(v, `"""`) || strings.HasPrefix(v, "'''") {
+				return "", errors.New("the current value is a multi-line string; edit it by hand")
+			}
+			lines[i] = assignment
+			return strings.Join(lines, "\n") + "\n", nil
+		}
+		if strings.TrimSpace(line) != "" {
+			insertAt = i + 1
+		}
+	}
+
+	if !tableFound {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+table+"]", assignment)
+		return strings.Join(lines, "\n") + "\n", nil
+	}
+	lines = slices.Insert(lines, insertAt, assignment)
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// tomlLiteral renders a value of key def as it is written in the file.
+func tomlLiteral(def configKey, value string) string {
+	if def.bare {
+		return value
+	}
+	return tomlQuote(value)
+}
+
+// tomlQuote renders s as a TOML basic string.
+func tomlQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
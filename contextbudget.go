@@ -0,0 +1,140 @@
+package main
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	// defaultContextTokens caps the environment context of a request unless
+	// context_tokens says otherwise. It leaves room for the files a task
+	// attaches, which take up to fileAttachBytes.
+	defaultContextTokens = 12000
+	// minContextEntryBytes is the least of an entry worth sending cut off;
+	// with less room left it is dropped instead.
+	minContextEntryBytes = 200
+)
+
+// Priorities of the context entries, most important first: what describes
+// the machine, the tools on it, the files the task names, the working
+// directory and repository, what MCP servers and context scripts add, and
+// last what comes from the shell history.
+const (
+	priorityCore = iota
+	priorityTools
+	priorityFiles
+	priorityWorkspace
+	priorityExtra
+	priorityHistory
+)
+
+// contextPriority returns the priority of the context entry named key.
+func contextPriority(key string) int {
+	switch {
+	case key == "tools_installed" || key == "tools_not_installed" || key == "frequently_used_tools":
+		return priorityTools
+	case strings.HasPrefix(key, "file "):
+		return priorityFiles
+	case key == "directory_listing" || strings.HasPrefix(key, "git_"):
+		return priorityWorkspace
+	case key == "recent_commands" || key == "shell_aliases" || key == "shell_functions":
+		return priorityHistory
+	case key == "os" || key == "arch" || key == "shell" || key == "safe_mode" || key == "system" ||
+		key == "coreutils" || key == "virtualization" || key == "working_directory" || key == "user_notes" || key == "user_preferences":
+		return priorityCore
+	}
+	return priorityExtra
+}
+
+// contextFit says what fitContext kept of each entry.
+type contextFit struct {
+	included, truncated, dropped []string
+	tokens                       int
+}
+
+// fitContext returns the entries of env that fit in budget tokens, taken in
+// order of priority. The first entry that doesn't fit is cut off to what
+// room is left, if that is worth sending, and the entries after it that
+// still fit are kept. The task isn't part of env, so it is always sent in
+// full.
+func fitContext(env map[string]string, budget int) (map[string]string, contextFit) {
+	keys := slices.SortedFunc(maps.Keys(env), func(a, b string) int {
+		return cmp.Or(cmp.Compare(contextPriority(a), contextPriority(b)), strings.Compare(a, b))
+	})
+	fitted := make(map[string]string, len(env))
+	var fit contextFit
+	room := budget * bytesPerToken
+	for _, k := range keys {
+		v := env[k]
+		if v == "" {
+			continue
+		}
+		// As WriteEnvironment renders it: "- key: value\n".
+		size := len(k) + len(v) + 4
+		if size > room {
+			if v = truncateContext(k, v, room-len(k)-4); v == "" {
+				fit.dropped = append(fit.dropped, k)
+				continue
+			}
+			size = len(k) + len(v) + 4
+			fit.truncated = append(fit.truncated, k)
+		} else {
+			fit.included = append(fit.included, k)
+		}
+		fitted[k] = v
+		room -= size
+	}
+	fit.tokens = budget - room/bytesPerToken
+	return fitted, fit
+}
+
+// truncateContext cuts the value v of the context entry key to at most n
+// bytes, or returns "" when n is too small to be worth it. Lines are kept
+// whole, the last ones for the recent commands and the first ones
+// otherwise, and a list on one line is cut after an item.
+func truncateContext(key, v string, n int) string {
+	if n < minContextEntryBytes {
+		return ""
+	}
+	const (
+		more    = "\n[truncated]"
+		earlier = "[earlier ones left out]\n"
+		andMore = ", …"
+	)
+	switch {
+	case key == "recent_commands":
+		lines := strings.Split(v, "\n")
+		for i := range lines {
+			if rest := strings.Join(lines[i:], "\n"); len(earlier)+len(rest) <= n {
+				return earlier + rest
+			}
+		}
+	case strings.Contains(v, "\n"):
+		if i := strings.LastIndex(v[:n-len(more)], "\n"); i > 0 {
+			return v[:i] + more
+		}
+	case strings.Contains(v, ", "):
+		if i := strings.LastIndex(v[:n-len(andMore)], ", "); i > 0 {
+			return v[:i] + andMore
+		}
+	}
+	return strings.ToValidUTF8(v[:n-len("…")], "") + "…"
+}
+
+// fitEnvironment fits env to the context budget of the configuration and
+// logs, at -v, what was sent of it.
+func (s *session) fitEnvironment(env map[string]string) map[string]string {
+	budget := cmp.Or(s.cfg.ContextTokens, defaultContextTokens)
+	fitted, fit := fitContext(env, budget)
+	attrs := []any{"tokens", fit.tokens, "budget", budget, "included", strings.Join(fit.included, ", ")}
+	if len(fit.truncated) > 0 {
+		attrs = append(attrs, "truncated", strings.Join(fit.truncated, ", "))
+	}
+	if len(fit.dropped) > 0 {
+		attrs = append(attrs, "dropped", strings.Join(fit.dropped, ", "))
+	}
+	s.log.Info("context", attrs...)
+	return fitted
+}
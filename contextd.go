@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// contextScriptTimeout bounds each context script, so a slow one delays
+	// a request only so much.
+	contextScriptTimeout = 2 * time.Second
+	// contextScriptBytes caps the output a script adds to the prompt.
+	contextScriptBytes = 1024
+)
+
+// contextScriptDir returns the directory of context scripts: context.d next
+// to the global config file (~/.config/ai/context.d on Linux).
+func contextScriptDir() (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "context.d"), nil
+}
+
+// gatherScriptContext runs the executable files in dir in parallel and
+// returns the output of each as a context entry named after the file,
+// without its extension. Hidden files, directories and files that aren't
+// executable are left alone, as are scripts that print nothing; scripts that
+// fail or time out are reported to warn and left out. A missing dir adds
+// nothing.
+func gatherScriptContext(dir string, warn io.Writer) map[string]string {
+	info := make(map[string]string)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(warn, "Warning: context scripts: %v\n", err)
+		}
+		return info
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") || !isExecutable(e) {
+			continue
+		}
+		name := strings.TrimSuffix(e.Name(), filepath.Ext(e.Name()))
+		wg.Go(func() {
+			text, err := runContextScript(filepath.Join(dir, e.Name()))
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fmt.Fprintf(warn, "Warning: context script %s: %v\n", e.Name(), err)
+				return
+			}
+			if text != "" {
+				info[name] = text
+			}
+		})
+	}
+	wg.Wait()
+	return info
+}
+
+// isExecutable reports whether e is a file that can be run. Windows has no
+// execute permission, so there every regular file counts.
+func isExecutable(e os.DirEntry) bool {
+	fi, err := e.Info()
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+	return runtime.GOOS == "windows" || fi.Mode().Perm()&0o111 != 0
+}
+
+// runContextScript runs the script at path with no input and returns its
+// output, with secrets redacted and cut to contextScriptBytes.
+func runContextScript(path string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), contextScriptTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path)
+	cmd.WaitDelay = time.Second
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("no output within %v", contextScriptTimeout)
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if msg, _, _ := strings.Cut(strings.TrimSpace(string(exitErr.Stderr)), "\n"); msg != "" {
+				return "", fmt.Errorf("%w: %s", err, msg)
+			}
+		}
+		return "", err
+	}
+	text := redactSecrets(strings.TrimSpace(string(out)))
+	if len(text) > contextScriptBytes {
+		text = strings.ToValidUTF8(text[:contextScriptBytes], "") + "\n[truncated]"
+	}
+	return text, nil
+}
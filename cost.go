@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// modelPrice is what a model costs in US dollars per million tokens.
+type modelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// modelPrices holds list prices for common models, keyed by model name
+// prefix so dated snapshots match their family. They only feed estimates;
+// the provider's bill is what counts.
+var modelPrices = map[string]modelPrice{
+	"gpt-5":                 {1.25, 10},
+	"gpt-5-mini":            {0.25, 2},
+	"gpt-5-nano":            {0.05, 0.40},
+	"gpt-4.1":               {2, 8},
+	"gpt-4.1-mini":          {0.40, 1.60},
+	"gpt-4.1-nano":          {0.10, 0.40},
+	"gpt-4o":                {2.50, 10},
+	"gpt-4o-mini":           {0.15, 0.60},
+	"claude-opus-4":         {15, 75},
+	"claude-sonnet-4":       {3, 15},
+	"claude-haiku-4":        {1, 5},
+	"claude-3-5-haiku":      {0.80, 4},
+	"gemini-2.5-pro":        {1.25, 10},
+	"gemini-2.5-flash":      {0.30, 2.50},
+	"gemini-2.5-flash-lite": {0.10, 0.40},
+	"gemini-2.0-flash":      {0.10, 0.40},
+}
+
+// priceFor returns the price of model, matching the longest known prefix.
+func priceFor(model string) (modelPrice, bool) {
+	var best string
+	for prefix := range modelPrices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return modelPrice{}, false
+	}
+	return modelPrices[best], true
+}
+
+// cost estimates what usage cost on model, reporting false when the model's
+// price is unknown.
+func cost(model string, usage ai.Usage) (float64, bool) {
+	p, ok := priceFor(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.InputTokens)*p.Input + float64(usage.OutputTokens)*p.Output) / 1e6, true
+}
+
+// callsCost estimates the cost of the individual calls of a run. The bool
+// is false when the price of any model used is unknown; the sum then only
+// covers the calls that could be priced.
+func callsCost(calls []ai.Result) (float64, bool) {
+	total, known := 0.0, true
+	for _, c := range calls {
+		if c.Usage.TotalTokens == 0 {
+			continue
+		}
+		usd, ok := cost(c.Model, c.Usage)
+		total += usd
+		known = known && ok
+	}
+	return total, known
+}
+
+// describeCost renders an estimated cost for verbose output.
+func describeCost(usd float64, known bool) string {
+	if !known {
+		if usd == 0 {
+			return "unknown (no price for this model)"
+		}
+		return fmt.Sprintf("at least $%.4f (no price for some models)", usd)
+	}
+	return fmt.Sprintf("$%.4f", usd)
+}
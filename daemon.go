@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+const (
+	// upstreamHeader carries the scheme and host a request forwarded to the
+	// daemon is meant for.
+	upstreamHeader = "X-Ai-Upstream"
+	// daemonIdleTimeout is how long the daemon keeps idle provider
+	// connections open for the next run.
+	daemonIdleTimeout = 5 * time.Minute
+)
+
+// daemonSocketPath returns where `ai serve` listens: ai.sock in
+// $XDG_RUNTIME_DIR, or in the state directory when that isn't set.
+func daemonSocketPath() (string, error) {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "ai.sock"), nil
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ai.sock"), nil
+}
+
+// clientTransport routes provider requests through `ai serve` when it is
+// running and over ai.SharedTransport otherwise.
+var clientTransport = &daemonTransport{direct: ai.SharedTransport}
+
+// daemonTransport sends provider requests through a running `ai serve`,
+// whose connections are already open, and directly when none is running.
+// Set AI_NO_DAEMON=1 to always go direct.
+type daemonTransport struct {
+	direct http.RoundTripper
+	once   sync.Once
+	via    *http.Transport // nil when no daemon answered
+}
+
+func (t *daemonTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.once.Do(t.connect)
+	if t.via == nil {
+		return t.direct.RoundTrip(req)
+	}
+	out := req.Clone(req.Context())
+	out.Header.Set(upstreamHeader, req.URL.Scheme+"://"+req.URL.Host)
+	out.URL = &url.URL{Scheme: "http", Host: "ai-daemon", Path: req.URL.Path, RawPath: req.URL.RawPath, RawQuery: req.URL.RawQuery}
+	out.Host = ""
+	return t.via.RoundTrip(out)
+}
+
+// connect looks for a daemon once per process; dialing a unix socket is
+// cheap compared to the handshake it saves.
+func (t *daemonTransport) connect() {
+	if os.Getenv("AI_NO_DAEMON") != "" {
+		return
+	}
+	path, err := daemonSocketPath()
+	if err != nil {
+		return
+	}
+	conn, err := net.DialTimeout("unix", path, 100*time.Millisecond)
+	if err != nil {
+		return
+	}
+	_ = conn.Close()
+	t.via = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+		MaxIdleConnsPerHost: 16,
+	}
+}
+
+// runServe implements `ai serve`: a foreground daemon on a unix socket that
+// forwards provider requests over connections it keeps warm between runs.
+// Only the connections are kept: each run still gathers its own context.
+func runServe(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: ai serve")
+		return 2
+	}
+	path, err := daemonSocketPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	if conn, err := net.DialTimeout("unix", path, 100*time.Millisecond); err == nil {
+		_ = conn.Close()
+		fmt.Fprintf(os.Stderr, "Error: a daemon is already listening on %s\n", path)
+		return 1
+	}
+	// Nothing answered, so a leftover socket file is stale.
+	_ = os.Remove(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	// The socket forwards requests with the user's credentials, so only
+	// the user may connect, from the moment it exists.
+	ln, err := listenPrivate(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = ln.Close()
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+
+	ai.SharedTransport.IdleConnTimeout = daemonIdleTimeout
+	srv := &http.Server{Handler: http.HandlerFunc(forwardToUpstream), ReadHeaderTimeout: 10 * time.Second}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		_ = srv.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening on %s (Ctrl-C to stop)\n", path)
+	err = srv.Serve(ln)
+	_ = os.Remove(path)
+	if !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// forwardToUpstream sends a request received from the CLI on to the
+// provider named in upstreamHeader and streams the response back, flushing
+// as it goes so streamed replies arrive as they are generated.
+func forwardToUpstream(w http.ResponseWriter, r *http.Request) {
+	upstream, err := url.Parse(r.Header.Get(upstreamHeader))
+	if err != nil || (upstream.Scheme != "http" && upstream.Scheme != "https") || upstream.Host == "" {
+		http.Error(w, "missing or invalid "+upstreamHeader+" header", http.StatusBadRequest)
+		return
+	}
+	target := *r.URL
+	target.Scheme, target.Host = upstream.Scheme, upstream.Host
+	out, err := http.NewRequestWithContext(r.Context(), r.Method, target.String(), r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	out.Header = r.Header.Clone()
+	out.Header.Del(upstreamHeader)
+	out.ContentLength = r.ContentLength
+
+	resp, err := ai.SharedTransport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				fmt.Fprintln(os.Stderr, "Warning: upstream response cut short:", err)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// dirListingMax caps the entries of the working directory sent with --ctx
+// dir, so a huge directory doesn't crowd out the task.
+const dirListingMax = 50
+
+// listDirectory describes the entries of dir for the context, on one line:
+// directories end in a slash, files show their size, and symlinks and
+// executables are marked, such as "logs/, app.log (12K), run.sh (2K,
+// executable)". Hidden entries come after the others, and past
+// dirListingMax the rest are only counted.
+func listDirectory(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	hidden := func(e os.DirEntry) bool { return strings.HasPrefix(e.Name(), ".") }
+	slices.SortStableFunc(entries, func(a, b os.DirEntry) int {
+		switch {
+		case hidden(a) == hidden(b):
+			return 0
+		case hidden(a):
+			return 1
+		}
+		return -1
+	})
+	var parts []string
+	for i, e := range entries {
+		if i == dirListingMax {
+			parts = append(parts, fmt.Sprintf("and %d more", len(entries)-i))
+			break
+		}
+		parts = append(parts, describeEntry(e))
+	}
+	if len(parts) == 0 {
+		return "(empty)"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// describeEntry returns the name of e with its type or size.
+func describeEntry(e os.DirEntry) string {
+	info, err := e.Info()
+	switch {
+	case err != nil:
+		return e.Name()
+	case info.Mode()&os.ModeSymlink != 0:
+		return e.Name() + " (symlink)"
+	case info.IsDir():
+		return e.Name() + "/"
+	case !info.Mode().IsRegular():
+		return e.Name() + " (special)"
+	case info.Mode().Perm()&0o111 != 0:
+		return fmt.Sprintf("%s (%s, executable)", e.Name(), formatSize(info.Size()))
+	}
+	return fmt.Sprintf("%s (%s)", e.Name(), formatSize(info.Size()))
+}
+
+// formatSize renders a file size briefly, such as 512B, 12K or 1.5M.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	size := float64(n)
+	for _, suffix := range []string{"K", "M", "G", "T"} {
+		size /= unit
+		if size < unit || suffix == "T" {
+			if size < 10 {
+				return fmt.Sprintf("%.1f%s", size, suffix)
+			}
+			return fmt.Sprintf("%.0f%s", size, suffix)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// doctorCheck is one line of the `ai doctor` checklist.
+type doctorCheck struct {
+	name     string
+	critical bool
+	run      func() (detail string, err error)
+}
+
+// runDoctor checks the setup and prints a pass/fail checklist. It returns the
+// process exit code: non-zero when any critical check failed.
+func runDoctor() int {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	cfg, cfgErr := loadConfig()
+	if cfgErr == nil {
+		cfgErr = cfg.selectProfile("")
+	}
+	name := resolveProviderName(cfg, "")
+	provider, providerErr := resolveProvider(cfg, "", "", ai.Options{})
+	checker, canCheck := provider.(ai.Checker)
+	probe := func(check func(ai.Checker) error) func() (string, error) {
+		return func() (string, error) {
+			switch {
+			case providerErr != nil:
+				return "", fmt.Errorf("skipped, provider not configured")
+			case !canCheck:
+				return "", fmt.Errorf("skipped, not supported by this provider")
+			}
+			return "", check(checker)
+		}
+	}
+
+	checks := []doctorCheck{
+		{"Provider configured", true, func() (string, error) {
+			if providerErr != nil {
+				return "", providerErr
+			}
+			return name, nil
+		}},
+		{"API reachable and credentials valid", true, probe(func(c ai.Checker) error {
+			return c.CheckAccess(ctx)
+		})},
+		{"Model available", true, func() (string, error) {
+			detail, err := probe(func(c ai.Checker) error {
+				return c.CheckModel(ctx)
+			})()
+			if err == nil && canCheck {
+				detail = checker.ModelName()
+			}
+			return detail, err
+		}},
+		{"Shell detected", true, func() (string, error) {
+			path, err := exec.LookPath(targetShell())
+			if err != nil {
+				return "", fmt.Errorf("%s not found; set $SHELL or the shell setting to an installed shell", targetShell())
+			}
+			return path, nil
+		}},
+		{"Configuration parses", true, func() (string, error) {
+			if cfgErr != nil {
+				return "", cfgErr
+			}
+			if _, err := loadBudget(cfg); err != nil {
+				return "", err
+			}
+			if _, err := captureLimit(); err != nil {
+				return "", err
+			}
+			return "", nil
+		}},
+		{"Project config", false, func() (string, error) {
+			if len(cfg.warnings) > 0 {
+				return "", errors.New(strings.Join(cfg.warnings, "; "))
+			}
+			wd, err := os.Getwd()
+			if err != nil {
+				return "", err
+			}
+			if path := findProjectConfig(wd); path != "" {
+				return path, nil
+			}
+			return "none", nil
+		}},
+		{"Command policy", false, func() (string, error) {
+			detail := fmt.Sprintf("%d deny, %d allow, %d confirm patterns", len(cfg.DenyPatterns), len(cfg.AllowPatterns), len(cfg.ConfirmPatterns))
+			if _, err := os.Stat(systemConfigPath); err == nil {
+				detail += ", system policy " + systemConfigPath
+			}
+			return detail, nil
+		}},
+		{"Audit log writable", false, func() (string, error) {
+			path := auditLogPath(cfg)
+			if path == "" {
+				return "off", nil
+			}
+			f, err := openAuditLog(path)
+			if err != nil {
+				return "", err
+			}
+			f.Close()
+			return path, nil
+		}},
+		{"Usage state readable", false, func() (string, error) {
+			path, err := usageFilePath()
+			if err != nil {
+				return "", err
+			}
+			if _, err := loadUsage(); err != nil {
+				return "", fmt.Errorf("%w; delete %s to reset", err, path)
+			}
+			return path, nil
+		}},
+	}
+
+	failed := false
+	for _, c := range checks {
+		detail, err := c.run()
+		switch {
+		case err == nil:
+			if detail != "" {
+				fmt.Printf("[PASS] %s (%s)\n", c.name, detail)
+			} else {
+				fmt.Printf("[PASS] %s\n", c.name)
+			}
+		case c.critical:
+			failed = true
+			fmt.Printf("[FAIL] %s: %v\n", c.name, err)
+		default:
+			fmt.Printf("[WARN] %s: %v\n", c.name, err)
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
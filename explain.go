@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// runExplain implements "ai explain": it asks the model what an existing
+// command does, part by part. The command comes from the arguments or, when
+// there are none, from piped stdin.
+func runExplain(args []string) int {
+	flags := &cliFlags{}
+	fs := newProviderFlagSet("ai explain", flags)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: ai explain [flags] <command>")
+		fmt.Fprintln(out, "       <command> | ai explain [flags]")
+		fmt.Fprintln(out, "\nExplain what a shell command does, part by part.")
+		fmt.Fprintln(out, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	// Parsing stops at the first non-flag, so the command's own flags
+	// (rm -rf, ls -la) are left alone.
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	cmd := strings.Join(fs.Args(), " ")
+	if cmd == "" && !term.IsTerminal(int(os.Stdin.Fd())) {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 2
+		}
+		cmd = string(data)
+		promptFromTerminal()
+	}
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" {
+		fs.Usage()
+		return 2
+	}
+
+	s, code := newSession(flags)
+	if s == nil {
+		return code
+	}
+	if !s.checkSecrets(cmd) {
+		return 1
+	}
+	explanation, ok := s.complete(buildExplainPrompt(cmd, s.client.Environment["shell"]))
+	if !ok {
+		return 1
+	}
+	fmt.Println(explanation)
+	if reason := cautionReason(s.cfg, cmd); reason != "" {
+		fmt.Fprintf(os.Stderr, "Warning: this command looks destructive (%s).\n", reason)
+	}
+	return 0
+}
+
+// buildExplainPrompt asks for a short breakdown of cmd as the given shell
+// would run it.
+func buildExplainPrompt(cmd, shell string) string {
+	var b strings.Builder
+	b.WriteString("You explain shell commands.\n")
+	b.WriteString("Explain what the following " + shell + " command does.\n")
+	b.WriteString("Rules:\n")
+	b.WriteString("- Start with one sentence summarizing the whole command.\n")
+	b.WriteString("- Then list each part (program, flag, argument, pipe, redirection) on its own line as: <part> - <what it does>.\n")
+	b.WriteString("- Mention side effects: files changed or deleted, network access, elevated privileges.\n")
+	b.WriteString("- Be concise. Plain text only, no Markdown headings or code fences.\n")
+	b.WriteString("\nCommand:\n")
+	b.WriteString(cmd)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// rationaleLineRe matches one numbered line of a rationale reply, "2. why".
+var rationaleLineRe = regexp.MustCompile(`^\s*(\d+)[.):]\s*(.+)$`)
+
+// rationales asks the model for a one-line reason behind each of cmds, as
+// suggestions for task. Entries the reply doesn't cover are left empty; when
+// the request fails the menu is simply shown without them.
+func (s *session) rationales(task string, cmds []string) []string {
+	var b strings.Builder
+	b.WriteString("For each numbered shell command below, suggested for the task, write one short line saying what it does and how it differs from the others.\n")
+	b.WriteString("Answer with exactly one line per command, numbered the same way (\"1. ...\"), and nothing else.\n")
+	b.WriteString("\nTask:\n" + task + "\n\nCommands:\n")
+	for i, cmd := range cmds {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, cmd)
+	}
+	reply, ok := s.complete(b.String())
+	if !ok {
+		return nil
+	}
+	notes := make([]string, len(cmds))
+	for _, line := range strings.Split(reply, "\n") {
+		m := rationaleLineRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if i, _ := strconv.Atoi(m[1]); i >= 1 && i <= len(cmds) {
+			notes[i-1] = strings.TrimSpace(m[2])
+		}
+	}
+	return notes
+}
+
+// runExplainingFailure runs cmd with its stderr teed into a buffer and, if
+// it exits non-zero, offers to ask the model why it failed. It returns the
+// command's exit code either way.
+func (s *session) runExplainingFailure(cmd string) int {
+	limit, err := captureLimit()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	stderr := newTailBuffer(limit)
+	err = runCommandStderr(cmd, stderr)
+	if err == nil {
+		return 0
+	}
+	code := exitCode(err)
+	var exitErr *exec.ExitError
+	var waitErr *waitError
+	if !errors.As(err, &exitErr) && !errors.As(err, &waitErr) || !confirm(fmt.Sprintf("The command exited with status %d. Explain why?", code)) {
+		return code
+	}
+	if explanation, ok := s.complete(buildFailurePrompt(cmd, code, stderr.String(), s.client.Environment["shell"])); ok {
+		fmt.Fprintln(os.Stderr, explanation)
+	}
+	return code
+}
+
+// buildFailurePrompt asks why cmd exited with code and what to try next.
+func buildFailurePrompt(cmd string, code int, stderr, shell string) string {
+	var b strings.Builder
+	b.WriteString("A " + shell + " command failed.\n")
+	b.WriteString("Explain briefly why it most likely failed and what to try next.\n")
+	b.WriteString("If a corrected command would help, give it on its own line.\n")
+	b.WriteString("Be concise. Plain text only, no Markdown headings or code fences.\n")
+	b.WriteString("\nCommand:\n" + cmd + "\n")
+	fmt.Fprintf(&b, "\nExit status: %d\n", code)
+	if stderr = strings.TrimSpace(stderr); stderr != "" {
+		b.WriteString("\nError output:\n" + stderr + "\n")
+	} else {
+		b.WriteString("\nThe command printed no error output.\n")
+	}
+	return b.String()
+}
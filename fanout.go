@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// fanOutEntries returns the profiles and models to spread the calls of a
+// request over: those of --fan-out, or else those of the fan_out key unless
+// the command line picks a single provider, model or profile. It returns
+// nil when calls aren't spread.
+func fanOutEntries(cfg config, flags *cliFlags) []string {
+	if flags.fanOut != "" {
+		var entries []string
+		for e := range strings.SplitSeq(flags.fanOut, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				entries = append(entries, e)
+			}
+		}
+		return entries
+	}
+	if flags.provider != "" || flags.model != "" || flags.profile != "" || os.Getenv("AI_FIXTURE") != "" {
+		return nil
+	}
+	return cfg.FanOut
+}
+
+// resolveFanOut returns a provider spreading calls over entries, each the
+// name of a profile or a provider, optionally followed by a colon and a
+// model, such as anthropic or ollama:llama3.2. Profiles bring their own
+// model, endpoint and key; a provider alone uses its own defaults rather
+// than the top-level settings, which belong to the usual provider.
+func resolveFanOut(cfg config, entries []string, opts ai.Options) (ai.Provider, error) {
+	var providers []ai.Provider
+	for _, e := range entries {
+		var p ai.Provider
+		var err error
+		if prof, ok := cfg.Profiles[e]; ok {
+			if prof.APIKeyEnv != "" && prof.APIKeyCmd != "" {
+				return nil, fmt.Errorf("fan_out: profile %q: set api_key_env or api_key_cmd, not both", e)
+			}
+			c := cfg
+			c.active = &prof
+			p, err = newProvider(c, "", "", opts)
+		} else {
+			name, model, _ := strings.Cut(e, ":")
+			if !slices.Contains(ai.ProviderNames, name) {
+				return nil, fmt.Errorf("fan_out: %q is neither a profile nor a provider", e)
+			}
+			o := opts
+			o.Model = model
+			o.Transport = clientTransport
+			p, err = ai.NewProvider(name, o)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fan_out: %s: %w", e, err)
+		}
+		providers = append(providers, p)
+	}
+	return recordReplies(ai.NewSpread(providers, opts)), nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// fileContextMax caps how many files named in a task are described.
+	fileContextMax = 3
+	// fileContextLines and fileContextBytes cap the start of a file sent
+	// with its description, and fileContextLineBytes each of its lines.
+	fileContextLines     = 10
+	fileContextBytes     = 1024
+	fileContextLineBytes = 200
+	// fileAttachBytes caps the contents of the files a task attaches with
+	// @path, together.
+	fileAttachBytes = 32 * 1024
+)
+
+// attachRe matches a file attached to a task with @path, which has to
+// start a word so addresses such as user@host don't count.
+var attachRe = regexp.MustCompile(`(?:^|\s)@(\S+)`)
+
+// attachFiles puts the files task attaches as @path into the context, and
+// with --ctx files the start of the others it names, in place of those of
+// the previous task of the session. Attachments that can't be read are
+// reported to warn and stay in the task as written.
+func (s *session) attachFiles(task string, warn io.Writer) {
+	files := attachedFiles(task, ".", warn)
+	if s.flags.ctxOpts.Files {
+		for k, v := range referencedFiles(task, ".") {
+			if _, ok := files[k]; !ok {
+				files[k] = v
+			}
+		}
+	}
+	// Without files now or before, the context stays as it is.
+	had := false
+	for k := range s.client.Environment {
+		had = had || strings.HasPrefix(k, "file ")
+	}
+	if len(files) == 0 && !had {
+		return
+	}
+	env := maps.Clone(s.env)
+	maps.Copy(env, files)
+	redactEnvironment(env)
+	s.client.Environment = s.fitEnvironment(env)
+}
+
+// attachedFiles returns a context entry, keyed "file <path>", with the
+// contents of each file task attaches as @path, relative to dir. Together
+// they are cut to fileAttachBytes, and binary files are only described.
+func attachedFiles(task, dir string, warn io.Writer) map[string]string {
+	info := make(map[string]string)
+	budget := fileAttachBytes
+	for _, m := range attachRe.FindAllStringSubmatch(task, -1) {
+		name := trimWord(m[1])
+		if name == "" || info["file "+name] != "" {
+			continue
+		}
+		path, fi, err := statTaskPath(name, dir)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			err = errors.New("no such file")
+		case err == nil && !fi.Mode().IsRegular():
+			err = errors.New("not a regular file")
+		}
+		var data []byte
+		if err == nil {
+			data, err = readHead(path, budget+1)
+		}
+		if err != nil {
+			fmt.Fprintf(warn, "Warning: @%s: %v; it stays in the task as written\n", name, err)
+			continue
+		}
+		desc := fmt.Sprintf("%s, modified %s", formatSize(fi.Size()), fi.ModTime().Format("2006-01-02 15:04"))
+		switch {
+		case isBinary(data[:min(len(data), fileContextBytes)]):
+			info["file "+name] = desc + ", binary, not attached"
+			continue
+		case budget == 0 && len(data) > 0:
+			fmt.Fprintf(warn, "Warning: @%s: attachments are limited to %s in all; only its size is sent\n", name, formatSize(fileAttachBytes))
+			info["file "+name] = desc + ", not attached"
+			continue
+		case len(data) > budget:
+			data = append([]byte(strings.ToValidUTF8(string(data[:budget]), "")), "\n[truncated]"...)
+		}
+		budget -= min(len(data), budget)
+		info["file "+name] = desc + ", contents:\n" + redactSecrets(string(data))
+	}
+	return info
+}
+
+// referencedFiles returns a context entry, keyed "file <name>", for each
+// word of task that names an existing file relative to dir (or the home
+// directory, for ~/), such as data.csv in "convert data.csv to json". Quotes
+// and punctuation around the word are ignored.
+func referencedFiles(task, dir string) map[string]string {
+	info := make(map[string]string)
+	for _, word := range strings.Fields(task) {
+		if len(info) == fileContextMax {
+			break
+		}
+		name := trimWord(word)
+		if name == "" || strings.Contains(name, "://") || info["file "+name] != "" {
+			continue
+		}
+		if path, fi, err := statTaskPath(name, dir); err == nil && fi.Mode().IsRegular() {
+			info["file "+name] = describeFile(path, fi)
+		}
+	}
+	return info
+}
+
+// trimWord removes the quotes and punctuation around a word of a task.
+func trimWord(word string) string {
+	return strings.TrimRight(strings.Trim(word, "\"'`,;:!?()[]{}<>"), ".")
+}
+
+// statTaskPath resolves a path named in a task against dir, or the home
+// directory for ~/, and returns it with its file info.
+func statTaskPath(name, dir string) (string, os.FileInfo, error) {
+	path := name
+	if rest, ok := strings.CutPrefix(name, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil, err
+		}
+		path = filepath.Join(home, rest)
+	} else if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	fi, err := os.Stat(path)
+	return path, fi, err
+}
+
+// readHead returns up to n bytes from the start of the file at path.
+func readHead(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, int64(n)))
+}
+
+// describeFile returns the size and modification time of the file at path
+// and, unless it is binary, its first lines with secrets redacted.
+func describeFile(path string, fi os.FileInfo) string {
+	desc := fmt.Sprintf("%s, modified %s", formatSize(fi.Size()), fi.ModTime().Format("2006-01-02 15:04"))
+	head, err := readHead(path, fileContextBytes)
+	if err != nil || len(head) == 0 {
+		return desc
+	}
+	if isBinary(head) {
+		return desc + ", binary"
+	}
+	var lines []string
+	for line := range strings.Lines(strings.ToValidUTF8(string(head), "")) {
+		if len(lines) == fileContextLines {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) > fileContextLineBytes {
+			line = strings.ToValidUTF8(line[:fileContextLineBytes], "") + "…"
+		}
+		lines = append(lines, line)
+	}
+	return desc + ", starting with:\n" + redactSecrets(strings.Join(lines, "\n"))
+}
+
+// isBinary reports whether head, the start of a file, is binary rather
+// than text: it has a NUL byte, isn't UTF-8, or more than one byte in a
+// hundred is a control character other than whitespace.
+func isBinary(head []byte) bool {
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+	// The last character may have been cut off.
+	valid := head
+	for i := 0; i < utf8.UTFMax-1 && len(valid) > 0 && !utf8.Valid(valid); i++ {
+		valid = valid[:len(valid)-1]
+	}
+	if !utf8.Valid(valid) {
+		return true
+	}
+	controls := 0
+	for _, b := range head {
+		if b < 0x20 && b != '\t' && b != '\n' && b != '\r' && b != '\f' || b == 0x7f {
+			controls++
+		}
+	}
+	return controls*100 > len(head)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// runFix implements "ai fix": given a command that failed and its error
+// output, it suggests corrected commands through the usual menu. The failed
+// command comes from the arguments, with the error output piped on stdin, or
+// without arguments both are read from stdin: the first line is the command
+// and the rest its output.
+func runFix(args []string) int {
+	flags := &cliFlags{}
+	fs := newFlagSet(flags, os.Stderr)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: ai fix [flags] [failed command]")
+		fmt.Fprintln(out, "\nSuggest a corrected version of a command that failed. Pipe its error")
+		fmt.Fprintln(out, "output on stdin; without a command argument, the first line of stdin is")
+		fmt.Fprintln(out, "taken as the command.")
+		fmt.Fprintln(out, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	// Unlike a task, the failed command is taken verbatim: parsing stops at
+	// its first word so its own flags are not mistaken for ours.
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if flags.interactive || flags.agent || flags.inputFile != "" {
+		fmt.Fprintln(os.Stderr, "Error: ai fix can't be combined with --interactive, --agent or --input-file")
+		return 2
+	}
+
+	limit, err := captureLimit()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	cmd := strings.Join(fs.Args(), " ")
+	var output string
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		// Keep the end of long output: that is where the error usually is.
+		buf := newTailBuffer(limit)
+		if _, err := io.Copy(buf, os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 2
+		}
+		output = buf.String()
+		promptFromTerminal()
+		if cmd == "" {
+			cmd, output, _ = strings.Cut(strings.TrimLeft(output, "\n"), "\n")
+		}
+		output = redactSecrets(output)
+	}
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" {
+		fs.Usage()
+		return 2
+	}
+
+	s, code := newSession(flags)
+	if s == nil {
+		return code
+	}
+	task := fixTask(cmd, output)
+	if !s.checkSecrets(task) {
+		return 1
+	}
+	return s.pickAndRun(task)
+}
+
+// fixTask describes the failed command and its output as a task for the
+// usual command prompt.
+func fixTask(cmd, output string) string {
+	var b strings.Builder
+	b.WriteString("This command failed:\n")
+	b.WriteString(indent(cmd, "    "))
+	if output = strings.TrimSpace(output); output != "" {
+		b.WriteString("\nIts error output was:\n")
+		b.WriteString(indent(output, "    "))
+	} else {
+		b.WriteString("\nNo error output was provided.")
+	}
+	b.WriteString("\nSuggest a corrected command that does what it was meant to do.")
+	return b.String()
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// cliFlags holds the parsed command line of a task run.
+type cliFlags struct {
+	verbose      verbosity
+	logFile      string
+	logFormat    string
+	ignoreBudget bool
+	force        bool
+	showRedacted bool
+	compare      bool
+	explainAll   bool
+	judge        bool
+	dryRun       bool
+	yes          bool
+	choose       int
+	print        bool
+	json         bool
+	interactive  bool
+	agent        bool
+	plan         bool
+	noStream     bool
+	noCache      bool
+	deadline     time.Duration
+	numCommands  int
+	provider     string
+	model        string
+	profile      string
+	fanOut       string
+	inputFile    string
+	savedTask    string   // from -t: the task arguments are its arguments
+	notes        []string // from -c, in the context of every request
+	opts         ai.Options
+	ctxOpts      contextOptions
+	task         []string
+}
+
+// newProviderFlagSet returns a flag set for the subcommands that send one
+// kind of request and only need to pick the provider and model.
+func newProviderFlagSet(name string, c *cliFlags) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Var(&c.verbose, "v", "log timing and token usage to stderr; -vv adds HTTP requests and raw responses")
+	addLogFlags(fs, c)
+	fs.BoolVar(&noColor, "no-color", false, "don't use colors, as when NO_COLOR is set")
+	fs.StringVar(&c.provider, "provider", "", "backend to use: "+strings.Join(ai.ProviderNames, ", "))
+	fs.StringVar(&c.model, "m", "", "`model` to request instead of the provider's default")
+	fs.StringVar(&c.model, "model", "", "same as -m")
+	fs.StringVar(&c.profile, "profile", "", "config profile to use")
+	fs.BoolVar(&c.ignoreBudget, "ignore-budget", false, "run even when the token budget is used up")
+	addTimeoutFlags(fs, c)
+	return fs
+}
+
+// verbosity counts how often -v was given.
+type verbosity int
+
+func (v *verbosity) String() string { return strconv.Itoa(int(*v)) }
+
+func (v *verbosity) Set(s string) error {
+	on, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	if on {
+		*v++
+	} else {
+		*v = 0
+	}
+	return nil
+}
+
+func (v *verbosity) IsBoolFlag() bool { return true }
+
+// addLogFlags adds --log-file and --log-format, which send the log that -v
+// enables elsewhere or in another format.
+func addLogFlags(fs *flag.FlagSet, c *cliFlags) {
+	fs.StringVar(&c.logFile, "log-file", "", "append the log to `file` instead of stderr, at -v level unless -vv is given")
+	c.logFormat = "text"
+	fs.Func("log-format", "log `format`: text (the default) or json, one object per line", func(s string) error {
+		if s != "text" && s != "json" {
+			return fmt.Errorf("must be text or json")
+		}
+		c.logFormat = s
+		return nil
+	})
+}
+
+// addTimeoutFlags adds --timeout, which bounds each HTTP request, and
+// --deadline, which bounds everything a request to the model takes,
+// including retries and concurrent calls.
+func addTimeoutFlags(fs *flag.FlagSet, c *cliFlags) {
+	duration := func(dst *time.Duration) func(string) error {
+		return func(s string) error {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("requires a positive duration such as 45s")
+			}
+			*dst = d
+			return nil
+		}
+	}
+	fs.Func("timeout", "give up on a single HTTP request after `duration` (default 30s, 2m for ollama)", duration(&c.opts.Timeout))
+	fs.Func("deadline", "give up on the model after `duration` in total, including retries and concurrent calls", duration(&c.deadline))
+}
+
+// combinedShortRe matches a cluster of single-letter flags such as -vn.
+var combinedShortRe = regexp.MustCompile(`^-[A-Za-z]{2,}$`)
+
+func newFlagSet(c *cliFlags, output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("ai", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Var(&c.verbose, "v", "log timing, token usage and each API call to stderr; -vv adds HTTP requests and raw responses")
+	addLogFlags(fs, c)
+	c.numCommands = 3
+	fs.Func("n", "number of suggestions to generate (default 3)", func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return fmt.Errorf("requires a positive integer")
+		}
+		c.numCommands = n
+		return nil
+	})
+	fs.StringVar(&c.inputFile, "f", "", "read the task from `file`")
+	fs.StringVar(&c.inputFile, "input-file", "", "same as -f `file`")
+	fs.StringVar(&c.savedTask, "t", "", "run the saved task `name` from the tasks table of the config, with the task arguments filled in")
+	fs.StringVar(&c.savedTask, "task", "", "same as -t `name`")
+	fs.StringVar(&c.provider, "provider", "", "backend to use: "+strings.Join(ai.ProviderNames, ", "))
+	fs.StringVar(&c.model, "m", "", "`model` to request instead of the provider's default")
+	fs.StringVar(&c.model, "model", "", "same as -m")
+	fs.StringVar(&c.profile, "profile", "", "config profile to use")
+	fs.StringVar(&c.fanOut, "fan-out", "", "spread the calls for -n over a comma-separated `list` of profiles or provider[:model]")
+	fs.BoolVar(&c.ignoreBudget, "ignore-budget", false, "run even when the token budget is used up")
+	addTimeoutFlags(fs, c)
+	fs.BoolVar(&c.opts.Tools, "tools", false, "let the model list directories before answering")
+	fs.Func("seed", "sampling seed for reproducible output", func(s string) error {
+		seed, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("requires an integer")
+		}
+		c.opts.Seed = &seed
+		return nil
+	})
+	fs.Func("enough", "stop waiting for further calls once `k` unique suggestions have arrived (default: -n)", func(s string) error {
+		k, err := strconv.Atoi(s)
+		if err != nil || k < 1 {
+			return fmt.Errorf("requires a positive integer")
+		}
+		c.opts.Enough = k
+		return nil
+	})
+	fs.Func("soft-deadline", "after `duration` (e.g. 3s), stop waiting for further calls once some suggestions have arrived", func(s string) error {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("requires a positive duration such as 3s")
+		}
+		c.opts.SoftDeadline = d
+		return nil
+	})
+	fs.BoolVar(&c.ctxOpts.Aliases, "include-aliases", false, "tell the model about your shell aliases and functions")
+	fs.BoolVar(&c.ctxOpts.History, "learn-from-history", false, "tell the model which tools you use most")
+	fs.Func("ctx", "add optional context, a comma-separated `list` of: dir (the files here), git (the repository's state), files (the start of files the task names), recent (the last commands you ran; recent:n for n of them), aliases, history", func(s string) error {
+		return c.ctxOpts.enable(strings.Split(s, ","))
+	})
+	notes := func(s string) error {
+		if s = strings.TrimSpace(s); s == "" {
+			return fmt.Errorf("requires some text")
+		}
+		c.notes = append(c.notes, s)
+		return nil
+	}
+	fs.Func("c", "add `text` about your setup to the context of this run, such as \"we use poetry and postgres 16\"; may be repeated", notes)
+	fs.Func("context", "same as -c `text`", notes)
+	fs.BoolVar(&c.force, "force", false, "send the task even if it looks like it contains a secret")
+	fs.BoolVar(&c.showRedacted, "show-redacted", false, "print the context that would be sent, with secrets redacted, and exit without asking the model")
+	fs.BoolVar(&c.yes, "y", false, "run the top suggestion without showing the menu (safety prompts still apply)")
+	fs.BoolVar(&c.yes, "yes", false, "same as -y")
+	fs.Func("choose", "use suggestion `n` without showing the menu, for scripts and cron jobs (safety prompts still apply)", func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return fmt.Errorf("requires a positive integer")
+		}
+		c.choose = n
+		return nil
+	})
+	fs.BoolVar(&c.interactive, "i", false, "start an interactive session where each task builds on the previous ones")
+	fs.BoolVar(&c.interactive, "interactive", false, "same as -i")
+	fs.BoolVar(&c.agent, "agent", false, "run step by step, feeding each command's output back until the task is done")
+	fs.BoolVar(&c.plan, "plan", false, "break the task into steps and run them one by one, each after confirmation")
+	fs.BoolVar(&c.print, "print", false, "write only the chosen command to stdout instead of running it, for eval")
+	fs.BoolVar(&c.json, "json", false, "write a JSON report of the suggestions, the command run and its outcome to stdout")
+	fs.BoolVar(&c.dryRun, "dry-run", false, "print all suggestions, one per line, without running anything (exit status 3)")
+	fs.BoolVar(&c.compare, "compare", false, "show suggestions side by side with differences highlighted")
+	fs.BoolVar(&c.noCache, "no-cache", false, "ask the model even if the same request was answered within the last hour")
+	fs.BoolVar(&noColor, "no-color", false, "don't use colors, as when NO_COLOR is set")
+	fs.BoolVar(&c.noStream, "no-stream", false, "wait for complete replies instead of showing the command as it is generated")
+	fs.BoolVar(&c.judge, "judge", false, "have the model rank the suggestions by fitness and safety before showing them (one extra API call)")
+	fs.BoolVar(&c.explainAll, "explain-all", false, "show a one-line explanation under each suggestion (one extra API call)")
+	fs.Usage = func() {
+		_, _ = fmt.Fprint(fs.Output(), `Usage: ai [run] [flags] <task description>
+       ai [run] [flags] -- <task starting with a dash>
+       ai <command> [args]
+
+Commands:
+`)
+		printCommands(fs.Output())
+		_, _ = fmt.Fprint(fs.Output(), `
+Examples:
+  ai find biggest file here
+  ai -v list files in current dir
+  ai -n 5 find files here
+  ai -f task.txt
+  ai run config nginx as a reverse proxy
+
+Flags can come before or after the task; "--" ends flag parsing.
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args (without the program name). Flags may be mixed with
+// the task words, single-letter bool flags may be combined (-vn 5), and "--"
+// makes everything after it part of the task. Once the task has started,
+// dash-prefixed words that aren't flags (say, "ls -la") are kept as task
+// text. It returns flag.ErrHelp for -h and --help.
+func parseFlags(args []string, output io.Writer) (*cliFlags, error) {
+	c := &cliFlags{}
+	fs := newFlagSet(c, output)
+
+	rest := args
+	for len(rest) > 0 {
+		arg := rest[0]
+		if arg == "--" {
+			c.task = append(c.task, rest[1:]...)
+			break
+		}
+		if expanded, ok := expandShortFlags(fs, arg); ok {
+			rest = append(expanded, rest[1:]...)
+			continue
+		}
+		name, isFlag := flagName(arg)
+		f := fs.Lookup(name)
+		if !isFlag || (len(c.task) > 0 && f == nil) {
+			c.task = append(c.task, arg)
+			rest = rest[1:]
+			continue
+		}
+		// Hand the flag package one flag at a time so parsing resumes after
+		// task words instead of stopping at the first one.
+		n := 1
+		if f != nil && !isBoolFlag(f) && !strings.Contains(arg, "=") {
+			n = min(2, len(rest))
+		}
+		if err := fs.Parse(rest[:n]); err != nil {
+			return nil, err
+		}
+		rest = rest[n:]
+	}
+	return c, nil
+}
+
+// flagName returns the name of a flag argument such as -v, --model or
+// --seed=4, and whether arg looks like a flag at all.
+func flagName(arg string) (string, bool) {
+	if len(arg) < 2 || arg[0] != '-' {
+		return "", false
+	}
+	name := strings.TrimPrefix(arg[1:], "-")
+	name, _, _ = strings.Cut(name, "=")
+	return name, name != ""
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// expandShortFlags splits a cluster like -vn into -v -n when every letter is
+// a single-letter flag and only the last one takes a value.
+func expandShortFlags(fs *flag.FlagSet, arg string) ([]string, bool) {
+	if !combinedShortRe.MatchString(arg) || fs.Lookup(arg[1:]) != nil {
+		return nil, false
+	}
+	letters := arg[1:]
+	expanded := make([]string, 0, len(letters))
+	for i, r := range letters {
+		f := fs.Lookup(string(r))
+		if f == nil || (i < len(letters)-1 && !isBoolFlag(f)) {
+			return nil, false
+		}
+		expanded = append(expanded, "-"+string(r))
+	}
+	return expanded, true
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gitContextTimeout bounds each git command run for --ctx git.
+const gitContextTimeout = 2 * time.Second
+
+// gatherGitContext describes the git repository dir is in for --ctx git:
+// the branch and how it compares with its upstream, the staged, modified
+// and untracked files and any merge or rebase in progress, the last commit
+// and the remotes. Outside a repository, or without git, it returns nothing.
+func gatherGitContext(dir string) map[string]string {
+	status, err := gitIn(dir, "status", "--porcelain=v2", "--branch")
+	if err != nil {
+		return nil
+	}
+	info := map[string]string{}
+	var head, upstream, ab string
+	var staged, modified, untracked, conflicts int
+	for line := range strings.Lines(status) {
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "# branch.head "):
+			head = strings.TrimPrefix(line, "# branch.head ")
+		case strings.HasPrefix(line, "# branch.upstream "):
+			upstream = strings.TrimPrefix(line, "# branch.upstream ")
+		case strings.HasPrefix(line, "# branch.ab "):
+			ab = strings.TrimPrefix(line, "# branch.ab ")
+		case strings.HasPrefix(line, "? "):
+			untracked++
+		case strings.HasPrefix(line, "u "):
+			conflicts++
+		case strings.HasPrefix(line, "1 "), strings.HasPrefix(line, "2 "):
+			// The second field holds the staged and the worktree state.
+			if len(line) >= 4 {
+				if line[2] != '.' {
+					staged++
+				}
+				if line[3] != '.' {
+					modified++
+				}
+			}
+		}
+	}
+
+	branch := head
+	if head == "(detached)" {
+		branch = "detached HEAD"
+	}
+	if upstream != "" {
+		var ahead, behind int
+		fmt.Sscanf(ab, "+%d -%d", &ahead, &behind)
+		branch += fmt.Sprintf(" (tracking %s, %d ahead, %d behind)", upstream, ahead, behind)
+	} else if head != "(detached)" {
+		branch += " (no upstream)"
+	}
+	info["git_branch"] = branch
+
+	var state []string
+	for _, c := range []struct {
+		n    int
+		what string
+	}{{staged, "staged"}, {modified, "modified"}, {untracked, "untracked"}, {conflicts, "conflicted"}} {
+		if c.n > 0 {
+			state = append(state, fmt.Sprintf("%d %s", c.n, c.what))
+		}
+	}
+	if op := gitOperation(dir); op != "" {
+		state = append(state, op+" in progress")
+	}
+	if len(state) == 0 {
+		state = []string{"clean"}
+	}
+	info["git_status"] = strings.Join(state, ", ")
+
+	if last, err := gitIn(dir, "log", "-1", "--format=%h %s"); err == nil {
+		info["git_last_commit"] = redactSecrets(strings.TrimSpace(last))
+	}
+	if remotes, err := gitIn(dir, "remote", "-v"); err == nil {
+		var list []string
+		for line := range strings.Lines(remotes) {
+			fields := strings.Fields(line)
+			if len(fields) == 3 && fields[2] == "(fetch)" {
+				list = append(list, fields[0]+" "+withoutCredentials(fields[1]))
+			}
+		}
+		if len(list) > 0 {
+			info["git_remotes"] = redactSecrets(strings.Join(list, ", "))
+		}
+	}
+	return info
+}
+
+// gitOperation names the merge, rebase, cherry-pick, revert or bisect
+// under way in the repository dir is in, or returns "".
+func gitOperation(dir string) string {
+	gitDir, err := gitIn(dir, "rev-parse", "--git-dir")
+	if err != nil {
+		return ""
+	}
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(dir, gitDir)
+	}
+	for _, op := range []struct{ file, name string }{
+		{"rebase-merge", "rebase"},
+		{"rebase-apply", "rebase"},
+		{"MERGE_HEAD", "merge"},
+		{"CHERRY_PICK_HEAD", "cherry-pick"},
+		{"REVERT_HEAD", "revert"},
+		{"BISECT_LOG", "bisect"},
+	} {
+		if _, err := os.Stat(filepath.Join(gitDir, op.file)); err == nil {
+			return op.name
+		}
+	}
+	return ""
+}
+
+// withoutCredentials removes the credentials from a remote URL: a password,
+// and the user of an http(s) URL, which may be a token. The user of an ssh
+// URL, such as git@, stays.
+func withoutCredentials(remote string) string {
+	u, err := url.Parse(remote)
+	if err != nil || u.User == nil {
+		return remote
+	}
+	if _, ok := u.User.Password(); ok || u.Scheme == "http" || u.Scheme == "https" {
+		u.User = nil
+	}
+	return u.String()
+}
+
+// gitIn runs git with args in dir and returns its stdout.
+func gitIn(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), gitContextTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -1,3 +1,9 @@
 module github.com/brainexe/ai
 
-go 1.26
+go 1.26.0
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	golang.org/x/sys v0.48.0
+	golang.org/x/term v0.46.0
+)
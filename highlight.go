@@ -0,0 +1,57 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	ansiProgram  = "\033[1;36m" // bold cyan
+	ansiFlag     = "\033[36m"   // cyan
+	ansiOperator = "\033[35m"   // magenta
+)
+
+var (
+	// commandTokenRe splits a command into placeholders, quoted strings,
+	// operators and words for highlighting; whatever it skips is spacing.
+	commandTokenRe = regexp.MustCompile(`<[A-Z][A-Z0-9_]*>|"(?:[^"\\]|\\.)*"?|'[^']*'?|\|\||&&|[0-9]*>>?|[|;&<()\n]|[^\s|&;<>()'"]+`)
+	// assignmentRe matches a variable assignment before the program name.
+	assignmentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+)
+
+// highlightCommand colors a suggested command for the menu: the program of
+// each pipeline stage in bold, its flags, quoted strings, the pipes,
+// separators and redirections between stages, and placeholders such as
+// <FILE> that are filled in before the command runs.
+func highlightCommand(cmd string, color bool) string {
+	if !color {
+		return cmd
+	}
+	program := true // the next word names the program to run
+	return commandTokenRe.ReplaceAllStringFunc(cmd, func(tok string) string {
+		switch {
+		case strings.HasPrefix(tok, "<") && len(tok) > 1:
+			program = false
+			return paint(tok, ansiDiff, color)
+		case strings.HasPrefix(tok, `"`), strings.HasPrefix(tok, "'"):
+			program = false
+			return paint(tok, ansiString, color)
+		case tok == "\n":
+			program = true
+			return tok
+		case tok == "|" || tok == "||" || tok == "&&" || tok == ";" || tok == "&" || tok == "(":
+			program = true
+			return paint(tok, ansiOperator, color)
+		case tok == "<" || tok == ")" || strings.HasSuffix(tok, ">"):
+			return paint(tok, ansiOperator, color)
+		case program && assignmentRe.MatchString(tok):
+			return tok
+		case program:
+			program = false
+			return paint(tok, ansiProgram, color)
+		case strings.HasPrefix(tok, "-") && tok != "-" && tok != "--":
+			return paint(tok, ansiFlag, color)
+		}
+		return tok
+	})
+}
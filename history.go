@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	historyFileName = "history.jsonl"
+	// historyLimit bounds how many entries are kept; older ones are dropped.
+	historyLimit = 1000
+)
+
+// historyEntry is a command picked for a task, kept so it can be found and
+// run again without asking the model.
+type historyEntry struct {
+	ID       int       `json:"id"`
+	Time     time.Time `json:"time"`
+	Cwd      string    `json:"cwd"`
+	Task     string    `json:"task"`
+	Command  string    `json:"command"`
+	ExitCode *int      `json:"exit_code,omitempty"` // nil when the command wasn't run
+}
+
+func historyFilePath() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, historyFileName), nil
+}
+
+// loadHistory reads the history, oldest first; a missing file yields none.
+func loadHistory() ([]historyEntry, error) {
+	path, err := historyFilePath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		var e historyEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return entries, fmt.Errorf("parse %s:%d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// addHistory appends e to the history, numbering it after the newest entry.
+// Once historyLimit is reached the file is rewritten without the oldest.
+func addHistory(e historyEntry) error {
+	path, err := historyFilePath()
+	if err != nil {
+		return err
+	}
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	e.ID = 1
+	if len(entries) > 0 {
+		e.ID = entries[len(entries)-1].ID + 1
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	if len(entries) < historyLimit {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return err
+		}
+		if err := writeHistory(f, e); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := writeHistory(f, append(entries[len(entries)-historyLimit+1:], e)...); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func writeHistory(w io.Writer, entries ...historyEntry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remember adds cmd, picked for task, to the history unless it is turned
+// off. code is the exit code, or nil when the command wasn't run.
+func (s *session) remember(task, cmd string, code *int) {
+	if !s.cfg.keepHistory() {
+		return
+	}
+	cwd, _ := os.Getwd()
+	err := addHistory(historyEntry{Time: time.Now(), Cwd: cwd, Task: task, Command: cmd, ExitCode: code})
+	if err != nil {
+		s.log.Warn("could not save history", "error", err)
+	}
+}
+
+// runHistory implements `ai history`: it lists the commands picked before,
+// or with `ai history search <query>` only those matching the query, and
+// `ai history run <id>` runs one of them again.
+func runHistory(args []string) int {
+	fs := flag.NewFlagSet("ai history", flag.ContinueOnError)
+	limit := fs.Int("n", 20, "show at most `count` entries, the newest ones")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: ai history [flags] [search <query>]")
+		fmt.Fprintln(out, "       ai history run <id>")
+		fmt.Fprintln(out, "\nList the commands picked for earlier tasks, or only those whose task or")
+		fmt.Fprintln(out, "command contains every word of the query, and run one again by its id.")
+		fmt.Fprintln(out, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if len(args) > 0 && args[0] == "run" {
+		if len(args) != 2 {
+			fs.Usage()
+			return 2
+		}
+		return rerunHistory(args[1])
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	query := fs.Args()
+	if len(query) > 0 {
+		// A bare query would read as a task, as in "ai history of this
+		// file", so searching takes a word of its own.
+		if query[0] != "search" || len(query) == 1 {
+			fs.Usage()
+			return 2
+		}
+		query = query[1:]
+	}
+
+	entries, err := loadHistory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	matches := searchHistory(entries, strings.Join(query, " "))
+	if len(matches) == 0 {
+		fmt.Fprintln(os.Stderr, "No matching history.")
+		return 1
+	}
+	printHistory(os.Stdout, matches[max(len(matches)-*limit, 0):], colorEnabled(os.Stdout))
+	return 0
+}
+
+// searchHistory returns the entries whose task or command contains every
+// word of query, ignoring case. An empty query matches everything.
+func searchHistory(entries []historyEntry, query string) []historyEntry {
+	words := strings.Fields(strings.ToLower(query))
+	var matches []historyEntry
+	for _, e := range entries {
+		text := strings.ToLower(e.Task + "\n" + e.Command)
+		found := true
+		for _, w := range words {
+			if !strings.Contains(text, w) {
+				found = false
+				break
+			}
+		}
+		if found {
+			matches = append(matches, e)
+		}
+	}
+	return matches
+}
+
+// printHistory lists entries oldest first, each command under its id and
+// date with the first line of its task dimmed after it. A multi-line
+// command shows its first line.
+func printHistory(w io.Writer, entries []historyEntry, color bool) {
+	for _, e := range entries {
+		task, _, _ := strings.Cut(e.Task, "\n")
+		cmd := e.Command
+		if first, _, ok := strings.Cut(cmd, "\n"); ok {
+			cmd = first + " …"
+		}
+		fmt.Fprintf(w, "%5d  %s  %s  %s\n", e.ID, e.Time.Local().Format("2006-01-02 15:04"), cmd, paint("# "+task, ansiDim, color))
+	}
+}
+
+// rerunHistory runs the command of the history entry with the given id,
+// after the usual safety checks, and returns its exit code.
+func rerunHistory(id string) int {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %q is not a history id\n", id)
+		return 2
+	}
+	entries, err := loadHistory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	var e *historyEntry
+	for i := range entries {
+		if entries[i].ID == n {
+			e = &entries[i]
+		}
+	}
+	if e == nil {
+		fmt.Fprintf(os.Stderr, "Error: no history entry %d\n", n)
+		return 1
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	flags := &cliFlags{}
+	log, err := newLogger(flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	s := &session{flags: flags, cfg: cfg, ui: os.Stdout, log: log}
+	if path := auditLogPath(cfg); path != "" {
+		if s.auditLog, err = openAuditLog(path); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 2
+		}
+	}
+	rec := auditRecord{Mode: "history", Task: e.Task, Command: e.Command}
+	if !s.confirmRun(e.Command) {
+		s.audit(rec)
+		return 1
+	}
+	fmt.Println(e.Command)
+	code := s.auditRun(rec, func() int {
+		if err := runCommand(e.Command); err != nil {
+			return exitCode(err)
+		}
+		return 0
+	})
+	s.remember(e.Task, e.Command, &code)
+	s.addToShellHistory(e.Command)
+	return code
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// bashInit binds a readline function that replaces the current line with
+// the command picked for it, like the zsh widget.
+const bashInit = `# ai shell integration for bash; load it with eval "$(ai init bash)"
+_ai_insert_suggestion() {
+  [[ -n $READLINE_LINE ]] || return 0
+  local cmd
+  cmd=$(command ai --print -- "$READLINE_LINE" </dev/tty 2>/dev/tty)
+  if [[ $? -eq 0 && -n $cmd ]]; then
+    READLINE_LINE=$cmd
+    READLINE_POINT=${#READLINE_LINE}
+  fi
+}
+bind -x '"\C-xa": _ai_insert_suggestion'
+`
+
+// fishInit binds a function that replaces the command line with the command
+// picked for it, like the zsh widget.
+const fishInit = `# ai shell integration for fish; load it with ai init fish | source
+function _ai_insert_suggestion
+    set -l task (commandline | string collect)
+    test -n "$task"; or return
+    set -l cmd (command ai --print -- "$task" </dev/tty 2>/dev/tty | string collect)
+    if test -n "$cmd"
+        commandline --replace -- $cmd
+        commandline --cursor (string length -- $cmd)
+    end
+    commandline -f repaint
+end
+bind \cxa _ai_insert_suggestion
+`
+
+// zshInit defines a line-editor widget that sends the current buffer to
+// `ai --print` as the task and puts the picked command in its place, to be
+// reviewed and run with Enter. The menu talks to the terminal directly
+// because the widget's own stdin and stderr may not be the terminal.
+const zshInit = `# ai shell integration for zsh; load it with eval "$(ai init zsh)"
+_ai_insert_suggestion() {
+  [[ -n $BUFFER ]] || return 0
+  local cmd
+  zle -I
+  cmd=$(command ai --print -- "$BUFFER" </dev/tty 2>/dev/tty)
+  if [[ $? -eq 0 && -n $cmd ]]; then
+    BUFFER=$cmd
+    CURSOR=${#BUFFER}
+  fi
+  zle reset-prompt
+}
+zle -N _ai_insert_suggestion
+bindkey '^Xa' _ai_insert_suggestion
+`
+
+// shellInits maps each shell `ai init` supports to its integration script.
+var shellInits = map[string]string{
+	"bash": bashInit,
+	"fish": fishInit,
+	"zsh":  zshInit,
+}
+
+// initShells returns the shells `ai init` and `ai completion` support.
+func initShells() []string {
+	return slices.Sorted(maps.Keys(shellInits))
+}
+
+// runInit implements `ai init <shell>`: it prints the shell integration
+// script for the shell's rc file to evaluate.
+func runInit(args []string) int {
+	shells := initShells()
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: ai init <%s>\n", strings.Join(shells, "|"))
+		return 2
+	}
+	script, ok := shellInits[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: no integration for %q; supported shells: %s\n", args[0], strings.Join(shells, ", "))
+		return 2
+	}
+	fmt.Print(script)
+	return 0
+}
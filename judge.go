@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// judgeNumberRe matches the suggestion numbers of a judge's ranking line.
+var judgeNumberRe = regexp.MustCompile(`\d+`)
+
+// judge asks the model which of cmds, suggested for task, does the task
+// best and most safely, and returns them in the order it ranks them. Its
+// reasoning is logged at -v. Commands the ranking leaves out keep their
+// order after the ranked ones, commands using programs that aren't
+// installed still come last, and when the request fails cmds are returned
+// as they were.
+func (s *session) judge(task string, cmds []string) []string {
+	if len(cmds) < 2 {
+		return cmds
+	}
+	var b strings.Builder
+	b.WriteString("Rank the numbered shell commands below, suggested for the task, from best to worst.\n")
+	b.WriteString("The best command does exactly what the task asks, correctly, and is the safest to run: prefer commands that change or delete less, and that fail rather than do damage on unexpected input.\n")
+	b.WriteString("On the first line, answer with the command numbers in ranked order, such as \"2, 1, 3\", and nothing else. Then explain the ranking in at most three short lines.\n")
+	b.WriteString("\nTask:\n" + task + "\n\nCommands:\n")
+	for i, cmd := range cmds {
+		fmt.Fprintf(&b, "%d. %s\n", i+1, cmd)
+	}
+	reply, ok := s.complete(b.String())
+	if !ok {
+		return cmds
+	}
+	first, reasoning, _ := strings.Cut(reply, "\n")
+	var ranked []string
+	for _, m := range judgeNumberRe.FindAllString(first, -1) {
+		if i, _ := strconv.Atoi(m); i >= 1 && i <= len(cmds) && !slices.Contains(ranked, cmds[i-1]) {
+			ranked = append(ranked, cmds[i-1])
+		}
+	}
+	if len(ranked) == 0 {
+		s.log.Warn("judge reply has no ranking", "reply", reply)
+		return cmds
+	}
+	for _, cmd := range cmds {
+		if !slices.Contains(ranked, cmd) {
+			ranked = append(ranked, cmd)
+		}
+	}
+	s.log.Info("suggestions judged", "ranking", strings.TrimSpace(first), "reasoning", strings.Join(strings.Fields(reasoning), " "))
+	return demoteMissing(ranked)
+}
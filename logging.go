@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// newLogger returns the logger selected by -v, --log-file and --log-format.
+// -v logs a summary of each request and API call at info level, -vv adds
+// the debug details: every HTTP exchange, the suggestions and the raw
+// responses. A log file gets the info level even without -v. With neither,
+// nothing is logged.
+func newLogger(c *cliFlags) (*slog.Logger, error) {
+	level := slog.LevelInfo
+	if c.verbose > 1 {
+		level = slog.LevelDebug
+	}
+	var w io.Writer = os.Stderr
+	switch {
+	case c.logFile != "":
+		f, err := os.OpenFile(c.logFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("log file: %w", err)
+		}
+		w = f
+	case c.verbose == 0:
+		return slog.New(slog.DiscardHandler), nil
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if c.logFormat == "json" {
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(w, opts)), nil
+}
+
+// logsToTerminal reports whether log lines go to stderr, where they would
+// garble a menu that redraws itself.
+func (s *session) logsToTerminal() bool {
+	return s.flags.verbose > 0 && s.flags.logFile == ""
+}
+
+// logResults logs the combined outcome of the calls of a request for
+// suggestions; the calls log themselves as they finish.
+func (s *session) logResults(results []ai.Result) {
+	if len(results) == 0 {
+		return
+	}
+	combined, calls := results[0], results[1:]
+	usd, known := callsCost(calls)
+	s.log.Info("suggestions generated", "commands", len(combined.Commands), "model", combined.Model, "calls", len(calls),
+		"elapsed", combined.Duration, "input_tokens", combined.Usage.InputTokens, "output_tokens", combined.Usage.OutputTokens,
+		"cost", describeCost(usd, known), "budget", s.budget.describe(s.ledger, time.Now()))
+	sources := newCommandSources()
+	for _, r := range calls {
+		sources.add(r)
+	}
+	for i, cmd := range combined.Commands {
+		s.log.Info("suggestion", "n", i+1, "command", cmd, "models", strings.Join(sources.of(cmd), ", "))
+	}
+}
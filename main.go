@@ -2,468 +2,180 @@ package main
 
 import (
 	"bufio"
-	"bytes"
-	"context"
-	"encoding/json"
-	"errors"
+	"cmp"
 	"fmt"
 	"io"
-	"net/http"
+	"maps"
 	"os"
 	"os/exec"
-	"regexp"
-	"runtime"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
-)
 
-const (
-	openAIEndpoint = "https://api.openai.com/v1/responses"
-	modelName      = "gpt-5.4"
+	"github.com/brainexe/ai/pkg/ai"
 )
 
-type responseReq struct {
-	Model     string         `json:"model"`
-	Input     string         `json:"input"`
-	MaxOutput int            `json:"max_output_tokens,omitempty"`
-	Text      map[string]any `json:"text,omitempty"`
-	Reasoning map[string]any `json:"reasoning,omitempty"`
-}
-
-type responseResp struct {
-	ID         string       `json:"id"`
-	Object     string       `json:"object"`
-	Created    int64        `json:"created"`
-	Model      string       `json:"model"`
-	Output     []outputItem `json:"output,omitempty"`
-	OutputText string       `json:"output_text,omitempty"`
-	Candidates []candidate  `json:"candidates,omitempty"`
-}
-
-type outputItem struct {
-	Type    string        `json:"type,omitempty"`
-	Text    string        `json:"text,omitempty"`
-	Content []contentPart `json:"content,omitempty"`
-	Role    string        `json:"role,omitempty"`
-}
-
-type contentPart struct {
-	Type string `json:"type,omitempty"`
-	Text string `json:"text,omitempty"`
-}
-
-type candidate struct {
-	Content candidateContent `json:"content"`
-}
-
-type candidateContent struct {
-	Type  string          `json:"type,omitempty"`
-	Parts []candidatePart `json:"parts,omitempty"`
-}
-
-type candidatePart struct {
-	Type string `json:"type,omitempty"`
-	Text string `json:"text,omitempty"`
-}
-
-type apiCallResult struct {
-	Commands    []string        `json:"commands"`
-	Duration    time.Duration   `json:"duration"`
-	RawResponse json.RawMessage `json:"raw_response"`
-	Error       error           `json:"error,omitempty"`
-}
-
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: ai [-v] [-n <number>] <task description>\nExample: ai find biggest file here\n       ai -v list files in current dir\n       ai -n 5 find files here")
-		os.Exit(2)
+	code := dispatch(os.Args[1:])
+	if interrupted.Load() {
+		code = exitInterrupted
 	}
+	os.Exit(code)
+}
 
-	// Parse flags
-	var verbose bool
-	var numCommands = 3 // default
-	var taskStart = 1
-
-argLoop:
-	for i := 1; i < len(os.Args); i++ {
-		switch os.Args[i] {
-		case "-v":
-			verbose = true
-			taskStart = i + 1
-		case "-n":
-			if i+1 >= len(os.Args) {
-				fmt.Fprintln(os.Stderr, "Error: -n requires a number argument")
-				os.Exit(2)
-			}
-			var err error
-			numCommands, err = strconv.Atoi(os.Args[i+1])
-			if err != nil || numCommands < 1 {
-				fmt.Fprintln(os.Stderr, "Error: -n requires a positive integer")
-				os.Exit(2)
+// readTaskFile reads a task description from path for use verbatim in the prompt.
+func readTaskFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read input file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// contextOptions selects the optional, opt-in parts of the environment context.
+type contextOptions struct {
+	Aliases bool // include alias and function names from the interactive shell
+	History bool // include the most used tool names from the shell history
+	Dir     bool // include a listing of the working directory
+	Git     bool // include the branch, state and remotes of the git repository
+	Files   bool // include the start of the files the task names
+	Recent  int  // include this many of the last commands from the shell history
+}
+
+// enable turns on the optional parts of the context named in parts, as
+// --ctx and the context key list them: dir, git, files, recent (or
+// recent:n), aliases and history.
+func (o *contextOptions) enable(parts []string) error {
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if n, ok := strings.CutPrefix(part, "recent:"); ok {
+			count, err := strconv.Atoi(n)
+			if err != nil || count < 1 || count > maxRecentCommands {
+				return fmt.Errorf("recent:%s: want a count from 1 to %d", n, maxRecentCommands)
 			}
-			i++ // skip the number argument
-			taskStart = i + 1
-		default:
-			taskStart = i
-			break argLoop
+			o.Recent = count
+			continue
 		}
-	}
-
-	if taskStart >= len(os.Args) {
-		fmt.Fprintln(os.Stderr, "Usage: ai [-v] [-n <number>] <task description>")
-		os.Exit(2)
-	}
-
-	token := os.Getenv("OPENAI_TOKEN")
-	if token == "" {
-		fmt.Fprintln(os.Stderr, "Error: OPENAI_TOKEN not set")
-		os.Exit(2)
-	}
-
-	task := strings.Join(os.Args[taskStart:], " ")
-
-	contextInfo := gatherContext()
-	prompt := buildPrompt(task, contextInfo)
-
-	results, err := getCommands(context.Background(), token, prompt, numCommands)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "API error:", err)
-		os.Exit(1)
-	}
-	if len(results) == 0 || len(results[0].Commands) == 0 {
-		fmt.Fprintln(os.Stderr, "No commands generated")
-		os.Exit(1)
-	}
-
-	// Show verbose output if requested
-	if verbose {
-		printVerboseOutput(results)
-	}
-
-	// Use the first result (combined/aggregated) for command selection
-	choice, err := selectCommand(results[0].Commands)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Selection error:", err)
-		os.Exit(1)
-	}
-
-	// Echo the command for transparency
-	fmt.Println(choice)
-
-	// Execute with inherited stdio so it behaves like calling directly
-	if err := runCommand(choice); err != nil {
-		var exitErr *exec.ExitError
-		if errors.As(err, &exitErr) {
-			os.Exit(exitErr.ExitCode())
+		switch part {
+		case "dir":
+			o.Dir = true
+		case "git":
+			o.Git = true
+		case "files":
+			o.Files = true
+		case "recent":
+			o.Recent = cmp.Or(o.Recent, defaultRecentCommands)
+		case "aliases":
+			o.Aliases = true
+		case "history":
+			o.History = true
+		case "":
+		default:
+			return fmt.Errorf("unknown context %q (want dir, git, files, recent, aliases or history)", part)
 		}
-		fmt.Fprintln(os.Stderr, "Execution error:", err)
-		os.Exit(1)
 	}
+	return nil
 }
 
-func printVerboseOutput(results []apiCallResult) {
-	if len(results) == 0 {
-		return
-	}
-
-	combinedResult := results[0]     // First result is the combined/aggregated result
-	individualResults := results[1:] // Rest are individual API call results
-
-	fmt.Println("=== VERBOSE OUTPUT ===")
-	fmt.Printf("Commands generated: %d\n", len(combinedResult.Commands))
-
-	// Show timing information
-	fmt.Printf("Elapsed time: %v\n", combinedResult.Duration)
-	if len(individualResults) > 0 {
-		fmt.Printf("Concurrent API calls: %d\n", len(individualResults))
+// gatherContext returns the environment context for prompts: what
+// ai.Environment reports with the target shell, which well-known tools are
+// installed and which aren't, and the opt-in parts selected by opts.
+func gatherContext(opts contextOptions) map[string]string {
+	info := ai.Environment()
+	info["shell"] = targetShell()
+	inv := takeToolInventory(time.Now())
+	info["tools_installed"] = strings.Join(inv.Installed, ", ")
+	info["tools_not_installed"] = strings.Join(inv.Missing, ", ")
+	if opts.Aliases {
+		info["shell_aliases"], info["shell_functions"] = gatherShellNames(info["shell"])
 	}
-
-	// Show the generated commands
-	fmt.Println("\nGenerated commands:")
-	for i, cmd := range combinedResult.Commands {
-		fmt.Printf("  %d) %s\n", i+1, cmd)
+	if opts.History {
+		info["frequently_used_tools"] = gatherHistoryTools(info["shell"])
 	}
-
-	// Show raw API responses from individual calls if available
-	rawResponses := 0
-	for i, r := range individualResults {
-		if len(r.RawResponse) > 0 {
-			rawResponses++
-			fmt.Printf("\nAPI Call %d Response (pretty-printed):\n", i+1)
-			var prettyJSON bytes.Buffer
-			if err := json.Indent(&prettyJSON, r.RawResponse, "", "  "); err == nil {
-				fmt.Println(prettyJSON.String())
-			} else {
-				fmt.Println(string(r.RawResponse))
-			}
-		}
+	if opts.Recent > 0 {
+		info["recent_commands"] = gatherRecentCommands(info["shell"], opts.Recent)
 	}
-
-	if rawResponses == 0 {
-		fmt.Println("\nNote: Raw API responses not captured (may be due to error or non-verbose mode)")
+	if opts.Dir {
+		info["directory_listing"] = listDirectory(".")
 	}
-
-	fmt.Println("=== END VERBOSE OUTPUT ===")
-}
-
-func defaultShell() string {
-	if sh := os.Getenv("SHELL"); sh != "" {
-		return sh
+	if opts.Git {
+		maps.Copy(info, gatherGitContext("."))
 	}
-	return "sh"
+	return info
 }
 
-func gatherContext() map[string]string {
-	shell := defaultShell()
-	systemInfo := readSystemInfo()
+// stdinReader is shared by all interactive prompts so buffered input isn't lost
+// between them.
+var stdinReader = bufio.NewReader(os.Stdin)
 
-	return map[string]string{
-		"os":        runtime.GOOS,
-		"arch":      runtime.GOARCH,
-		"shell":     shell,
-		"safe_mode": "on",
-		"system":    systemInfo,
-	}
-}
-
-func readSystemInfo() string {
-	data, err := os.ReadFile("/etc/issue")
+// promptFromTerminal points os.Stdin and the prompts at the controlling
+// terminal once piped input has been read, so the menu and confirmations
+// still work. Without a terminal nothing changes.
+func promptFromTerminal() {
+	tty, err := os.Open("/dev/tty")
 	if err != nil {
-		return ""
+		return
 	}
-	content := string(data)
-
-	// Strip \n \l and extra whitespace
-	content = strings.ReplaceAll(content, "\\n", "")
-	content = strings.ReplaceAll(content, "\\l", "")
-	content = strings.TrimSpace(content)
-
-	return content
+	os.Stdin = tty
+	stdinReader = bufio.NewReader(tty)
 }
 
-func buildPrompt(task string, ctx map[string]string) string {
-	var b strings.Builder
-	b.WriteString("You are a shell command generator.\n")
-	b.WriteString("Output exactly one safe, single-line command for POSIX " + ctx["shell"] + "\n")
-	b.WriteString("Rules:\n")
-	b.WriteString("- NO explanations or extra text. Only the command.\n")
-	b.WriteString("- Avoid destructive actions (rm -rf, chmod -R, sudo, moving/deleting) unless explicitly requested.\n")
-	b.WriteString("- Prefer read-only queries (ls/find/stat/du/grep) when unsure.\n")
-	b.WriteString("- Use utilities commonly available on Linux/macOS.\n")
-	b.WriteString("- Must run correctly in the current working directory.\n")
-	b.WriteString("- If paths contain spaces, quote them safely.\n")
-	b.WriteString("- If the task is ambiguous, choose the safest widely useful command.\n")
-	b.WriteString("\nEnvironment context:\n")
-	for k, v := range ctx {
-		if v == "" {
-			continue
-		}
-		fmt.Fprintf(&b, "- %s: %s\n", k, v)
+// confirm asks a yes/no question on stderr; anything but y/yes means no.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	line, _ := stdinReader.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return true
 	}
-	b.WriteString("\nTask:\n")
-	b.WriteString(task)
-	b.WriteString("\n")
-	return b.String()
+	return false
 }
 
-func getCommands(ctx context.Context, token, prompt string, numCommands int) ([]apiCallResult, error) {
-	type apiResult struct {
-		result apiCallResult
-		err    error
-	}
-
-	results := make(chan apiResult, numCommands)
-	var wg sync.WaitGroup
-	httpClient := &http.Client{Timeout: 30 * time.Second}
-	wallStart := time.Now()
-
-	makeAPICall := func() {
-		defer wg.Done()
-		startTime := time.Now()
-
-		reqBody := responseReq{
-			Model:     modelName,
-			Input:     prompt,
-			MaxOutput: 500,
-			Text: map[string]any{
-				"format": map[string]any{
-					"type": "text",
-				},
-			},
-			Reasoning: map[string]any{
-				"effort": "none",
-			},
-		}
-
-		b, err := json.Marshal(reqBody)
-		if err != nil {
-			results <- apiResult{apiCallResult{Error: err, Duration: time.Since(startTime)}, err}
-			return
-		}
-		httpReq, err := http.NewRequestWithContext(ctx, "POST", openAIEndpoint, bytes.NewReader(b))
-		if err != nil {
-			results <- apiResult{apiCallResult{Error: err, Duration: time.Since(startTime)}, err}
-			return
-		}
-		httpReq.Header.Set("Content-Type", "application/json")
-		httpReq.Header.Set("Authorization", "Bearer "+token)
-
-		resp, err := httpClient.Do(httpReq)
-		if err != nil {
-			results <- apiResult{apiCallResult{Error: err, Duration: time.Since(startTime)}, err}
-			return
-		}
-		defer func() { _ = resp.Body.Close() }()
-
-		respData, err := io.ReadAll(resp.Body)
-		if err != nil {
-			results <- apiResult{apiCallResult{Error: err, Duration: time.Since(startTime)}, err}
-			return
-		}
-
-		if resp.StatusCode >= 400 {
-			err := fmt.Errorf("status %d: %s", resp.StatusCode, string(respData))
-			results <- apiResult{apiCallResult{Error: err, Duration: time.Since(startTime), RawResponse: respData}, err}
-			return
-		}
-
-		var rr responseResp
-		if err := json.Unmarshal(respData, &rr); err != nil {
-			results <- apiResult{apiCallResult{Error: err, Duration: time.Since(startTime), RawResponse: respData}, err}
-			return
-		}
-
-		candidates := extractCandidates(rr)
-		var commands []string
-		for _, c := range candidates {
-			cmd := sanitizeToSingleCommand(c)
-			if cmd != "" {
-				commands = append(commands, cmd)
-			}
-		}
-
-		results <- apiResult{apiCallResult{Commands: commands, Duration: time.Since(startTime), RawResponse: respData}, nil}
-	}
-
-	for range numCommands {
-		wg.Add(1)
-		go makeAPICall()
-	}
-
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-
-	var allResults []apiCallResult
-	var firstError error
-
-	for result := range results {
-		if result.err != nil && firstError == nil {
-			firstError = result.err
-		}
-		allResults = append(allResults, result.result)
-	}
-
-	if firstError != nil {
-		return nil, firstError
-	}
-
-	unique := make([]string, 0)
-	seen := map[string]struct{}{}
-	for _, result := range allResults {
-		for _, cmd := range result.Commands {
-			if _, ok := seen[cmd]; !ok {
-				seen[cmd] = struct{}{}
-				unique = append(unique, cmd)
-			}
-		}
-	}
-
-	combinedResult := apiCallResult{
-		Commands: unique,
-		Duration: time.Since(wallStart),
-	}
-
-	return append([]apiCallResult{combinedResult}, allResults...), nil
+// confirmTyped asks question on stderr and reports whether the user typed
+// word, so a reflexive y or Enter can't approve it.
+func confirmTyped(question, word string) bool {
+	fmt.Fprintf(os.Stderr, "%s Type %s to confirm: ", question, word)
+	line, _ := stdinReader.ReadString('\n')
+	return strings.TrimSpace(line) == word
 }
 
-func extractCandidates(rr responseResp) []string {
-	var out []string
-	for _, c := range rr.Candidates {
-		for _, p := range c.Content.Parts {
-			if strings.TrimSpace(p.Text) != "" {
-				out = append(out, p.Text)
-			}
-		}
-	}
-	if len(out) == 0 && rr.OutputText != "" {
-		out = append(out, rr.OutputText)
-	}
-	if len(out) == 0 {
-		for _, it := range rr.Output {
-			if strings.TrimSpace(it.Text) != "" {
-				out = append(out, it.Text)
-			} else if len(it.Content) > 0 {
-				for _, part := range it.Content {
-					if strings.TrimSpace(part.Text) != "" {
-						out = append(out, part.Text)
-					}
-				}
-			}
-		}
-	}
-	return out
+func runCommand(command string) error {
+	return runCommandCapture(command, nil)
 }
 
-var codeBlockRe = regexp.MustCompile("(?s)```(?:sh|bash|zsh)?\\n(.*?)\\n```")
-var firstLineRe = regexp.MustCompile(`(?m)^[^\n#;][^\n]*`)
-
-func sanitizeToSingleCommand(s string) string {
-	trim := strings.TrimSpace(s)
-
-	if m := codeBlockRe.FindStringSubmatch(trim); len(m) == 2 {
-		trim = strings.TrimSpace(m[1])
-	}
-
-	if m := firstLineRe.FindString(trim); m != "" {
-		trim = strings.TrimSpace(m)
+// runCommandCapture runs command like runCommand and, when capture is non-nil,
+// also copies combined stdout/stderr into it for use as follow-up context.
+// Capturing replaces the inherited terminal with pipes, so it is only used
+// when the output is actually needed.
+func runCommandCapture(command string, capture *tailBuffer) error {
+	cmd := shellCommand(command)
+	if capture != nil {
+		cmd.Stdout = io.MultiWriter(commandStdout, capture)
+		cmd.Stderr = io.MultiWriter(os.Stderr, capture)
 	}
-
-	if i := strings.IndexByte(trim, '\n'); i >= 0 {
-		trim = strings.TrimSpace(trim[:i])
-	}
-
-	trim = strings.TrimPrefix(trim, "$ ")
-	trim = strings.TrimPrefix(trim, "> ")
-	trim = strings.TrimSpace(trim)
-
-	return trim
+	return runForeground(cmd)
 }
 
-func selectCommand(cmds []string) (string, error) {
-	fmt.Println("Select a command:")
-	for i, c := range cmds {
-		fmt.Printf("  %d) %s\n", i+1, c)
-	}
-	fmt.Print("Enter number: ")
-	reader := bufio.NewReader(os.Stdin)
-	line, _ := reader.ReadString('\n')
-	line = strings.TrimSpace(line)
-	idx, err := strconv.Atoi(line)
-	if err != nil || idx < 1 || idx > len(cmds) {
-		return "", errors.New("invalid selection")
-	}
-	return cmds[idx-1], nil
+// runCommandStderr runs command like runCommand but also copies its stderr
+// into capture. Stdout stays attached to the terminal.
+func runCommandStderr(command string, capture *tailBuffer) error {
+	cmd := shellCommand(command)
+	cmd.Stderr = io.MultiWriter(os.Stderr, capture)
+	return runForeground(cmd)
 }
 
-func runCommand(command string) error {
-	cmd := exec.Command(defaultShell(), "-c", command)
+// commandStdout is where the commands ai runs write their output: stdout,
+// unless --json reserves it for the report.
+var commandStdout = os.Stdout
+
+// shellCommand prepares command to run in the user's shell with inherited
+// stdio and environment.
+func shellCommand(command string) *exec.Cmd {
+	shell := targetShell()
+	cmd := exec.Command(shell, append(ai.ShellArgs(shell), command)...)
 	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = commandStdout
 	cmd.Stderr = os.Stderr
 	cmd.Env = os.Environ()
-	return cmd.Run()
+	return cmd
 }
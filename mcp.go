@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// mcpProtocolVersions are the Model Context Protocol revisions `ai mcp`
+// speaks, newest first.
+var mcpProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes used by the MCP server.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// mcpMaxSuggestions caps the n argument of suggest_shell_command.
+const mcpMaxSuggestions = 10
+
+// rpcRequest is an incoming JSON-RPC message. Notifications have no ID.
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse answers one request with either a result or an error.
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// suggestArgs are the arguments of the suggest_shell_command tool.
+type suggestArgs struct {
+	Task    string `json:"task"`
+	Context string `json:"context"`
+	Cwd     string `json:"cwd"`
+	N       int    `json:"n"`
+}
+
+// suggestTool describes suggest_shell_command for tools/list.
+var suggestTool = map[string]any{
+	"name":        "suggest_shell_command",
+	"title":       "Suggest shell command",
+	"description": "Suggest shell commands for a task, described in plain language, on the machine the server runs on. The commands are not run.",
+	"inputSchema": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"task":    map[string]any{"type": "string", "description": "what the command should do"},
+			"context": map[string]any{"type": "string", "description": "anything else that helps, such as an error message or the file being edited"},
+			"cwd":     map[string]any{"type": "string", "description": "directory the command will run in"},
+			"n":       map[string]any{"type": "integer", "minimum": 1, "maximum": mcpMaxSuggestions, "description": "number of model calls whose suggestions are combined (default 1)"},
+		},
+		"required": []string{"task"},
+	},
+	"outputSchema": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"commands": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+		"required": []string{"commands"},
+	},
+}
+
+// runMCP implements `ai mcp`: a Model Context Protocol server on stdin and
+// stdout that offers command suggestions as the suggest_shell_command tool,
+// so editors and agents can use ai without shelling out to it.
+func runMCP(args []string) int {
+	flags := &cliFlags{}
+	fs := newProviderFlagSet("ai mcp", flags)
+	fs.BoolVar(&flags.force, "force", false, "send tasks that appear to contain secrets")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: ai mcp [flags]")
+		fmt.Fprintln(out, "\nServe the suggest_shell_command tool over the Model Context Protocol on")
+		fmt.Fprintln(out, "stdin and stdout. Configure it in your editor or agent as a stdio server.")
+		fmt.Fprintln(out, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	s, code := newSession(flags)
+	if s == nil {
+		return code
+	}
+	// stdout carries the protocol; anything for a human goes to stderr.
+	s.ui = os.Stderr
+	flags.noStream = true
+
+	enc := json.NewEncoder(os.Stdout)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		resp, ok := s.handleMCP([]byte(line))
+		if !ok {
+			continue
+		}
+		if err := enc.Encode(resp); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// handleMCP answers one JSON-RPC message. It returns false for
+// notifications, which get no reply.
+func (s *session) handleMCP(data []byte) (rpcResponse, bool) {
+	var req rpcRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return rpcResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, "parse error: " + err.Error()}}, true
+	}
+	if len(req.ID) == 0 {
+		// Notifications such as notifications/initialized need no action.
+		return rpcResponse{}, false
+	}
+	resp := rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		resp.Error = &rpcError{rpcInvalidRequest, "invalid request"}
+		return resp, true
+	}
+
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		version := mcpProtocolVersions[0]
+		if slices.Contains(mcpProtocolVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		resp.Result = map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "ai", "version": buildVersion()},
+		}
+	case "ping":
+		resp.Result = map[string]any{}
+	case "tools/list":
+		resp.Result = map[string]any{"tools": []any{suggestTool}}
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			resp.Error = &rpcError{rpcInvalidParams, err.Error()}
+			return resp, true
+		}
+		if params.Name != "suggest_shell_command" {
+			resp.Error = &rpcError{rpcInvalidParams, fmt.Sprintf("unknown tool %q", params.Name)}
+			return resp, true
+		}
+		resp.Result = s.callSuggestTool(params.Arguments)
+	default:
+		resp.Error = &rpcError{rpcMethodNotFound, "method not found: " + req.Method}
+	}
+	return resp, true
+}
+
+// callSuggestTool runs suggest_shell_command. Failures are reported in the
+// result, as MCP expects, so the calling model can see and react to them.
+func (s *session) callSuggestTool(raw json.RawMessage) map[string]any {
+	var args suggestArgs
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return toolError(fmt.Errorf("invalid arguments: %w", err))
+		}
+	}
+	commands, err := s.suggest(args)
+	if err != nil {
+		return toolError(err)
+	}
+	return map[string]any{
+		"content":           []any{map[string]any{"type": "text", "text": strings.Join(commands, "\n")}},
+		"structuredContent": map[string]any{"commands": commands},
+	}
+}
+
+// suggest generates commands for a tool call within the token budget.
+func (s *session) suggest(args suggestArgs) ([]string, error) {
+	task := strings.TrimSpace(args.Task)
+	if task == "" {
+		return nil, errors.New("task is required")
+	}
+	n := cmp.Or(args.N, 1)
+	if n < 1 || n > mcpMaxSuggestions {
+		return nil, fmt.Errorf("n must be between 1 and %d", mcpMaxSuggestions)
+	}
+	if kinds := findSecrets(task + "\n" + args.Context); len(kinds) > 0 && !s.flags.force {
+		return nil, fmt.Errorf("the request appears to contain a secret (%s) and was not sent; remove it, or start ai mcp with --force", strings.Join(kinds, ", "))
+	}
+	if !s.flags.ignoreBudget {
+		if err := s.budget.check(s.ledger, time.Now()); err != nil {
+			if !s.budget.Warn {
+				return nil, err
+			}
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+		}
+	}
+
+	env := maps.Clone(s.env)
+	if cwd := strings.TrimSpace(args.Cwd); cwd != "" {
+		env["working_directory"] = cwd
+		if s.flags.ctxOpts.Dir {
+			env["directory_listing"] = listDirectory(cwd)
+		}
+		if s.flags.ctxOpts.Git {
+			maps.DeleteFunc(env, func(k, _ string) bool { return strings.HasPrefix(k, "git_") })
+			maps.Copy(env, gatherGitContext(cwd))
+		}
+	}
+	dir := cmp.Or(strings.TrimSpace(args.Cwd), ".")
+	if s.flags.ctxOpts.Files {
+		maps.Copy(env, referencedFiles(task, dir))
+	}
+	maps.Copy(env, attachedFiles(task, dir, os.Stderr))
+	if extra := strings.TrimSpace(args.Context); extra != "" {
+		task += "\n\nContext from the caller:\n" + extra
+	}
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	redactEnvironment(env)
+	client := *s.client
+	client.Environment = s.fitEnvironment(env)
+	results, err := client.Generate(ctx, ai.Task{Description: task, N: n})
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, errors.New("no commands generated")
+	}
+	usd, known := callsCost(results[1:])
+	s.recordUsage(results[0].Usage, usd, known)
+	s.logResults(results)
+	if len(results[0].Commands) == 0 {
+		return nil, errors.New("no commands generated")
+	}
+	commands, blocked := s.cfg.dropBlocked(results[0].Commands)
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("every suggestion was blocked (%s)", blocked)
+	}
+	commands, unparsable := dropUnparsable(commands)
+	if len(commands) == 0 {
+		return nil, fmt.Errorf("no suggestion is valid shell syntax (%s)", unparsable)
+	}
+	commands = s.arrange(task, commands)
+	s.audit(auditRecord{Mode: "mcp", Task: task, Suggestions: commands})
+	return commands, nil
+}
+
+// toolError is a tool result reporting err.
+func toolError(err error) map[string]any {
+	return map[string]any{
+		"content": []any{map[string]any{"type": "text", "text": err.Error()}},
+		"isError": true,
+	}
+}
+
+// buildVersion returns the module version ai was built from, or "devel".
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// mcpContextTimeout bounds starting an MCP server and reading its
+	// resources, so a slow server delays a request only so much.
+	mcpContextTimeout = 5 * time.Second
+	// mcpMaxResources is how many listed resources are read from a server
+	// that doesn't name the ones it should contribute.
+	mcpMaxResources = 5
+	// mcpContextBytes caps the text a server adds to the prompt.
+	mcpContextBytes = 4096
+)
+
+// mcpServer is a Model Context Protocol server from the config whose
+// resources are added to the environment context of every prompt.
+type mcpServer struct {
+	Command   []string `toml:"command"`   // program and arguments of a stdio server
+	Resources []string `toml:"resources"` // URIs to read; the first listed resources when empty
+}
+
+// mcpMessage is any JSON-RPC message a server sends: a response to one of
+// our requests, or a request or notification of its own.
+type mcpMessage struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *rpcError       `json:"error,omitempty"`
+}
+
+// mcpClient talks JSON-RPC to a server over its stdin and stdout.
+type mcpClient struct {
+	in     io.Writer
+	out    *bufio.Scanner
+	nextID int
+}
+
+// gatherMCPContext reads the resources of every configured server in
+// parallel. Each resource becomes one context entry; servers that fail are
+// reported to warn and left out.
+func gatherMCPContext(servers map[string]mcpServer, warn io.Writer) map[string]string {
+	info := make(map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), mcpContextTimeout)
+			defer cancel()
+			resources, err := readMCPResources(ctx, srv)
+			if err != nil && ctx.Err() != nil {
+				err = fmt.Errorf("no answer within %v", mcpContextTimeout)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				fmt.Fprintf(warn, "Warning: MCP server %s: %v\n", name, err)
+			}
+			for uri, text := range resources {
+				info[fmt.Sprintf("%s resource %s", name, uri)] = text
+			}
+		}()
+	}
+	wg.Wait()
+	return info
+}
+
+// readMCPResources starts srv, reads its resources and stops it again. It
+// returns the text of each resource by URI, with secrets redacted and the
+// total cut to mcpContextBytes.
+func readMCPResources(ctx context.Context, srv mcpServer) (map[string]string, error) {
+	if len(srv.Command) == 0 {
+		return nil, errors.New("no command configured")
+	}
+	cmd := exec.CommandContext(ctx, srv.Command[0], srv.Command[1:]...)
+	cmd.WaitDelay = time.Second
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = in.Close()
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	c := &mcpClient{in: in, out: bufio.NewScanner(out)}
+	c.out.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if err := c.call("initialize", map[string]any{
+		"protocolVersion": mcpProtocolVersions[0],
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "ai", "version": buildVersion()},
+	}, nil); err != nil {
+		return nil, err
+	}
+	if err := c.send(map[string]any{"jsonrpc": "2.0", "method": "notifications/initialized"}); err != nil {
+		return nil, err
+	}
+
+	uris := srv.Resources
+	if len(uris) == 0 {
+		var list struct {
+			Resources []struct {
+				URI string `json:"uri"`
+			} `json:"resources"`
+		}
+		if err := c.call("resources/list", map[string]any{}, &list); err != nil {
+			return nil, err
+		}
+		for _, r := range list.Resources[:min(len(list.Resources), mcpMaxResources)] {
+			uris = append(uris, r.URI)
+		}
+	}
+
+	texts := make(map[string]string)
+	budget := mcpContextBytes
+	for _, uri := range uris {
+		if budget <= 0 {
+			break
+		}
+		var read struct {
+			Contents []struct {
+				Text string `json:"text"`
+			} `json:"contents"`
+		}
+		if err := c.call("resources/read", map[string]any{"uri": uri}, &read); err != nil {
+			return texts, fmt.Errorf("read %s: %w", uri, err)
+		}
+		var parts []string
+		for _, content := range read.Contents {
+			if t := strings.TrimSpace(content.Text); t != "" {
+				parts = append(parts, t) // binary contents have no text and are skipped
+			}
+		}
+		text := redactSecrets(strings.Join(parts, "\n"))
+		if len(text) > budget {
+			text = strings.ToValidUTF8(text[:budget], "") + "\n[truncated]"
+		}
+		if text != "" {
+			texts[uri] = text
+			budget -= len(text)
+		}
+	}
+	return texts, nil
+}
+
+// call sends a request and decodes the result of its response into result,
+// which may be nil. Requests from the server in the meantime are declined
+// and its notifications ignored.
+func (c *mcpClient) call(method string, params, result any) error {
+	c.nextID++
+	id := fmt.Sprint(c.nextID)
+	if err := c.send(map[string]any{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params}); err != nil {
+		return err
+	}
+	for c.out.Scan() {
+		var msg mcpMessage
+		if err := json.Unmarshal(c.out.Bytes(), &msg); err != nil {
+			return fmt.Errorf("invalid message from server: %w", err)
+		}
+		switch {
+		case msg.Method != "" && len(msg.ID) > 0:
+			if err := c.send(rpcResponse{JSONRPC: "2.0", ID: msg.ID, Error: &rpcError{rpcMethodNotFound, "not supported by this client"}}); err != nil {
+				return err
+			}
+		case msg.Method == "" && string(msg.ID) == id:
+			if msg.Error != nil {
+				return fmt.Errorf("%s: %s", method, msg.Error.Message)
+			}
+			if result == nil {
+				return nil
+			}
+			return json.Unmarshal(msg.Result, result)
+		}
+	}
+	if err := c.out.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s: server exited without answering", method)
+}
+
+// send writes one message as a line of JSON.
+func (c *mcpClient) send(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = c.in.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/brainexe/ai/pkg/ai"
+	"golang.org/x/term"
+)
+
+const (
+	ansiReverse   = "\x1b[7m"
+	ansiClearDown = "\x1b[J"
+	ansiClearLine = "\x1b[K"
+)
+
+// errAborted is returned when the user quits the selection menu.
+var errAborted = errors.New("aborted")
+
+// errNoTerminal is returned when there is no one to make a selection: in
+// cron jobs, scripts and CI, stdin is /dev/null or a pipe that may never
+// send a choice.
+var errNoTerminal = errors.New("stdin is not a terminal")
+
+// menuChoice is the outcome of the selection menu: a command to run, a
+// request for new suggestions with an optional hint for the model, or a
+// correction to refine the current suggestions with.
+type menuChoice struct {
+	command    string
+	regenerate bool
+	hint       string
+	correction string
+}
+
+// menu keys returned by readKey besides printable characters.
+const (
+	keyUp        = "up"
+	keyDown      = "down"
+	keyLeft      = "left"
+	keyRight     = "right"
+	keyHome      = "home"
+	keyEnd       = "end"
+	keyEnter     = "enter"
+	keyQuit      = "quit"
+	keyBackspace = "backspace"
+	keyDelete    = "delete"
+	keyKillLine  = "kill-line"
+	keyTab       = "tab"
+)
+
+// selectCommand lets the user pick one of cmds. On a terminal it shows an
+// arrow-key menu on ui; otherwise it falls back to a numbered prompt, or
+// fails with errNoTerminal when stdin isn't a terminal either. notes,
+// if given, holds a one-line explanation per command shown under its entry.
+// source, if not nil, names what suggested a command, for a tag after it.
+func selectCommand(ui *os.File, cmds, notes []string, compare bool, source func(string) string) (menuChoice, error) {
+	if menuInteractive(ui) {
+		return selectInteractive(ui, cmds, notes, compare, source, nil)
+	}
+	return selectNumbered(ui, cmds, notes, compare, source)
+}
+
+// selectGrowing is selectCommand for a list that is still being generated:
+// each value received from more replaces cmds with a longer list, and the
+// arrow-key menu redraws to show it. Without a terminal it falls back to
+// the numbered prompt for the commands known so far.
+func selectGrowing(ui *os.File, cmds []string, source func(string) string, more <-chan []string) (menuChoice, error) {
+	if menuInteractive(ui) {
+		return selectInteractive(ui, cmds, nil, false, source, more)
+	}
+	return selectNumbered(ui, cmds, nil, false, source)
+}
+
+// menuInteractive reports whether the arrow-key menu can be shown on ui.
+func menuInteractive(ui *os.File) bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(ui.Fd()))
+}
+
+// selectNumbered shows the numbered list on ui and reads the choice from
+// stdin, which must be a terminal; "r" or "r <hint>" asks for new
+// suggestions and ":<correction>" refines the current ones.
+func selectNumbered(ui *os.File, cmds, notes []string, compare bool, source func(string) string) (menuChoice, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return menuChoice{}, errNoTerminal
+	}
+	fmt.Fprintln(ui, "Select a command:")
+	color := colorEnabled(ui)
+	if compare && len(cmds) > 1 {
+		printComparison(ui, cmds, notes, source, color)
+	} else {
+		for i, c := range cmds {
+			tags, _ := suggestionTags(c, source, color)
+			// Further lines of a multi-line command line up under its first.
+			c = strings.ReplaceAll(c, "\n", "\n     ")
+			fmt.Fprintf(ui, "  %d) %s%s\n", i+1, highlightCommand(c, color), tags)
+			if note := noteAt(notes, i); note != "" {
+				fmt.Fprintf(ui, "     %s\n", paint(note, ansiDim, color))
+			}
+		}
+	}
+	fmt.Fprint(ui, "Enter number (r [hint] to regenerate, :<correction> to refine): ")
+	line, _ := stdinReader.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if correction, ok := strings.CutPrefix(line, ":"); ok && strings.TrimSpace(correction) != "" {
+		return menuChoice{correction: strings.TrimSpace(correction)}, nil
+	}
+	if line == "r" || strings.HasPrefix(line, "r ") {
+		return menuChoice{regenerate: true, hint: strings.TrimSpace(line[1:])}, nil
+	}
+	idx, err := strconv.Atoi(line)
+	if err != nil || idx < 1 || idx > len(cmds) {
+		return menuChoice{}, errors.New("invalid selection")
+	}
+	return menuChoice{command: cmds[idx-1]}, nil
+}
+
+// selectInteractive runs the arrow-key menu with the terminal in raw mode:
+// up/down or k/j move, Enter picks, a digit picks that entry, e edits the
+// highlighted entry in place and E in $EDITOR, r asks for new suggestions,
+// : refines them with a correction, and q, Esc or Ctrl-C abort. Lists
+// received from more replace cmds while the menu is shown; they may reorder
+// the entries, and the highlight follows the entry it was on.
+func selectInteractive(ui *os.File, cmds, notes []string, compare bool, source func(string) string, more <-chan []string) (menuChoice, error) {
+	color := colorEnabled(ui)
+	labels := cmds
+	if compare && len(cmds) > 1 && color {
+		labels, _ = comparisonLines(cmds, color)
+	}
+
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return selectNumbered(ui, cmds, notes, compare, source)
+	}
+	defer func() { _ = term.Restore(int(os.Stdin.Fd()), state) }()
+
+	width, _, err := term.GetSize(int(ui.Fd()))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+
+	fmt.Fprint(ui, "Select a command (↑/↓, Enter to run, e/E to edit, r to regenerate, : to refine, q to quit):\r\n")
+	cur := 0
+	rows := 0 // rows drawn, which redraw moves back over
+	draw := func() {
+		rows = 0
+		for i := range cmds {
+			fmt.Fprint(ui, menuLine(i, cmds[i], labels[i], i == cur, source, color, width)+"\r\n")
+			rows++
+			if note := noteAt(notes, i); note != "" {
+				fmt.Fprint(ui, noteLine(note, color, width)+"\r\n")
+				rows++
+			}
+		}
+	}
+	redraw := func() {
+		fmt.Fprintf(ui, "\x1b[%dA\r%s", rows, ansiClearDown)
+		draw()
+	}
+
+	draw()
+	// Keys are read in the background so new suggestions can be drawn while
+	// waiting; at most one read is outstanding, and none once a key has
+	// been received, so editLine can read stdin itself.
+	type keyPress struct {
+		key string
+		err error
+	}
+	var pending chan keyPress
+	for {
+		if pending == nil {
+			pending = make(chan keyPress, 1)
+			go func(c chan<- keyPress) {
+				key, err := readKey(stdinReader)
+				c <- keyPress{key, err}
+			}(pending)
+		}
+		var press keyPress
+		select {
+		case updated, ok := <-more:
+			if !ok {
+				more = nil
+				continue
+			}
+			// Keep the highlight on the same entry if it moved.
+			if i := slices.Index(updated, cmds[cur]); i >= 0 {
+				cur = i
+			}
+			cmds, labels = updated, updated
+			redraw()
+			continue
+		case press = <-pending:
+			pending = nil
+		}
+		key, err := press.key, press.err
+		if err != nil {
+			return menuChoice{}, err
+		}
+		switch key {
+		case keyUp, "k":
+			cur = (cur + len(cmds) - 1) % len(cmds)
+		case keyDown, "j":
+			cur = (cur + 1) % len(cmds)
+		case keyEnter:
+			return menuChoice{command: cmds[cur]}, nil
+		case keyQuit, "q":
+			return menuChoice{}, errAborted
+		case "e", "E":
+			// The line editor can't hold a multi-line command.
+			if key == "e" && !strings.Contains(cmds[cur], "\n") {
+				edited, ok, err := editLine(ui, stdinReader, "Edit: ", cmds[cur])
+				if err != nil {
+					return menuChoice{}, err
+				}
+				if ok && edited != "" {
+					return menuChoice{command: edited}, nil
+				}
+				continue
+			}
+			_ = term.Restore(int(os.Stdin.Fd()), state)
+			edited, err := editInEditor(cmds[cur])
+			if err != nil {
+				return menuChoice{}, err
+			}
+			if edited == "" {
+				return menuChoice{}, errAborted
+			}
+			return menuChoice{command: edited}, nil
+		case "r":
+			hint, ok, err := editLine(ui, stdinReader, "Hint for new suggestions (optional): ", "")
+			if err != nil {
+				return menuChoice{}, err
+			}
+			if ok {
+				return menuChoice{regenerate: true, hint: hint}, nil
+			}
+			continue
+		case ":":
+			correction, ok, err := editLine(ui, stdinReader, ":", "")
+			if err != nil {
+				return menuChoice{}, err
+			}
+			if ok && correction != "" {
+				return menuChoice{correction: correction}, nil
+			}
+			continue
+		default:
+			if n, err := strconv.Atoi(key); err == nil && n >= 1 && n <= len(cmds) {
+				cur = n - 1
+				redraw()
+				return menuChoice{command: cmds[cur]}, nil
+			}
+			continue
+		}
+		redraw()
+	}
+}
+
+// menuLine renders one entry, with its syntax highlighted unless label
+// carries comparison highlighting. Entries are cut to the terminal width so
+// each takes exactly one row, which keeps redrawing in place simple; cut and
+// selected entries are shown without comparison highlighting, and selected
+// ones without syntax highlighting.
+func menuLine(i int, cmd, label string, selected bool, source func(string) string, color bool, width int) string {
+	prefix := fmt.Sprintf("  %d) ", i+1)
+	if selected {
+		prefix = fmt.Sprintf("> %d) ", i+1)
+	}
+	tags, tagsWidth := suggestionTags(cmd, source, color)
+	if first, _, ok := strings.Cut(cmd, "\n"); ok {
+		// The lines count is among the tags; the entry shows the first.
+		cmd = first + " …"
+		label = cmd
+	}
+	switch room := width - len(prefix) - tagsWidth - 1; {
+	case len([]rune(cmd)) > room:
+		label = highlightCommand(string([]rune(cmd)[:max(room-1, 0)]), color && !selected) + "…"
+	case selected:
+		// Highlighting resets would end the reverse video early.
+		label = cmd
+	case label == cmd:
+		label = highlightCommand(cmd, color)
+	}
+	if selected {
+		return paint(prefix+label, ansiReverse, color) + tags
+	}
+	return prefix + label + tags
+}
+
+// suggestionTags returns the tags shown after cmd in a list of suggestions,
+// painted when color is set, and their width on screen: its risk level
+// unless low, the programs it runs that aren't installed, and what source
+// says suggested it.
+func suggestionTags(cmd string, source func(string) string, color bool) (string, int) {
+	var from string
+	if source != nil {
+		from = source(cmd)
+	}
+	cmd = withoutPlaceholders(cmd)
+	var b strings.Builder
+	width := 0
+	add := func(tag, style string) {
+		b.WriteString(paint(tag, style, color))
+		width += len([]rune(tag))
+	}
+	if lines := strings.Count(cmd, "\n") + 1; lines > 1 {
+		add(fmt.Sprintf(" [%d lines]", lines), ansiDim)
+	}
+	switch level, _ := commandRisk(cmd); level {
+	case riskHigh:
+		add(" [high risk]", ansiHighRisk)
+	case riskMedium:
+		add(" [medium risk]", ansiMediumRisk)
+	}
+	if missing := missingTools(cmd); len(missing) > 0 {
+		add(" [not installed: "+strings.Join(missing, ", ")+"]", ansiDim)
+	}
+	if from != "" {
+		add(" ["+from+"]", ansiDim)
+	}
+	return b.String(), width
+}
+
+// noteLine renders an explanation under a menu entry, dimmed and cut to the
+// terminal width like the entry itself.
+func noteLine(note string, color bool, width int) string {
+	const indent = "     "
+	if room := width - len(indent) - 1; len([]rune(note)) > room {
+		note = string([]rune(note)[:max(room-1, 0)]) + "…"
+	}
+	return indent + paint(note, ansiDim, color)
+}
+
+// noteAt returns the note for entry i, or "" when there is none.
+func noteAt(notes []string, i int) string {
+	if i < len(notes) {
+		return notes[i]
+	}
+	return ""
+}
+
+// readKey reads one key press from a terminal in raw mode. Printable keys
+// are returned as themselves, control keys by their name.
+func readKey(r *bufio.Reader) (string, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch c {
+	case '\r', '\n':
+		return keyEnter, nil
+	case 3, 4: // Ctrl-C, Ctrl-D
+		return keyQuit, nil
+	case 0x7f, 8:
+		return keyBackspace, nil
+	case 1:
+		return keyHome, nil
+	case 5:
+		return keyEnd, nil
+	case 21:
+		return keyKillLine, nil
+	case '\t':
+		return keyTab, nil
+	case 0x1b:
+		// A lone Esc quits; cursor keys arrive as ESC [ x or ESC O x.
+		if r.Buffered() < 2 {
+			return keyQuit, nil
+		}
+		if next, _ := r.ReadByte(); next != '[' && next != 'O' {
+			return "", nil
+		}
+		switch code, _ := r.ReadByte(); code {
+		case 'A':
+			return keyUp, nil
+		case 'B':
+			return keyDown, nil
+		case 'C':
+			return keyRight, nil
+		case 'D':
+			return keyLeft, nil
+		case 'H':
+			return keyHome, nil
+		case 'F':
+			return keyEnd, nil
+		case '3':
+			if tilde, _ := r.ReadByte(); tilde == '~' {
+				return keyDelete, nil
+			}
+		}
+		return "", nil
+	}
+	if c < 0x20 {
+		return "", nil
+	}
+	return string(c), nil
+}
+
+// editLine lets the user edit text on the current line, readline-style, with
+// the terminal in raw mode. It reports false when editing was cancelled with
+// Esc or Ctrl-C, leaving the cursor at the start of the cleared line.
+func editLine(ui *os.File, r *bufio.Reader, prompt, text string) (string, bool, error) {
+	return editLineWith(ui, r, prompt, text, nil)
+}
+
+// editLineWith is editLine with Tab completing the whole text through
+// complete, when it isn't nil. Ambiguous completions are listed below the
+// line.
+func editLineWith(ui *os.File, r *bufio.Reader, prompt, text string, complete func(string) (string, []string)) (string, bool, error) {
+	buf := []rune(text)
+	pos := len(buf)
+	for {
+		fmt.Fprintf(ui, "\r\x1b[K%s%s", prompt, string(buf))
+		if back := len(buf) - pos; back > 0 {
+			fmt.Fprintf(ui, "\x1b[%dD", back)
+		}
+		key, err := readKey(r)
+		if err != nil {
+			return "", false, err
+		}
+		switch key {
+		case keyEnter:
+			fmt.Fprint(ui, "\r\n")
+			return strings.TrimSpace(string(buf)), true, nil
+		case keyQuit:
+			fmt.Fprint(ui, "\r\x1b[K")
+			return "", false, nil
+		case keyLeft:
+			pos = max(pos-1, 0)
+		case keyRight:
+			pos = min(pos+1, len(buf))
+		case keyHome:
+			pos = 0
+		case keyEnd:
+			pos = len(buf)
+		case keyBackspace:
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case keyDelete:
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case keyKillLine:
+			buf = buf[pos:]
+			pos = 0
+		case keyTab:
+			if complete == nil {
+				continue
+			}
+			completed, candidates := complete(string(buf))
+			if len(candidates) > 0 {
+				fmt.Fprint(ui, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+			}
+			buf = []rune(completed)
+			pos = len(buf)
+		case "", keyUp, keyDown:
+		default:
+			ins := []rune(key)
+			buf = append(buf[:pos], append(ins, buf[pos:]...)...)
+			pos += len(ins)
+		}
+	}
+}
+
+// editInEditor opens cmd in $VISUAL or $EDITOR (vi by default) and returns
+// the saved text, which may span several lines.
+func editInEditor(cmd string) (string, error) {
+	editor := firstNonEmpty(os.Getenv("VISUAL"), os.Getenv("EDITOR"), "vi")
+	f, err := os.CreateTemp("", "ai-command-*.sh")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	if _, err := f.WriteString(cmd + "\n"); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	// The editor value may carry arguments (EDITOR="code --wait"), so let a
+	// shell split it: /bin/sh rather than the user's shell, which may not
+	// know "$1" (fish, nu, xonsh), except on Windows, where there is none.
+	// PowerShell has no positional parameters for -Command, so the file
+	// name goes into the command itself.
+	shell := "/bin/sh"
+	if runtime.GOOS == "windows" {
+		shell = ai.DefaultShell()
+	}
+	c := exec.Command(shell, "-c", editor+` "$1"`, "editor", f.Name())
+	if ai.IsPowerShell(shell) {
+		c = exec.Command(shell, "-NoProfile", "-Command", "& "+editor+" "+quotePowerShell(f.Name(), 0))
+	}
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stderr, os.Stderr
+	if err := c.Run(); err != nil {
+		return "", fmt.Errorf("editor: %w", err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
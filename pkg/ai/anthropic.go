@@ -0,0 +1,248 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicEndpoint       = "https://api.anthropic.com/v1/messages"
+	anthropicModelsEndpoint = "https://api.anthropic.com/v1/models"
+	anthropicModel          = "claude-sonnet-4-5"
+	anthropicVersion        = "2023-06-01"
+)
+
+type anthropicReq struct {
+	Model      string             `json:"model"`
+	MaxTokens  int                `json:"max_tokens"`
+	Messages   []anthropicMessage `json:"messages"`
+	Tools      []anthropicTool    `json:"tools,omitempty"`
+	ToolChoice map[string]any     `json:"tool_choice,omitempty"`
+	Stream     bool               `json:"stream,omitempty"`
+}
+
+// anthropicTool declares a tool; forcing the model to call it is how the
+// Messages API returns JSON that follows a schema.
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicResp struct {
+	ID      string                  `json:"id"`
+	Model   string                  `json:"model"`
+	Content []anthropicContentBlock `json:"content"`
+	Usage   anthropicUsage          `json:"usage"`
+}
+
+type anthropicContentBlock struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"` // tool_use arguments
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// anthropicEvent is one event of a streamed Messages API reply.
+type anthropicEvent struct {
+	Type         string                `json:"type"`
+	Index        int                   `json:"index"`
+	Message      anthropicResp         `json:"message"`       // message_start
+	ContentBlock anthropicContentBlock `json:"content_block"` // content_block_start
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text,omitempty"`
+		PartialJSON string `json:"partial_json,omitempty"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"` // message_delta
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicProvider talks to the Anthropic Messages API.
+type anthropicProvider struct {
+	apiKey     string
+	model      string
+	opts       Options
+	httpClient *http.Client
+}
+
+func newAnthropicProvider(opts Options) (*anthropicProvider, error) {
+	if opts.Tools {
+		return nil, errors.New("tools are only supported by the openai and azure providers")
+	}
+	apiKey := firstNonEmpty(opts.APIKey, os.Getenv("ANTHROPIC_API_KEY"))
+	if apiKey == "" {
+		return nil, errors.New("ANTHROPIC_API_KEY not set")
+	}
+	return &anthropicProvider{apiKey: apiKey, model: firstNonEmpty(opts.Model, anthropicModel), opts: opts, httpClient: newHTTPClient(opts, opts.Timeout)}, nil
+}
+
+func (p *anthropicProvider) GenerateCommands(ctx context.Context, prompt string, n int) ([]Result, error) {
+	return fanOut(ctx, n, p.opts, func(ctx context.Context) Result {
+		return p.call(ctx, prompt, true)
+	})
+}
+
+func (p *anthropicProvider) Complete(ctx context.Context, prompt string) (Result, error) {
+	return completeOnce(p.call(ctx, prompt, false))
+}
+
+// call makes one API call. With structured set, the model must answer
+// through a tool whose input follows commandSchema.
+func (p *anthropicProvider) call(ctx context.Context, prompt string, structured bool) Result {
+	startTime := time.Now()
+
+	reqBody := anthropicReq{
+		Model:     p.model,
+		MaxTokens: 500,
+		Messages:  []anthropicMessage{{Role: "user", Content: prompt}},
+	}
+	if structured {
+		reqBody.Tools = []anthropicTool{{Name: "shell_commands", Description: "Return the suggested shell commands.", InputSchema: commandSchema}}
+		reqBody.ToolChoice = map[string]any{"type": "tool", "name": "shell_commands"}
+	}
+	reqBody.Stream = streaming(ctx)
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return Result{Error: err, Duration: time.Since(startTime)}
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", anthropicEndpoint, bytes.NewReader(b))
+	if err != nil {
+		return Result{Error: err, Duration: time.Since(startTime)}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	p.authorize(httpReq)
+
+	resp, retries, err := doWithRetry(ctx, p.httpClient, httpReq)
+	if err != nil {
+		return Result{Error: err, Duration: time.Since(startTime), Retries: retries}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var ar anthropicResp
+	var respData []byte
+	if resp.StatusCode < 400 && reqBody.Stream {
+		ar, respData, err = readAnthropicStream(ctx, resp.Body)
+		if err != nil {
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries, RawResponse: respData}
+		}
+	} else {
+		respData, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries}
+		}
+
+		if resp.StatusCode >= 400 {
+			err := &statusError{code: resp.StatusCode, body: string(respData)}
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries, RawResponse: respData}
+		}
+
+		if err := json.Unmarshal(respData, &ar); err != nil {
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries, RawResponse: respData}
+		}
+	}
+
+	var candidates []string
+	for _, c := range ar.Content {
+		switch {
+		case c.Type == "text" && strings.TrimSpace(c.Text) != "":
+			candidates = append(candidates, c.Text)
+		case c.Type == "tool_use" && len(c.Input) > 0:
+			candidates = append(candidates, string(c.Input))
+		}
+	}
+	usage := Usage{
+		InputTokens:  ar.Usage.InputTokens,
+		OutputTokens: ar.Usage.OutputTokens,
+		TotalTokens:  ar.Usage.InputTokens + ar.Usage.OutputTokens,
+	}
+
+	return Result{Model: firstNonEmpty(ar.Model, p.model), Text: strings.Join(candidates, "\n"), Commands: commandsFromCandidates(candidates), Duration: time.Since(startTime), Retries: retries, RawResponse: respData, Usage: usage}
+}
+
+// readAnthropicStream assembles a streamed reply into the response the
+// non-streaming API would have returned, reporting the text or tool input
+// as it arrives. The raw data returned is that assembled response.
+func readAnthropicStream(ctx context.Context, body io.Reader) (anthropicResp, []byte, error) {
+	var ar anthropicResp
+	var partial []string // text or tool input per content block
+	done := false
+	err := readSSE(body, func(_, data string) error {
+		var ev anthropicEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return err
+		}
+		switch ev.Type {
+		case "message_start":
+			ar = ev.Message
+			ar.Content = nil
+		case "content_block_start":
+			for len(ar.Content) <= ev.Index {
+				ar.Content = append(ar.Content, anthropicContentBlock{})
+				partial = append(partial, "")
+			}
+			ar.Content[ev.Index].Type = ev.ContentBlock.Type
+			partial[ev.Index] += ev.ContentBlock.Text
+		case "content_block_delta":
+			if ev.Index >= len(partial) {
+				return fmt.Errorf("delta for unknown content block %d", ev.Index)
+			}
+			partial[ev.Index] += ev.Delta.Text + ev.Delta.PartialJSON
+			reportPartial(ctx, partial[ev.Index])
+		case "message_delta":
+			ar.Usage.OutputTokens = ev.Usage.OutputTokens
+		case "message_stop":
+			done = true
+		case "error":
+			return fmt.Errorf("stream error: %s: %s", ev.Error.Type, ev.Error.Message)
+		}
+		return nil
+	})
+	if err == nil && !done {
+		err = errors.New("stream ended before the message was complete")
+	}
+	for i := range ar.Content {
+		if ar.Content[i].Type == "tool_use" {
+			ar.Content[i].Input = json.RawMessage(partial[i])
+		} else {
+			ar.Content[i].Text = partial[i]
+		}
+	}
+	respData, _ := json.Marshal(ar)
+	return ar, respData, err
+}
+
+func (p *anthropicProvider) ModelName() string { return p.model }
+
+func (p *anthropicProvider) authorize(req *http.Request) {
+	req.Header.Set("x-api-key", p.apiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+}
+
+func (p *anthropicProvider) CheckAccess(ctx context.Context) error {
+	return probeGET(ctx, p.httpClient, anthropicModelsEndpoint, p.authorize)
+}
+
+func (p *anthropicProvider) CheckModel(ctx context.Context) error {
+	return probeGET(ctx, p.httpClient, anthropicModelsEndpoint+"/"+p.model, p.authorize)
+}
@@ -0,0 +1,36 @@
+package ai
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// newAzureProvider returns an OpenAI provider for an Azure OpenAI resource.
+// Azure serves the Responses API under /openai/v1, authenticates with an
+// api-key header, and addresses models by deployment name.
+func newAzureProvider(opts Options) (*openAIProvider, error) {
+	baseURL := strings.TrimRight(strings.TrimSpace(opts.BaseURL), "/")
+	if baseURL == "" {
+		endpoint := strings.TrimRight(strings.TrimSpace(os.Getenv("AZURE_OPENAI_ENDPOINT")), "/")
+		if endpoint == "" {
+			return nil, errors.New("AZURE_OPENAI_ENDPOINT not set")
+		}
+		baseURL = endpoint + "/openai/v1"
+	}
+	token := firstNonEmpty(opts.APIKey, os.Getenv("AZURE_OPENAI_API_KEY"))
+	if token == "" {
+		return nil, errors.New("AZURE_OPENAI_API_KEY not set")
+	}
+	if opts.Model == "" {
+		return nil, errors.New("the azure provider needs a model: pass the deployment name with -m or set model in the config")
+	}
+	return &openAIProvider{
+		baseURL:    baseURL,
+		model:      opts.Model,
+		token:      token,
+		keyHeader:  "api-key",
+		opts:       opts,
+		httpClient: newHTTPClient(opts, opts.Timeout),
+	}, nil
+}
@@ -0,0 +1,53 @@
+package ai
+
+import (
+	"context"
+)
+
+// Task is a request for shell commands.
+type Task struct {
+	// Description says what the command should do, in plain language.
+	Description string
+	// N is the number of candidate replies to ask for; less than 1 means 1.
+	N int
+}
+
+// Client generates shell commands for tasks with one provider.
+type Client struct {
+	Provider Provider
+	// Environment describes the machine the commands are for, as returned
+	// by the Environment function, and goes into every prompt.
+	Environment map[string]string
+	// Instructions are extra rules added to every prompt; may be empty.
+	Instructions string
+	// PromptBuilder, if set, builds the prompts in place of BuildPrompt,
+	// for example from a template of the user's.
+	PromptBuilder func(task string, env map[string]string, instructions string) string
+}
+
+// NewClient returns a client for the named provider (one of ProviderNames)
+// that describes the current machine to the model.
+func NewClient(provider string, opts Options) (*Client, error) {
+	p, err := NewProvider(provider, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Provider: p, Environment: Environment()}, nil
+}
+
+// Prompt returns the prompt Generate sends for t.
+func (c *Client) Prompt(t Task) string {
+	if c.PromptBuilder != nil {
+		return c.PromptBuilder(t.Description, c.Environment, c.Instructions)
+	}
+	return BuildPrompt(t.Description, c.Environment, c.Instructions)
+}
+
+// Generate asks the provider for commands for t. As with
+// Provider.GenerateCommands, the first result combines the deduplicated
+// commands of the successful calls and the rest are the individual calls;
+// it fails only when every call fails. The combined commands may be empty
+// when the model's replies contained none.
+func (c *Client) Generate(ctx context.Context, t Task) ([]Result, error) {
+	return c.Provider.GenerateCommands(ctx, c.Prompt(t), max(t.N, 1))
+}
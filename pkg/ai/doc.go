@@ -0,0 +1,20 @@
+// Package ai turns tasks described in plain language into shell commands
+// using a language model. It is the engine behind the ai command and can be
+// used by other Go programs without running the binary:
+//
+//	client, err := ai.NewClient("anthropic", ai.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	results, err := client.Generate(ctx, ai.Task{Description: "find files larger than 100MB", N: 3})
+//	if err != nil {
+//		return err
+//	}
+//	for _, cmd := range results[0].Commands {
+//		fmt.Println(cmd)
+//	}
+//
+// Providers read their API keys from the same environment variables as the
+// command, such as OPENAI_TOKEN and ANTHROPIC_API_KEY, unless
+// Options.APIKey is set. Suggested commands are never run by this package.
+package ai
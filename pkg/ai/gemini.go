@@ -0,0 +1,246 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	geminiModelsEndpoint = "https://generativelanguage.googleapis.com/v1beta/models"
+	geminiModel          = "gemini-2.5-flash"
+	// geminiMaxCandidates is the most candidates one request may ask for.
+	geminiMaxCandidates = 8
+	// geminiThinkingTokens is the room left for thinking with models that
+	// can't turn it off.
+	geminiThinkingTokens = 4096
+)
+
+type geminiReq struct {
+	Contents         []geminiContent        `json:"contents"`
+	GenerationConfig geminiGenerationConfig `json:"generationConfig"`
+}
+
+type geminiContent struct {
+	Role  string          `json:"role,omitempty"`
+	Parts []candidatePart `json:"parts"`
+}
+
+type geminiGenerationConfig struct {
+	MaxOutputTokens    int            `json:"maxOutputTokens,omitempty"`
+	CandidateCount     int            `json:"candidateCount,omitempty"`
+	Seed               *int           `json:"seed,omitempty"`
+	ThinkingConfig     map[string]any `json:"thinkingConfig,omitempty"`
+	ResponseMimeType   string         `json:"responseMimeType,omitempty"`
+	ResponseJSONSchema map[string]any `json:"responseJsonSchema,omitempty"`
+}
+
+type geminiResp struct {
+	Candidates    []candidate `json:"candidates,omitempty"`
+	ModelVersion  string      `json:"modelVersion,omitempty"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+}
+
+type candidate struct {
+	Index   int              `json:"index,omitempty"`
+	Content candidateContent `json:"content"`
+}
+
+type candidateContent struct {
+	Type  string          `json:"type,omitempty"`
+	Parts []candidatePart `json:"parts,omitempty"`
+}
+
+type candidatePart struct {
+	Type string `json:"type,omitempty"`
+	Text string `json:"text,omitempty"`
+}
+
+// candidateTexts returns the non-empty text parts of Gemini-style candidates.
+func candidateTexts(cands []candidate) []string {
+	var out []string
+	for _, c := range cands {
+		for _, p := range c.Content.Parts {
+			if strings.TrimSpace(p.Text) != "" {
+				out = append(out, p.Text)
+			}
+		}
+	}
+	return out
+}
+
+// geminiProvider talks to the Google Generative Language API.
+type geminiProvider struct {
+	apiKey     string
+	model      string
+	opts       Options
+	httpClient *http.Client
+}
+
+func newGeminiProvider(opts Options) (*geminiProvider, error) {
+	if opts.Tools {
+		return nil, errors.New("tools are only supported by the openai and azure providers")
+	}
+	apiKey := firstNonEmpty(opts.APIKey, os.Getenv("GEMINI_API_KEY"))
+	if apiKey == "" {
+		return nil, errors.New("GEMINI_API_KEY not set")
+	}
+	return &geminiProvider{apiKey: apiKey, model: firstNonEmpty(opts.Model, geminiModel), opts: opts, httpClient: newHTTPClient(opts, opts.Timeout)}, nil
+}
+
+func (p *geminiProvider) GenerateCommands(ctx context.Context, prompt string, n int) ([]Result, error) {
+	// Gemini returns several sampled candidates per request, so -n costs
+	// one call unless it exceeds what a single request allows.
+	return fanOutBatched(ctx, n, geminiMaxCandidates, p.opts, func(ctx context.Context, count int) Result {
+		return p.call(ctx, prompt, true, count)
+	})
+}
+
+func (p *geminiProvider) Complete(ctx context.Context, prompt string) (Result, error) {
+	return completeOnce(p.call(ctx, prompt, false, 1))
+}
+
+// geminiCanSkipThinking reports whether model accepts a thinking budget of
+// 0, as the gemini-2.5-flash family does.
+func geminiCanSkipThinking(model string) bool {
+	return strings.HasPrefix(model, "gemini-2.5-flash")
+}
+
+// call makes one API call asking for count candidates. With structured set,
+// the reply is requested as JSON following commandSchema.
+func (p *geminiProvider) call(ctx context.Context, prompt string, structured bool, count int) Result {
+	startTime := time.Now()
+
+	reqBody := geminiReq{
+		Contents: []geminiContent{{Role: "user", Parts: []candidatePart{{Text: prompt}}}},
+		GenerationConfig: geminiGenerationConfig{
+			MaxOutputTokens: 500,
+			Seed:            p.opts.Seed,
+		},
+	}
+	// Thinking tokens count against maxOutputTokens, and a command rarely
+	// needs them. Models that can't turn thinking off, such as
+	// gemini-2.5-pro, reject a zero budget, so they get room for it instead.
+	if geminiCanSkipThinking(p.model) {
+		reqBody.GenerationConfig.ThinkingConfig = map[string]any{"thinkingBudget": 0}
+	} else {
+		reqBody.GenerationConfig.MaxOutputTokens += geminiThinkingTokens
+	}
+	if count > 1 {
+		reqBody.GenerationConfig.CandidateCount = count
+	}
+	if structured {
+		reqBody.GenerationConfig.ResponseMimeType = "application/json"
+		reqBody.GenerationConfig.ResponseJSONSchema = commandSchema
+	}
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return Result{Error: err, Duration: time.Since(startTime)}
+	}
+	stream := streaming(ctx)
+	url := geminiModelsEndpoint + "/" + p.model + ":generateContent"
+	if stream {
+		url = geminiModelsEndpoint + "/" + p.model + ":streamGenerateContent?alt=sse"
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	if err != nil {
+		return Result{Error: err, Duration: time.Since(startTime)}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	p.authorize(httpReq)
+
+	resp, retries, err := doWithRetry(ctx, p.httpClient, httpReq)
+	if err != nil {
+		return Result{Error: err, Duration: time.Since(startTime), Retries: retries}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var gr geminiResp
+	var respData []byte
+	if resp.StatusCode < 400 && stream {
+		gr, respData, err = readGeminiStream(ctx, resp.Body)
+		if err != nil {
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries, RawResponse: respData}
+		}
+	} else {
+		respData, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries}
+		}
+
+		if resp.StatusCode >= 400 {
+			err := &statusError{code: resp.StatusCode, body: string(respData)}
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries, RawResponse: respData}
+		}
+
+		if err := json.Unmarshal(respData, &gr); err != nil {
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries, RawResponse: respData}
+		}
+	}
+
+	usage := Usage{
+		InputTokens:  gr.UsageMetadata.PromptTokenCount,
+		OutputTokens: gr.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:  gr.UsageMetadata.TotalTokenCount,
+	}
+	candidates := candidateTexts(gr.Candidates)
+	return Result{Model: firstNonEmpty(gr.ModelVersion, p.model), Text: strings.Join(candidates, "\n"), Commands: commandsFromCandidates(candidates), Duration: time.Since(startTime), Retries: retries, RawResponse: respData, Usage: usage}
+}
+
+// readGeminiStream joins the chunks of a streamed reply into the response
+// generateContent would have returned, reporting each candidate's text as it
+// arrives. The raw data returned is that joined response.
+func readGeminiStream(ctx context.Context, body io.Reader) (geminiResp, []byte, error) {
+	var gr geminiResp
+	texts := map[int]string{}
+	err := readSSE(body, func(_, data string) error {
+		var chunk geminiResp
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return err
+		}
+		gr.ModelVersion = firstNonEmpty(chunk.ModelVersion, gr.ModelVersion)
+		if chunk.UsageMetadata.TotalTokenCount > 0 {
+			gr.UsageMetadata = chunk.UsageMetadata
+		}
+		for _, c := range chunk.Candidates {
+			for _, part := range c.Content.Parts {
+				texts[c.Index] += part.Text
+			}
+			// Number the candidates apart from those of other batched calls.
+			id := callIndex(ctx)*geminiMaxCandidates + c.Index
+			reportPartial(withCallIndex(ctx, id), texts[c.Index])
+		}
+		return nil
+	})
+	for _, i := range slices.Sorted(maps.Keys(texts)) {
+		gr.Candidates = append(gr.Candidates, candidate{Index: i, Content: candidateContent{Parts: []candidatePart{{Text: texts[i]}}}})
+	}
+	respData, _ := json.Marshal(gr)
+	return gr, respData, err
+}
+
+func (p *geminiProvider) ModelName() string { return p.model }
+
+func (p *geminiProvider) authorize(req *http.Request) {
+	req.Header.Set("x-goog-api-key", p.apiKey)
+}
+
+func (p *geminiProvider) CheckAccess(ctx context.Context) error {
+	return probeGET(ctx, p.httpClient, geminiModelsEndpoint, p.authorize)
+}
+
+func (p *geminiProvider) CheckModel(ctx context.Context) error {
+	return probeGET(ctx, p.httpClient, geminiModelsEndpoint+"/"+p.model, p.authorize)
+}
@@ -0,0 +1,62 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+type loggerKey struct{}
+
+// discardLogger is used when the caller asked for no logging.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// WithLogger returns a context asking providers to log the API calls made
+// with it to l: every HTTP exchange and retry at debug level, and at info
+// level the outcome of each call, tagged with its number among the
+// concurrent calls and the request ID the provider assigned to it.
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// logger returns the logger set by WithLogger, or one that discards.
+func logger(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return discardLogger
+}
+
+// requestIDHeaders are the response headers providers put their request
+// IDs in, for quoting in support requests.
+var requestIDHeaders = []string{"x-request-id", "request-id", "apim-request-id"}
+
+// requestID returns the provider's ID for the request answered by h, or "".
+func requestID(h http.Header) string {
+	for _, name := range requestIDHeaders {
+		if id := h.Get(name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// logCall logs the outcome of one of the concurrent calls of a request.
+func logCall(l *slog.Logger, r Result) {
+	switch {
+	case errors.Is(r.Error, context.Canceled):
+		l.Debug("call cancelled", "elapsed", r.Duration)
+	case r.Error != nil:
+		l.Warn("call failed", "error", r.Error, "elapsed", r.Duration, "retries", r.Retries)
+	default:
+		l.Info("call finished", "model", r.Model, "elapsed", r.Duration, "commands", len(r.Commands), "retries", r.Retries,
+			"input_tokens", r.Usage.InputTokens, "output_tokens", r.Usage.OutputTokens)
+	}
+	if reply := r.Declined(); reply != "" {
+		l.Info("no command in reply", "reply", reply)
+	}
+	if len(r.RawResponse) > 0 {
+		l.Debug("raw response", "body", r.RawResponse)
+	}
+}
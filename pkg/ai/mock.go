@@ -0,0 +1,245 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mockModel is the model name reported by the mock provider.
+const mockModel = "mock"
+
+// Fixture holds canned replies for the mock provider, as read from the file
+// in AI_FIXTURE and written by a Recorder.
+type Fixture struct {
+	Responses []FixtureResponse `json:"responses"`
+}
+
+// FixtureResponse is the reply to the prompts it matches: the prompt equal
+// to Prompt, or else any prompt containing Match. An entry with neither
+// matches every prompt.
+type FixtureResponse struct {
+	Prompt string `json:"prompt,omitempty"`
+	Match  string `json:"match,omitempty"`
+	// Replies are raw model replies, one per call, reused in turn when more
+	// calls are made. They are parsed like those of a real model, so they
+	// may be plain commands or structured JSON.
+	Replies []string `json:"replies"`
+	Model   string   `json:"model,omitempty"`
+	Usage   Usage    `json:"usage,omitzero"` // per call
+}
+
+// mockProvider answers from a fixture, or with placeholder commands when
+// there is none, without any network access.
+type mockProvider struct {
+	path    string
+	fixture Fixture
+	opts    Options
+}
+
+// newMockProvider returns the mock provider, serving the fixture named by
+// AI_FIXTURE if set.
+func newMockProvider(opts Options) (*mockProvider, error) {
+	p := &mockProvider{path: os.Getenv("AI_FIXTURE"), opts: opts}
+	if p.path == "" {
+		return p, nil
+	}
+	f, err := readFixture(p.path)
+	if err != nil {
+		return nil, err
+	}
+	p.fixture = f
+	return p, nil
+}
+
+// readFixture reads a fixture file.
+func readFixture(path string) (Fixture, error) {
+	var f Fixture
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return f, nil
+}
+
+func (p *mockProvider) GenerateCommands(ctx context.Context, prompt string, n int) ([]Result, error) {
+	return fanOut(ctx, n, p.opts, func(ctx context.Context) Result {
+		return p.call(ctx, prompt, true)
+	})
+}
+
+func (p *mockProvider) Complete(ctx context.Context, prompt string) (Result, error) {
+	return completeOnce(p.call(ctx, prompt, false))
+}
+
+// call serves the reply for the call numbered by ctx.
+func (p *mockProvider) call(ctx context.Context, prompt string, commands bool) Result {
+	startTime := time.Now()
+	if err := ctx.Err(); err != nil {
+		return Result{Model: mockModel, Error: err}
+	}
+	i := callIndex(ctx)
+
+	var r FixtureResponse
+	switch {
+	case p.path != "":
+		var ok bool
+		if r, ok = p.fixture.lookup(prompt); !ok {
+			return Result{Model: mockModel, Error: fmt.Errorf("no response in %s matches the prompt", p.path), Duration: time.Since(startTime)}
+		}
+	case commands:
+		r.Replies = []string{fmt.Sprintf("echo 'mock suggestion %d'", i+1)}
+	default:
+		r.Replies = []string{"This is a mock reply."}
+	}
+	if len(r.Replies) == 0 {
+		return Result{Model: mockModel, Error: errors.New("fixture response has no replies"), Duration: time.Since(startTime)}
+	}
+
+	reply := r.Replies[i%len(r.Replies)]
+	reportPartial(ctx, reply)
+	res := Result{Model: firstNonEmpty(r.Model, mockModel), Text: reply, Duration: time.Since(startTime), Usage: r.Usage}
+	if commands {
+		res.Commands = commandsFromCandidates([]string{reply})
+	}
+	return res
+}
+
+// lookup returns the response for prompt: an exact match first, then the
+// first entry whose Match or lack of both keys fits.
+func (f Fixture) lookup(prompt string) (FixtureResponse, bool) {
+	for _, r := range f.Responses {
+		if r.Prompt != "" && r.Prompt == prompt {
+			return r, true
+		}
+	}
+	for _, r := range f.Responses {
+		if r.Prompt == "" && strings.Contains(prompt, r.Match) {
+			return r, true
+		}
+	}
+	return FixtureResponse{}, false
+}
+
+func (p *mockProvider) ModelName() string { return mockModel }
+
+func (p *mockProvider) CheckAccess(context.Context) error {
+	if p.path == "" {
+		return nil
+	}
+	_, err := readFixture(p.path)
+	return err
+}
+
+func (p *mockProvider) CheckModel(context.Context) error { return nil }
+
+// Recorder wraps a provider and saves each prompt with the replies it got
+// to a fixture file, so the mock provider can replay them later. Existing
+// responses for the same prompt are replaced. Failing to save doesn't fail
+// the request: the error goes to OnSaveError, or is logged if that is nil.
+type Recorder struct {
+	Provider
+	OnSaveError func(error)
+	path        string
+	mu          sync.Mutex
+}
+
+// NewRecorder returns a Recorder saving the replies of p to the fixture at
+// path.
+func NewRecorder(p Provider, path string) *Recorder {
+	return &Recorder{Provider: p, path: path}
+}
+
+func (r *Recorder) GenerateCommands(ctx context.Context, prompt string, n int) ([]Result, error) {
+	results, err := r.Provider.GenerateCommands(ctx, prompt, n)
+	if err != nil {
+		return results, err
+	}
+	var replies []string
+	var usage Usage
+	for _, c := range results[1:] {
+		if c.Error == nil {
+			replies = append(replies, c.Text)
+			usage = c.Usage
+		}
+	}
+	r.record(ctx, FixtureResponse{Prompt: prompt, Replies: replies, Model: results[0].Model, Usage: usage})
+	return results, nil
+}
+
+func (r *Recorder) Complete(ctx context.Context, prompt string) (Result, error) {
+	result, err := r.Provider.Complete(ctx, prompt)
+	if err != nil {
+		return result, err
+	}
+	r.record(ctx, FixtureResponse{Prompt: prompt, Replies: []string{result.Text}, Model: result.Model, Usage: result.Usage})
+	return result, nil
+}
+
+// record saves resp, reporting a failure to save it.
+func (r *Recorder) record(ctx context.Context, resp FixtureResponse) {
+	err := r.save(resp)
+	switch {
+	case err == nil:
+	case r.OnSaveError != nil:
+		r.OnSaveError(err)
+	default:
+		logger(ctx).Warn("could not record replies", "fixture", r.path, "error", err)
+	}
+}
+
+// save adds resp to the fixture file.
+func (r *Recorder) save(resp FixtureResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := readFixture(r.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	replaced := false
+	for i, old := range f.Responses {
+		if old.Prompt == resp.Prompt {
+			f.Responses[i], replaced = resp, true
+		}
+	}
+	if !replaced {
+		f.Responses = append(f.Responses, resp)
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(r.path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("record fixture: %w", err)
+	}
+	return nil
+}
+
+func (r *Recorder) ModelName() string {
+	if c, ok := r.Provider.(Checker); ok {
+		return c.ModelName()
+	}
+	return ""
+}
+
+func (r *Recorder) CheckAccess(ctx context.Context) error {
+	if c, ok := r.Provider.(Checker); ok {
+		return c.CheckAccess(ctx)
+	}
+	return nil
+}
+
+func (r *Recorder) CheckModel(ctx context.Context) error {
+	if c, ok := r.Provider.(Checker); ok {
+		return c.CheckModel(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ollamaDefaultHost  = "http://127.0.0.1:11434"
+	ollamaDefaultModel = "llama3"
+	// ollamaTimeout is longer than requestTimeout because the first request
+	// after startup has to load the model into memory.
+	ollamaTimeout = 2 * time.Minute
+)
+
+type ollamaReq struct {
+	Model   string         `json:"model"`
+	Prompt  string         `json:"prompt"`
+	Stream  bool           `json:"stream"`
+	Format  map[string]any `json:"format,omitempty"` // JSON schema for the reply
+	Options map[string]any `json:"options,omitempty"`
+}
+
+type ollamaResp struct {
+	Model           string `json:"model"`
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+// ollamaProvider talks to a local Ollama server; no API key is needed.
+type ollamaProvider struct {
+	host       string
+	model      string
+	opts       Options
+	httpClient *http.Client
+}
+
+func newOllamaProvider(opts Options) (*ollamaProvider, error) {
+	if opts.Tools {
+		return nil, errors.New("tools are only supported by the openai and azure providers")
+	}
+	model := firstNonEmpty(opts.Model, os.Getenv("OLLAMA_MODEL"), ollamaDefaultModel)
+	return &ollamaProvider{
+		host:       ollamaHost(),
+		model:      model,
+		opts:       opts,
+		httpClient: newHTTPClient(opts, cmp.Or(opts.Timeout, ollamaTimeout)),
+	}, nil
+}
+
+// ollamaHost returns the server URL from OLLAMA_HOST, which like the ollama
+// CLI may omit the scheme.
+func ollamaHost() string {
+	host := strings.TrimSpace(os.Getenv("OLLAMA_HOST"))
+	if host == "" {
+		return ollamaDefaultHost
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimRight(host, "/")
+}
+
+func (p *ollamaProvider) GenerateCommands(ctx context.Context, prompt string, n int) ([]Result, error) {
+	return fanOut(ctx, n, p.opts, func(ctx context.Context) Result {
+		return p.call(ctx, prompt, true)
+	})
+}
+
+func (p *ollamaProvider) Complete(ctx context.Context, prompt string) (Result, error) {
+	return completeOnce(p.call(ctx, prompt, false))
+}
+
+// call makes one API call. With structured set, the reply is constrained to
+// JSON following commandSchema.
+func (p *ollamaProvider) call(ctx context.Context, prompt string, structured bool) Result {
+	startTime := time.Now()
+
+	options := map[string]any{"num_predict": 500}
+	if p.opts.Seed != nil {
+		options["seed"] = *p.opts.Seed
+	}
+	req := ollamaReq{Model: p.model, Prompt: prompt, Stream: streaming(ctx), Options: options}
+	if structured {
+		req.Format = commandSchema
+	}
+	b, err := json.Marshal(req)
+	if err != nil {
+		return Result{Error: err, Duration: time.Since(startTime)}
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.host+"/api/generate", bytes.NewReader(b))
+	if err != nil {
+		return Result{Error: err, Duration: time.Since(startTime)}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, retries, err := doWithRetry(ctx, p.httpClient, httpReq)
+	if err != nil {
+		return Result{Error: fmt.Errorf("%w (is ollama running?)", err), Duration: time.Since(startTime), Retries: retries}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var or ollamaResp
+	var respData []byte
+	if resp.StatusCode < 400 && req.Stream {
+		or, respData, err = readOllamaStream(ctx, resp.Body)
+		if err != nil {
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries, RawResponse: respData}
+		}
+	} else {
+		respData, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries}
+		}
+
+		if resp.StatusCode >= 400 {
+			err := &statusError{code: resp.StatusCode, body: string(respData)}
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries, RawResponse: respData}
+		}
+
+		if err := json.Unmarshal(respData, &or); err != nil {
+			return Result{Error: err, Duration: time.Since(startTime), Retries: retries, RawResponse: respData}
+		}
+	}
+
+	usage := Usage{
+		InputTokens:  or.PromptEvalCount,
+		OutputTokens: or.EvalCount,
+		TotalTokens:  or.PromptEvalCount + or.EvalCount,
+	}
+	var candidates []string
+	if strings.TrimSpace(or.Response) != "" {
+		candidates = append(candidates, or.Response)
+	}
+	return Result{Model: firstNonEmpty(or.Model, p.model), Text: strings.Join(candidates, "\n"), Commands: commandsFromCandidates(candidates), Duration: time.Since(startTime), Retries: retries, RawResponse: respData, Usage: usage}
+}
+
+// readOllamaStream joins a streamed reply, one JSON object per line, into
+// the response a non-streaming request would have returned, reporting the
+// text as it arrives. The raw data returned is that joined response.
+func readOllamaStream(ctx context.Context, body io.Reader) (ollamaResp, []byte, error) {
+	var or ollamaResp
+	var text strings.Builder
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 0, 64*1024), maxSSELine)
+	for sc.Scan() && !or.Done {
+		var chunk struct {
+			ollamaResp
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(sc.Bytes(), &chunk); err != nil {
+			return or, nil, err
+		}
+		if chunk.Error != "" {
+			return or, nil, errors.New(chunk.Error)
+		}
+		text.WriteString(chunk.Response)
+		reportPartial(ctx, text.String())
+		or = chunk.ollamaResp
+	}
+	if err := sc.Err(); err != nil {
+		return or, nil, err
+	}
+	or.Response = text.String()
+	respData, _ := json.Marshal(or)
+	if !or.Done {
+		return or, respData, errors.New("stream ended before the reply was complete")
+	}
+	return or, respData, nil
+}
+
+func (p *ollamaProvider) ModelName() string { return p.model }
+
+func (p *ollamaProvider) CheckAccess(ctx context.Context) error {
+	return probeGET(ctx, p.httpClient, p.host+"/api/tags", func(*http.Request) {})
+}
+
+// CheckModel looks the model up in the list of locally pulled models.
+func (p *ollamaProvider) CheckModel(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.host+"/api/tags", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach ollama: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return err
+	}
+	for _, m := range tags.Models {
+		if m.Name == p.model || m.Name == p.model+":latest" {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %s not pulled; run: ollama pull %s", p.model, p.model)
+}
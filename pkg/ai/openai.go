@@ -0,0 +1,295 @@
+package ai
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	openAIBaseURL = "https://api.openai.com/v1"
+	openAIModel   = "gpt-5.4"
+)
+
+type responseReq struct {
+	Model              string         `json:"model"`
+	Input              any            `json:"input"`
+	MaxOutput          int            `json:"max_output_tokens,omitempty"`
+	Text               map[string]any `json:"text,omitempty"`
+	Reasoning          map[string]any `json:"reasoning,omitempty"`
+	Tools              []toolDef      `json:"tools,omitempty"`
+	PreviousResponseID string         `json:"previous_response_id,omitempty"`
+	Stream             bool           `json:"stream,omitempty"`
+}
+
+type responseResp struct {
+	ID         string       `json:"id"`
+	Object     string       `json:"object"`
+	Created    int64        `json:"created"`
+	Model      string       `json:"model"`
+	Output     []outputItem `json:"output,omitempty"`
+	OutputText string       `json:"output_text,omitempty"`
+	Candidates []candidate  `json:"candidates,omitempty"`
+	Usage      Usage        `json:"usage"`
+}
+
+type outputItem struct {
+	Type      string        `json:"type,omitempty"`
+	Text      string        `json:"text,omitempty"`
+	Content   []contentPart `json:"content,omitempty"`
+	Role      string        `json:"role,omitempty"`
+	CallID    string        `json:"call_id,omitempty"`
+	Name      string        `json:"name,omitempty"`
+	Arguments string        `json:"arguments,omitempty"`
+}
+
+type contentPart struct {
+	Type    string `json:"type,omitempty"`
+	Text    string `json:"text,omitempty"`
+	Refusal string `json:"refusal,omitempty"` // set instead of Text when the model declines
+}
+
+// openAIProvider talks to the OpenAI responses API, or to any server
+// implementing it (LiteLLM, OpenRouter, LM Studio, llama.cpp) via AI_BASE_URL.
+type openAIProvider struct {
+	baseURL    string
+	model      string
+	token      string
+	keyHeader  string // header carrying the token; empty sends it as a bearer token
+	opts       Options
+	httpClient *http.Client
+}
+
+func newOpenAIProvider(opts Options) (*openAIProvider, error) {
+	baseURL := strings.TrimRight(strings.TrimSpace(opts.BaseURL), "/")
+	token := firstNonEmpty(opts.APIKey, os.Getenv("OPENAI_TOKEN"))
+	// Gateways and local servers often need no key, so a token is only
+	// mandatory for the official endpoint.
+	if baseURL == "" {
+		baseURL = openAIBaseURL
+		if token == "" {
+			return nil, errors.New("OPENAI_TOKEN not set")
+		}
+	}
+	return &openAIProvider{baseURL: baseURL, model: firstNonEmpty(opts.Model, openAIModel), token: token, opts: opts, httpClient: newHTTPClient(opts, opts.Timeout)}, nil
+}
+
+func (p *openAIProvider) GenerateCommands(ctx context.Context, prompt string, n int) ([]Result, error) {
+	return fanOut(ctx, n, p.opts, func(ctx context.Context) Result {
+		return p.call(ctx, prompt, true)
+	})
+}
+
+func (p *openAIProvider) Complete(ctx context.Context, prompt string) (Result, error) {
+	return completeOnce(p.call(ctx, prompt, false))
+}
+
+// call makes one logical API call, following tool-call round trips when
+// tools are enabled. With structured set, the reply is requested as JSON
+// following commandSchema.
+func (p *openAIProvider) call(ctx context.Context, prompt string, structured bool) Result {
+	startTime := time.Now()
+
+	format := map[string]any{"type": "text"}
+	if structured {
+		format = map[string]any{"type": "json_schema", "name": "shell_commands", "schema": commandSchema, "strict": true}
+	}
+	reqBody := responseReq{
+		Model:     p.model,
+		Input:     prompt,
+		MaxOutput: 500,
+		Text:      map[string]any{"format": format},
+		Reasoning: map[string]any{
+			"effort": "none",
+		},
+	}
+	if p.opts.Tools {
+		reqBody.Tools = localTools
+	}
+
+	var rr responseResp
+	var respData []byte
+	var usage Usage
+	var retries int
+	for round := 0; ; round++ {
+		var err error
+		var r int
+		rr, respData, r, err = p.postResponse(ctx, reqBody)
+		usage = usage.Add(rr.Usage)
+		retries += r
+		var se *statusError
+		if structured && round == 0 && p.baseURL != openAIBaseURL && errors.As(err, &se) && se.code == http.StatusBadRequest {
+			// Not every OpenAI-compatible server supports json_schema;
+			// ask again for plain text.
+			reqBody.Text = map[string]any{"format": map[string]any{"type": "text"}}
+			rr, respData, r, err = p.postResponse(ctx, reqBody)
+			usage = usage.Add(rr.Usage)
+			retries += r
+		}
+		if err != nil {
+			return Result{Model: p.model, Error: err, Duration: time.Since(startTime), Retries: retries, RawResponse: respData, Usage: usage}
+		}
+		calls := functionCalls(rr)
+		if len(calls) == 0 {
+			break
+		}
+		if round >= maxToolRounds {
+			err := fmt.Errorf("model requested tools for more than %d rounds", maxToolRounds)
+			return Result{Model: p.model, Error: err, Duration: time.Since(startTime), Retries: retries, RawResponse: respData, Usage: usage}
+		}
+		// Answer the tool calls in a follow-up request chained to this response.
+		outputs := make([]functionCallOutput, 0, len(calls))
+		for _, call := range calls {
+			outputs = append(outputs, functionCallOutput{
+				Type:   "function_call_output",
+				CallID: call.CallID,
+				Output: runLocalTool(call.Name, call.Arguments),
+			})
+		}
+		reqBody.Input = outputs
+		reqBody.PreviousResponseID = rr.ID
+	}
+
+	candidates := extractCandidates(rr)
+	return Result{Model: firstNonEmpty(rr.Model, p.model), Text: strings.Join(candidates, "\n"), Commands: commandsFromCandidates(candidates), Duration: time.Since(startTime), Retries: retries, RawResponse: respData, Usage: usage}
+}
+
+func (p *openAIProvider) ModelName() string { return p.model }
+
+// postResponse sends one request to the responses endpoint and decodes the reply.
+// The raw body is returned whenever one was read, even alongside an error,
+// together with the number of retries it took.
+func (p *openAIProvider) postResponse(ctx context.Context, reqBody responseReq) (responseResp, []byte, int, error) {
+	var rr responseResp
+	reqBody.Stream = streaming(ctx)
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return rr, nil, 0, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.baseURL+"/responses", bytes.NewReader(b))
+	if err != nil {
+		return rr, nil, 0, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	p.authorize(httpReq)
+
+	resp, retries, err := doWithRetry(ctx, p.httpClient, httpReq)
+	if err != nil {
+		return rr, nil, retries, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 400 && reqBody.Stream {
+		streamed, data, err := readResponseStream(ctx, resp.Body)
+		return streamed, data, retries, err
+	}
+
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return rr, nil, retries, err
+	}
+
+	if resp.StatusCode >= 400 {
+		return rr, respData, retries, &statusError{code: resp.StatusCode, body: string(respData)}
+	}
+
+	if err := json.Unmarshal(respData, &rr); err != nil {
+		return rr, respData, retries, err
+	}
+	return rr, respData, retries, nil
+}
+
+// responseEvent is one event of a streamed responses API reply.
+type responseEvent struct {
+	Type     string          `json:"type"`
+	Delta    string          `json:"delta,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Message  string          `json:"message,omitempty"`
+}
+
+// readResponseStream reads a streamed reply, reporting the output text as it
+// arrives, and returns the final response like postResponse does.
+func readResponseStream(ctx context.Context, body io.Reader) (responseResp, []byte, error) {
+	var rr responseResp
+	var respData []byte
+	var text strings.Builder
+	err := readSSE(body, func(_, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+		var ev responseEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return err
+		}
+		switch ev.Type {
+		case "response.output_text.delta":
+			text.WriteString(ev.Delta)
+			reportPartial(ctx, text.String())
+		case "response.completed", "response.incomplete", "response.failed":
+			respData = ev.Response
+			if err := json.Unmarshal(ev.Response, &rr); err != nil {
+				return err
+			}
+			if ev.Type == "response.failed" {
+				return fmt.Errorf("response failed: %s", ev.Response)
+			}
+		case "error":
+			return fmt.Errorf("stream error: %s", firstNonEmpty(ev.Message, data))
+		}
+		return nil
+	})
+	if err != nil {
+		return rr, respData, err
+	}
+	if respData == nil {
+		return rr, nil, errors.New("stream ended before the response was complete")
+	}
+	return rr, respData, nil
+}
+
+func (p *openAIProvider) authorize(req *http.Request) {
+	switch {
+	case p.token == "":
+	case p.keyHeader != "":
+		req.Header.Set(p.keyHeader, p.token)
+	default:
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+}
+
+func (p *openAIProvider) CheckAccess(ctx context.Context) error {
+	return probeGET(ctx, p.httpClient, p.baseURL+"/models", p.authorize)
+}
+
+func (p *openAIProvider) CheckModel(ctx context.Context) error {
+	return probeGET(ctx, p.httpClient, p.baseURL+"/models/"+p.model, p.authorize)
+}
+
+func extractCandidates(rr responseResp) []string {
+	out := candidateTexts(rr.Candidates)
+	if len(out) == 0 && rr.OutputText != "" {
+		out = append(out, rr.OutputText)
+	}
+	if len(out) == 0 {
+		for _, it := range rr.Output {
+			if strings.TrimSpace(it.Text) != "" {
+				out = append(out, it.Text)
+			} else if len(it.Content) > 0 {
+				for _, part := range it.Content {
+					if text := cmp.Or(part.Text, part.Refusal); strings.TrimSpace(text) != "" {
+						out = append(out, text)
+					}
+				}
+			}
+		}
+	}
+	return out
+}
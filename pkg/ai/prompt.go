@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"fmt"
+	"maps"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Environment describes the machine commands are generated for: its OS,
+// architecture, shell, distribution and version, which flavor of the core
+// utilities it has, and whether it is a container, WSL or a virtual
+// machine. Callers may add entries of their own before passing it to
+// BuildPrompt.
+func Environment() map[string]string {
+	return map[string]string{
+		"os":             runtime.GOOS,
+		"arch":           runtime.GOARCH,
+		"shell":          DefaultShell(),
+		"safe_mode":      "on",
+		"system":         readSystemInfo(),
+		"coreutils":      coreutilsFlavor(),
+		"virtualization": detectVirtualization(),
+	}
+}
+
+// BuildPrompt assembles the prompt asking for a command for task in the
+// environment env; extra holds user-supplied instructions and may be empty.
+func BuildPrompt(task string, env map[string]string, extra string) string {
+	var b strings.Builder
+	b.WriteString("You are a shell command generator.\n")
+	b.WriteString("Suggest exactly one safe command for " + ShellDialect(env["shell"]) + "\n")
+	b.WriteString("Rules:\n")
+	b.WriteString("- Keep the command to one line, unless the task needs a loop, conditional or here-document; then give the whole block over several lines.\n")
+	b.WriteString("- No text around the command. If the reply format has fields for a risk level or an explanation, fill them in; otherwise reply with the command only.\n")
+	switch DialectOf(env["shell"]) {
+	case DialectPowerShell:
+		b.WriteString("- Use PowerShell syntax and quoting, not POSIX shell syntax.\n")
+		b.WriteString("- Avoid destructive actions (Remove-Item -Recurse -Force, Format-Volume, Stop-Computer, moving/deleting) unless explicitly requested.\n")
+		b.WriteString("- Prefer read-only queries (Get-ChildItem/Get-Item/Select-String) when unsure.\n")
+		b.WriteString("- Use cmdlets and utilities available on Windows.\n")
+	case DialectNushell:
+		b.WriteString("- Use Nushell syntax and its structured-data commands (ls, where, sort-by, get, open), not POSIX shell syntax.\n")
+		b.WriteString("- Avoid destructive actions (rm -r, sudo, moving/deleting) unless explicitly requested.\n")
+		b.WriteString("- Prefer read-only queries (ls/open/where/du) when unsure.\n")
+	case DialectXonsh:
+		b.WriteString("- Use xonsh syntax: subprocess commands as in bash, Python expressions where they help.\n")
+		b.WriteString("- Avoid destructive actions (rm -rf, chmod -R, sudo, moving/deleting) unless explicitly requested.\n")
+		b.WriteString("- Prefer read-only queries (ls/find/stat/du/grep) when unsure.\n")
+		b.WriteString("- Use utilities commonly available on Linux/macOS.\n")
+	default:
+		b.WriteString("- Avoid destructive actions (rm -rf, chmod -R, sudo, moving/deleting) unless explicitly requested.\n")
+		b.WriteString("- Prefer read-only queries (ls/find/stat/du/grep) when unsure.\n")
+		b.WriteString("- Use utilities commonly available on Linux/macOS.\n")
+	}
+	b.WriteString("- Must run correctly in the current working directory.\n")
+	b.WriteString("- If paths contain spaces, quote them safely.\n")
+	b.WriteString("- If the task is ambiguous, choose the safest widely useful command.\n")
+	b.WriteString("- If the command needs a value that neither the task nor the environment gives (a file name, port, host), write a placeholder in angle brackets with an uppercase name, like <FILENAME> or <PORT>, instead of guessing.\n")
+	switch env["coreutils"] {
+	case "BSD":
+		b.WriteString("- The core utilities are the BSD ones: use their flags (such as sed -i '' and stat -f), not GNU-only ones.\n")
+	case "BusyBox":
+		b.WriteString("- The core utilities are BusyBox applets: use only the basic flags they support.\n")
+	}
+	switch v := env["virtualization"]; {
+	case strings.Contains(v, "container"):
+		b.WriteString("- This runs inside a container, which usually has no systemd, desktop or browser; don't rely on them.\n")
+	case strings.HasPrefix(v, "WSL"):
+		b.WriteString("- This runs in WSL: open files and URLs with explorer.exe or wslview rather than xdg-open, and the Windows drives are under /mnt.\n")
+	}
+	if tools := env["frequently_used_tools"]; tools != "" {
+		b.WriteString("- The user commonly uses: " + tools + ". Prefer these tools when they fit the task.\n")
+	}
+	if tools := env["tools_installed"]; tools != "" {
+		b.WriteString("- These tools are installed, so you can rely on them: " + tools + ".\n")
+	}
+	if tools := env["tools_not_installed"]; tools != "" {
+		b.WriteString("- These tools are not installed, so don't use them: " + tools + ".\n")
+	}
+	WritePreferences(&b, env)
+	if extra = strings.TrimSpace(extra); extra != "" {
+		b.WriteString("\nAdditional instructions:\n")
+		b.WriteString(extra)
+		b.WriteString("\n")
+	}
+	WriteEnvironment(&b, env)
+	b.WriteString("\nTask:\n")
+	b.WriteString(task)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// WritePreferences adds the user's preferences, the "user_preferences"
+// entry of env such as "rg over grep; long flags", to the rules of a prompt.
+func WritePreferences(b *strings.Builder, env map[string]string) {
+	if prefs := env["user_preferences"]; prefs != "" {
+		b.WriteString("- The user prefers: " + prefs + ". Follow these preferences whenever they fit the task and the tools they name are installed, even over more portable choices.\n")
+	}
+}
+
+// WriteEnvironment adds the environment context section to a prompt.
+func WriteEnvironment(b *strings.Builder, env map[string]string) {
+	b.WriteString("\nEnvironment context:\n")
+	// Sorted so the same task and environment always yield the same prompt.
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		v := env[k]
+		if v == "" || k == "frequently_used_tools" || k == "tools_installed" || k == "tools_not_installed" || k == "user_preferences" {
+			continue
+		}
+		fmt.Fprintf(b, "- %s: %s\n", k, v)
+	}
+}
@@ -0,0 +1,420 @@
+package ai
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTimeout bounds each individual HTTP request to a provider unless
+// Options.Timeout says otherwise.
+const requestTimeout = 30 * time.Second
+
+// Provider generates shell command suggestions from a prompt.
+type Provider interface {
+	// GenerateCommands asks for n candidate replies to prompt, in a single
+	// call when the provider can return several candidates at once and in
+	// concurrent calls otherwise. The first result combines the deduplicated
+	// commands of the successful calls; the rest are the individual calls in
+	// completion order, including failed ones. It fails only when every call
+	// fails.
+	GenerateCommands(ctx context.Context, prompt string, n int) ([]Result, error)
+	// Complete makes a single call for prompt and returns the model's reply
+	// in Text, for prompts that expect prose rather than a command.
+	Complete(ctx context.Context, prompt string) (Result, error)
+}
+
+// Checker is implemented by providers that `ai doctor` can probe.
+type Checker interface {
+	// ModelName returns the model requests are sent to.
+	ModelName() string
+	// CheckAccess verifies the endpoint is reachable and the credentials work.
+	CheckAccess(ctx context.Context) error
+	// CheckModel verifies the configured model is available.
+	CheckModel(ctx context.Context) error
+}
+
+// Options configures a provider and tunes how each API call is made.
+type Options struct {
+	Model   string // model override; empty uses the provider's default
+	BaseURL string // API root override for OpenAI-compatible servers
+	APIKey  string // credential override; empty reads the provider's environment variable
+	Tools   bool   // let the model call read-only local tools such as list_dir
+	Seed    *int   // sampling seed for reproducible output, when the model honors it
+
+	// Timeout bounds each HTTP request; 0 uses the provider's default.
+	Timeout time.Duration
+	// Transport sends the HTTP requests; nil uses SharedTransport.
+	Transport http.RoundTripper
+
+	// Enough stops GenerateCommands from waiting for further calls once this
+	// many unique commands have arrived; 0 means as many as were asked for.
+	Enough int
+	// SoftDeadline stops GenerateCommands from waiting for further calls
+	// once this much time has passed and some commands have arrived; 0
+	// waits for every call.
+	SoftDeadline time.Duration
+}
+
+// Usage is the token accounting reported by the API for a response.
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// Add returns the sum of two usages.
+func (u Usage) Add(o Usage) Usage {
+	return Usage{
+		InputTokens:  u.InputTokens + o.InputTokens,
+		OutputTokens: u.OutputTokens + o.OutputTokens,
+		TotalTokens:  u.TotalTokens + o.TotalTokens,
+	}
+}
+
+// Result is the outcome of one API call, or of several combined.
+type Result struct {
+	Model       string          `json:"model,omitempty"`
+	Text        string          `json:"text,omitempty"` // the model's raw reply
+	Commands    []string        `json:"commands"`
+	Duration    time.Duration   `json:"duration"`
+	Retries     int             `json:"retries,omitempty"` // requests resent after 429 or 5xx
+	RawResponse json.RawMessage `json:"raw_response"`
+	Usage       Usage           `json:"usage"`
+	Error       error           `json:"error,omitempty"`
+}
+
+// Declined returns the model's reply when the call succeeded without
+// suggesting a command, as when the model refuses the task or answers it in
+// prose, so it can be shown instead; otherwise it returns "".
+func (r Result) Declined() string {
+	if r.Error != nil || len(r.Commands) > 0 {
+		return ""
+	}
+	if _, ok := structuredCommands(r.Text); ok {
+		return ""
+	}
+	return strings.TrimSpace(r.Text)
+}
+
+// ProviderNames lists the names NewProvider accepts. mock serves canned
+// replies for tests and demos.
+var ProviderNames = []string{"openai", "azure", "anthropic", "gemini", "ollama", "mock"}
+
+// NewProvider returns the named provider; an empty name selects OpenAI.
+func NewProvider(name string, opts Options) (Provider, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "", "openai":
+		return newOpenAIProvider(opts)
+	case "azure":
+		return newAzureProvider(opts)
+	case "anthropic":
+		return newAnthropicProvider(opts)
+	case "gemini":
+		return newGeminiProvider(opts)
+	case "ollama":
+		return newOllamaProvider(opts)
+	case "mock":
+		return newMockProvider(opts)
+	default:
+		return nil, fmt.Errorf("unknown provider %q (want one of: %s)", name, strings.Join(ProviderNames, ", "))
+	}
+}
+
+// SharedTransport pools connections for every provider client in the
+// process, so concurrent calls and follow-up requests reuse TLS sessions and
+// HTTP/2 connections instead of each paying for a new handshake.
+var SharedTransport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ForceAttemptHTTP2 = true
+	// The default of 2 idle connections per host would close most of the
+	// connections opened by -n concurrent calls.
+	t.MaxIdleConnsPerHost = 16
+	return t
+}()
+
+// newHTTPClient returns a client on the transport of opts whose requests
+// time out after timeout, or after requestTimeout when timeout is 0.
+func newHTTPClient(opts Options, timeout time.Duration) *http.Client {
+	transport := opts.Transport
+	if transport == nil {
+		transport = SharedTransport
+	}
+	return &http.Client{Timeout: cmp.Or(timeout, requestTimeout), Transport: transport}
+}
+
+// fanOut runs call n times concurrently and combines the results of the
+// calls that succeeded. Failed calls stay in the individual results with
+// their Error set; only when every call fails is the first error returned.
+// Calls still running when opts.Enough or opts.SoftDeadline says the
+// results so far will do are cancelled and left out.
+func fanOut(ctx context.Context, n int, opts Options, call func(ctx context.Context) Result) ([]Result, error) {
+	return fanOutBatched(ctx, n, 1, opts, func(ctx context.Context, _ int) Result {
+		return call(ctx)
+	})
+}
+
+// fanOutBatched asks for n candidates using calls that each return up to
+// perCall of them, so only as many requests are made as necessary. call
+// receives the number of candidates to request. Results are combined as by
+// fanOut.
+func fanOutBatched(ctx context.Context, n, perCall int, opts Options, call func(ctx context.Context, count int) Result) ([]Result, error) {
+	// At least one call is made, so the combined result is always there.
+	n, perCall = max(n, 1), max(perCall, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	enough := opts.Enough
+	if enough <= 0 {
+		enough = n
+	}
+	var deadline <-chan time.Time
+	if opts.SoftDeadline > 0 {
+		timer := time.NewTimer(opts.SoftDeadline)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	calls := (n + perCall - 1) / perCall
+	results := make(chan Result, calls)
+	var wg sync.WaitGroup
+	wallStart := time.Now()
+	// A fan-out made within a call of another, as by Spread, is that
+	// call: it keeps its number and leaves logging and reporting the
+	// calls to the outer fan-out.
+	_, nested := ctx.Value(callIndexKey{}).(int)
+
+	for i := range calls {
+		count := min(n-i*perCall, perCall)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if nested {
+				results <- call(ctx, count)
+				return
+			}
+			log := logger(ctx).With("call", i+1)
+			log.Debug("call started", "candidates", count)
+			r := call(WithLogger(withCallIndex(ctx, i), log), count)
+			logCall(log, r)
+			results <- r
+		}()
+	}
+	if !nested {
+		reportCalls(ctx, calls)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var allResults []Result
+	var firstError error
+	var unique []string
+	failed := 0
+	pastDeadline, stopped := false, false
+
+	for {
+		var result Result
+		var ok bool
+		select {
+		case result, ok = <-results:
+		case <-deadline:
+			deadline, pastDeadline = nil, true
+			if len(unique) > 0 {
+				cancel()
+				stopped = true
+			}
+			continue
+		}
+		if !ok {
+			break
+		}
+		if !nested {
+			reportResult(ctx, result)
+		}
+		if stopped && errors.Is(result.Error, context.Canceled) {
+			continue // cut short because the results so far will do
+		}
+		if result.Error != nil {
+			failed++
+			if firstError == nil {
+				firstError = result.Error
+			}
+		} else {
+			unique = DedupCommands(append(unique, result.Commands...))
+			if !stopped && len(unique) > 0 && (len(unique) >= enough || pastDeadline) {
+				cancel()
+				stopped = true
+			}
+		}
+		allResults = append(allResults, result)
+	}
+
+	if failed == len(allResults) {
+		return nil, firstError
+	}
+
+	var all []string
+	var usage Usage
+	models := map[string]bool{}
+	for _, result := range allResults {
+		// Failed calls may still have used tokens, e.g. in tool rounds.
+		usage = usage.Add(result.Usage)
+		if result.Error != nil {
+			continue
+		}
+		all = append(all, result.Commands...)
+		models[result.Model] = true
+	}
+
+	combinedResult := Result{
+		Model:    strings.Join(slices.Sorted(maps.Keys(models)), ", "),
+		Commands: DedupCommands(all),
+		Usage:    usage,
+		Duration: time.Since(wallStart),
+	}
+
+	return append([]Result{combinedResult}, allResults...), nil
+}
+
+// completeOnce turns the result of a single call into Complete's return values.
+func completeOnce(r Result) (Result, error) {
+	if r.Error != nil {
+		return Result{}, r.Error
+	}
+	if strings.TrimSpace(r.Text) == "" {
+		return r, errors.New("empty reply")
+	}
+	return r, nil
+}
+
+// statusError is an HTTP error response from a provider's API.
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.code, e.body)
+}
+
+// commandsFromCandidates turns raw model replies into unique commands.
+// Structured replies are read as JSON; anything else falls back to
+// scraping a single command out of the free text.
+func commandsFromCandidates(candidates []string) []string {
+	var commands []string
+	for _, c := range candidates {
+		if cmds, ok := structuredCommands(c); ok {
+			commands = append(commands, cmds...)
+			continue
+		}
+		cmd := SanitizeCommand(c)
+		if cmd != "" {
+			commands = append(commands, cmd)
+		}
+	}
+	return DedupCommands(commands)
+}
+
+// DedupCommands returns cmds with duplicates removed, preserving first-seen
+// order. Commands that differ only in spacing outside quotes, such as
+// "ls  -la" and "ls -la ", count as duplicates; the first spelling is kept.
+func DedupCommands(cmds []string) []string {
+	unique := make([]string, 0, len(cmds))
+	seen := map[string]struct{}{}
+	for _, cmd := range cmds {
+		key := normalizeSpacing(cmd)
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			unique = append(unique, cmd)
+		}
+	}
+	return unique
+}
+
+// normalizeSpacing collapses each run of spaces and tabs outside quotes in
+// cmd into one space and trims each line, so the result only differs for
+// commands that do different things.
+func normalizeSpacing(cmd string) string {
+	var b strings.Builder
+	var quote, last byte
+	space := false
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' && i+1 < len(cmd) {
+				b.WriteByte(c)
+				i++
+				c = cmd[i]
+			}
+		case c == ' ' || c == '\t':
+			space = true
+			continue
+		case c == '\n':
+			space = false
+		case c == '\\' && i+1 < len(cmd):
+			b.WriteByte(c)
+			i++
+			c = cmd[i]
+		case c == '\'' || c == '"':
+			quote = c
+		}
+		if space && b.Len() > 0 && last != '\n' {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteByte(c)
+		last = c
+	}
+	return b.String()
+}
+
+// probeGET performs an authenticated GET, typically against a models URL, and
+// turns the common failure statuses into actionable errors.
+func probeGET(ctx context.Context, httpClient *http.Client, url string, authorize func(*http.Request)) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	authorize(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot reach API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("credentials rejected (%d); check the API key", resp.StatusCode)
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s not found (404); the key has no access to it", url)
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// firstNonEmpty returns the first argument that isn't blank.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
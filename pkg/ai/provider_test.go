@@ -0,0 +1,88 @@
+package ai
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestDedupCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		cmds []string
+		want []string
+	}{
+		{"empty", nil, []string{}},
+		{"order kept", []string{"b", "a", "c"}, []string{"b", "a", "c"}},
+		{"exact duplicates", []string{"ls", "pwd", "ls", "pwd"}, []string{"ls", "pwd"}},
+		{"spacing collapses", []string{"ls -la", "ls  -la", "ls\t-la", " ls -la "}, []string{"ls -la"}},
+		{"first spelling kept", []string{"du -sh  *", "du -sh *"}, []string{"du -sh  *"}},
+		{"quoted spacing counts", []string{`echo "a  b"`, `echo "a b"`, `echo 'a  b'`}, []string{`echo "a  b"`, `echo "a b"`, `echo 'a  b'`}},
+		{"escaped space counts", []string{`touch a\ \ b`, `touch a\ b`}, []string{`touch a\ \ b`, `touch a\ b`}},
+		{"lines trimmed", []string{"for f in *; do\n  echo $f\ndone", "for f in *; do\necho $f  \ndone"}, []string{"for f in *; do\n  echo $f\ndone"}},
+		{"lines not joined", []string{"a\nb", "a b"}, []string{"a\nb", "a b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DedupCommands(tt.cmds); !slices.Equal(got, tt.want) {
+				t.Errorf("DedupCommands(%q) = %q, want %q", tt.cmds, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandsFromCandidates(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []string
+		want       []string
+	}{
+		{"one call, duplicate candidates", []string{"```bash\nls -la\n```", "ls -la", "$ ls  -la"}, []string{"ls -la"}},
+		{"order of first appearance", []string{"pwd", "ls", "pwd", "whoami"}, []string{"pwd", "ls", "whoami"}},
+		{"structured reply", []string{`{"commands": [{"cmd": "ls"}, {"cmd": "ls "}, {"cmd": "pwd"}]}`, "pwd"}, []string{"ls", "pwd"}},
+		{"no command", []string{"I'm sorry, I can't help with that.", "ls"}, []string{"ls"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commandsFromCandidates(tt.candidates); !slices.Equal(got, tt.want) {
+				t.Errorf("commandsFromCandidates(%q) = %q, want %q", tt.candidates, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestFanOutDedupsAcrossCalls checks that a command several calls return
+// is combined once whatever its spacing. Calls finish in any order, so
+// which spelling is kept isn't checked.
+func TestFanOutDedupsAcrossCalls(t *testing.T) {
+	replies := [][]string{
+		{"ls -la", "du -sh *"},
+		{"ls  -la", "du -sh *"},
+		{"ls -la", "du -sh  *"},
+	}
+	results, err := fanOutBatched(context.Background(), len(replies), 1, Options{}, func(ctx context.Context, _ int) Result {
+		return Result{Commands: replies[callIndex(ctx)]}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := results[0].Commands, []string{"ls -la", "du -sh *"}; len(got) != 2 || normalizeSpacing(got[0]) != want[0] || normalizeSpacing(got[1]) != want[1] {
+		t.Errorf("combined commands = %q, want %q", got, want)
+	}
+	if len(results) != 1+len(replies) {
+		t.Errorf("got %d results, want the combined one and %d calls", len(results), len(replies))
+	}
+}
+
+// TestFanOutAtLeastOneCall checks that asking for fewer than one candidate
+// still makes a call, so the combined result is there.
+func TestFanOutAtLeastOneCall(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		results, err := fanOut(context.Background(), n, Options{}, func(context.Context) Result {
+			return Result{Commands: []string{"ls"}}
+		})
+		if err != nil || len(results) != 2 || !slices.Equal(results[0].Commands, []string{"ls"}) {
+			t.Errorf("fanOut(n=%d) = %+v, %v; want the combined result and one call", n, results, err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package ai
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxRetries caps how often a rate-limited or failed request is resent.
+	maxRetries = 3
+	// retryBaseDelay is the backoff before the first retry; it doubles with
+	// each further attempt.
+	retryBaseDelay = 500 * time.Millisecond
+	// maxRetryDelay caps the wait before a retry, including one asked for
+	// by a Retry-After header.
+	maxRetryDelay = 20 * time.Second
+)
+
+// doWithRetry sends req and resends it after a backoff while the server
+// answers 429 or 5xx, honoring Retry-After. It returns the last response and
+// how many retries were made. The request body must be replayable, as it is
+// for requests built from a bytes.Reader.
+func doWithRetry(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, int, error) {
+	log := logger(ctx)
+	for retries := 0; ; retries++ {
+		// The query is left out: Gemini takes the API key there.
+		log.Debug("sending request", "method", req.Method, "host", req.URL.Host, "path", req.URL.Path, "attempt", retries+1)
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Debug("request failed", "error", err, "elapsed", time.Since(start))
+			return resp, retries, err
+		}
+		if !retryable(resp.StatusCode) || retries == maxRetries || req.GetBody == nil {
+			log.Info("response", "status", resp.StatusCode, "request_id", requestID(resp.Header), "elapsed", time.Since(start))
+			return resp, retries, nil
+		}
+		delay := retryDelay(resp.Header.Get("Retry-After"), retries, time.Now())
+		log.Info("retrying", "status", resp.StatusCode, "request_id", requestID(resp.Header), "attempt", retries+1, "delay", delay)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, retries, ctx.Err()
+		case <-timer.C:
+		}
+
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, retries, err
+		}
+		req = req.Clone(ctx)
+		req.Body = body
+	}
+}
+
+// retryable reports whether a response with status code is worth retrying.
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// retryDelay returns how long to wait before retry number retries+1: what
+// the Retry-After header asks for, or else an exponential backoff with full
+// jitter so concurrent calls don't retry in lockstep.
+func retryDelay(retryAfter string, retries int, now time.Time) time.Duration {
+	if secs, err := strconv.Atoi(retryAfter); err == nil && secs >= 0 {
+		return min(time.Duration(secs)*time.Second, maxRetryDelay)
+	}
+	if at, err := http.ParseTime(retryAfter); err == nil {
+		return min(max(at.Sub(now), 0), maxRetryDelay)
+	}
+	backoff := min(retryBaseDelay<<retries, maxRetryDelay)
+	return rand.N(backoff) + 1
+}
@@ -0,0 +1,9 @@
+package ai
+
+import "github.com/brainexe/ai/pkg/reply"
+
+// SanitizeCommand reduces a free-text reply to the single command it
+// contains, or to "" when it holds none, as reply.Command does.
+func SanitizeCommand(s string) string {
+	return reply.Command(s)
+}
@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// DefaultShell returns the user's shell from $SHELL. Without it, that is
+// PowerShell on Windows, pwsh when installed, and sh elsewhere.
+func DefaultShell() string {
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return sh
+	}
+	if runtime.GOOS == "windows" {
+		if _, err := exec.LookPath("pwsh"); err == nil {
+			return "pwsh"
+		}
+		return "powershell"
+	}
+	return "sh"
+}
+
+// ShellName returns the program name of shell, lowercased and without a
+// Windows .exe suffix, such as "bash" or "pwsh".
+func ShellName(shell string) string {
+	name := strings.ToLower(filepath.Base(shell))
+	return strings.TrimSuffix(name, ".exe")
+}
+
+// Dialect is the command syntax a shell understands.
+type Dialect int
+
+const (
+	DialectPOSIX      Dialect = iota // sh, bash, zsh, fish and the like
+	DialectPowerShell                // Windows PowerShell and PowerShell 7
+	DialectNushell
+	DialectXonsh
+)
+
+// DialectOf returns the syntax shell understands, judged by its name.
+func DialectOf(shell string) Dialect {
+	switch ShellName(shell) {
+	case "powershell", "pwsh":
+		return DialectPowerShell
+	case "nu":
+		return DialectNushell
+	case "xonsh":
+		return DialectXonsh
+	}
+	return DialectPOSIX
+}
+
+// IsPowerShell reports whether shell is Windows PowerShell or PowerShell 7.
+func IsPowerShell(shell string) bool {
+	return DialectOf(shell) == DialectPowerShell
+}
+
+// ShellDialect names the command syntax shell expects, for prompts, such
+// as "POSIX /bin/bash" or "PowerShell (pwsh)".
+func ShellDialect(shell string) string {
+	switch DialectOf(shell) {
+	case DialectPowerShell:
+		return "PowerShell (" + shell + ")"
+	case DialectNushell:
+		return "Nushell (" + shell + ")"
+	case DialectXonsh:
+		return "xonsh (" + shell + ")"
+	}
+	return "POSIX " + shell
+}
+
+// ShellArgs returns the arguments that make shell run the command string
+// following them.
+func ShellArgs(shell string) []string {
+	if IsPowerShell(shell) {
+		return []string{"-NoProfile", "-Command"}
+	}
+	return []string{"-c"}
+}
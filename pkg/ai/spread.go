@@ -0,0 +1,79 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Spread is a provider that spreads the calls of GenerateCommands over
+// several providers in turn, so asking for four candidates from three
+// models asks the first one twice and the others once. Their results are
+// combined and deduplicated as for a single provider, which gives more
+// varied candidates than asking one model several times. Complete goes to
+// the first provider.
+type Spread struct {
+	providers []Provider
+	opts      Options
+}
+
+// NewSpread returns a provider spreading calls over providers, which must
+// not be empty. Of opts, only Enough and SoftDeadline are used; the
+// providers were configured with their own.
+func NewSpread(providers []Provider, opts Options) *Spread {
+	return &Spread{providers: providers, opts: opts}
+}
+
+func (s *Spread) GenerateCommands(ctx context.Context, prompt string, n int) ([]Result, error) {
+	return fanOut(ctx, n, s.opts, func(ctx context.Context) Result {
+		p := s.providers[callIndex(ctx)%len(s.providers)]
+		results, err := p.GenerateCommands(ctx, prompt, 1)
+		if err != nil {
+			return Result{Model: modelName(p), Error: err}
+		}
+		// One call yields the combined result and the call itself.
+		return results[len(results)-1]
+	})
+}
+
+func (s *Spread) Complete(ctx context.Context, prompt string) (Result, error) {
+	return s.providers[0].Complete(ctx, prompt)
+}
+
+// ModelName returns the models calls are spread over, comma-separated.
+func (s *Spread) ModelName() string {
+	names := make([]string, len(s.providers))
+	for i, p := range s.providers {
+		names[i] = modelName(p)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (s *Spread) CheckAccess(ctx context.Context) error {
+	return s.check(func(c Checker) error { return c.CheckAccess(ctx) })
+}
+
+func (s *Spread) CheckModel(ctx context.Context) error {
+	return s.check(func(c Checker) error { return c.CheckModel(ctx) })
+}
+
+// check runs check on every provider that supports it and returns the
+// first failure, naming the model it concerns.
+func (s *Spread) check(check func(Checker) error) error {
+	for _, p := range s.providers {
+		if c, ok := p.(Checker); ok {
+			if err := check(c); err != nil {
+				return fmt.Errorf("%s: %w", c.ModelName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// modelName returns the model p sends requests to, or "" when it can't say.
+func modelName(p Provider) string {
+	if c, ok := p.(Checker); ok {
+		return c.ModelName()
+	}
+	return ""
+}
@@ -0,0 +1,195 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// maxSSELine bounds a single line of a streamed response; completion events
+// repeat the whole response and can be long.
+const maxSSELine = 1 << 20
+
+// StreamFunc receives the reply text of one call so far each time it grows.
+// call numbers the concurrent calls of one GenerateCommands.
+type StreamFunc func(call int, text string)
+
+// ResultFunc receives each call of a GenerateCommands as soon as it
+// completes, before the combined result is returned.
+type ResultFunc func(Result)
+
+// CallsFunc receives the number of concurrent calls a GenerateCommands
+// makes, once it has started them.
+type CallsFunc func(calls int)
+
+type streamKey struct{}
+
+type callIndexKey struct{}
+
+type resultKey struct{}
+
+type callsKey struct{}
+
+// WithStream returns a context asking providers to stream their replies and
+// report the text as it arrives to fn.
+func WithStream(ctx context.Context, fn StreamFunc) context.Context {
+	return context.WithValue(ctx, streamKey{}, fn)
+}
+
+// streaming reports whether the caller asked for replies to be streamed.
+func streaming(ctx context.Context) bool {
+	_, ok := ctx.Value(streamKey{}).(StreamFunc)
+	return ok
+}
+
+// withCallIndex tags the context of one of several concurrent calls.
+func withCallIndex(ctx context.Context, i int) context.Context {
+	return context.WithValue(ctx, callIndexKey{}, i)
+}
+
+// callIndex returns the call number set by withCallIndex, or 0.
+func callIndex(ctx context.Context) int {
+	i, _ := ctx.Value(callIndexKey{}).(int)
+	return i
+}
+
+// reportPartial passes the reply text received so far to the stream
+// function of ctx, if any.
+func reportPartial(ctx context.Context, text string) {
+	fn, ok := ctx.Value(streamKey{}).(StreamFunc)
+	if !ok {
+		return
+	}
+	fn(callIndex(ctx), text)
+}
+
+// WithResults returns a context asking for each completed call to be
+// reported to fn.
+func WithResults(ctx context.Context, fn ResultFunc) context.Context {
+	return context.WithValue(ctx, resultKey{}, fn)
+}
+
+// reportResult passes a completed call to the result function of ctx, if any.
+func reportResult(ctx context.Context, r Result) {
+	if fn, ok := ctx.Value(resultKey{}).(ResultFunc); ok {
+		fn(r)
+	}
+}
+
+// WithCalls returns a context asking for the number of concurrent calls to
+// be reported to fn, so progress can be shown while they run.
+func WithCalls(ctx context.Context, fn CallsFunc) context.Context {
+	return context.WithValue(ctx, callsKey{}, fn)
+}
+
+// reportCalls passes the number of calls started to the calls function of
+// ctx, if any.
+func reportCalls(ctx context.Context, calls int) {
+	if fn, ok := ctx.Value(callsKey{}).(CallsFunc); ok {
+		fn(calls)
+	}
+}
+
+// readSSE reads a server-sent event stream and calls fn with the event name
+// and data of each event. It stops at the end of the stream or at the first
+// error returned by fn.
+func readSSE(r io.Reader, fn func(event, data string) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), maxSSELine)
+	var event string
+	var data []string
+	dispatch := func() error {
+		defer func() { event, data = "", nil }()
+		if len(data) == 0 {
+			return nil
+		}
+		return fn(event, strings.Join(data, "\n"))
+	}
+	for sc.Scan() {
+		line := sc.Text()
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				return err
+			}
+		case field == "event":
+			event = value
+		case field == "data":
+			data = append(data, value)
+		}
+		// Comments (": ping") and other fields such as id and retry are ignored.
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return dispatch()
+}
+
+// PartialCommand returns the command a reply received so far is spelling
+// out, for display while the rest is still arriving. Structured replies show
+// the first cmd value; plain text shows its first line outside code fences.
+func PartialCommand(text string) string {
+	trimmed := strings.TrimSpace(text)
+	trimmed = strings.TrimPrefix(trimmed, "```json")
+	if strings.HasPrefix(strings.TrimSpace(trimmed), "{") {
+		return partialJSONField(trimmed, "cmd")
+	}
+	for line := range strings.Lines(trimmed) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "```") {
+			continue
+		}
+		return strings.TrimPrefix(line, "$ ")
+	}
+	return ""
+}
+
+// partialJSONField decodes the first string value of key in a possibly
+// truncated JSON document, up to where the document ends.
+func partialJSONField(doc, key string) string {
+	_, rest, ok := strings.Cut(doc, `"`+key+`"`)
+	if !ok {
+		return ""
+	}
+	rest = strings.TrimLeft(rest, " \t\r\n")
+	rest, ok = strings.CutPrefix(rest, ":")
+	if !ok {
+		return ""
+	}
+	rest = strings.TrimLeft(rest, " \t\r\n")
+	rest, ok = strings.CutPrefix(rest, `"`)
+	if !ok {
+		return ""
+	}
+	var b strings.Builder
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case c == '"':
+			return b.String()
+		case c != '\\':
+			b.WriteByte(c)
+		case i+1 >= len(rest):
+			return b.String() // the escape sequence hasn't arrived yet
+		default:
+			// Let the JSON decoder handle the escape, including \uXXXX.
+			end := i + 2
+			if rest[i+1] == 'u' {
+				end = i + 6
+			}
+			if end > len(rest) {
+				return b.String()
+			}
+			var s string
+			if err := json.Unmarshal([]byte(`"`+rest[i:end]+`"`), &s); err == nil {
+				b.WriteString(s)
+			}
+			i = end - 1
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package ai
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/brainexe/ai/pkg/reply"
+)
+
+// commandSchema is the JSON schema requested from providers that support
+// structured output. Replies that don't follow it are still accepted and go
+// through the free-text sanitizer instead.
+var commandSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"commands": map[string]any{
+			"type": "array",
+			"items": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"cmd":         map[string]any{"type": "string", "description": "a shell command, on one line unless the task needs a multi-line block"},
+					"risk":        map[string]any{"type": "string", "enum": []string{"low", "medium", "high"}},
+					"explanation": map[string]any{"type": "string", "description": "one short sentence"},
+				},
+				"required":             []string{"cmd", "risk", "explanation"},
+				"additionalProperties": false,
+			},
+		},
+	},
+	"required":             []string{"commands"},
+	"additionalProperties": false,
+}
+
+// structuredReply is a reply that follows commandSchema.
+type structuredReply struct {
+	Commands []struct {
+		Cmd         string `json:"cmd"`
+		Risk        string `json:"risk"`
+		Explanation string `json:"explanation"`
+	} `json:"commands"`
+}
+
+// structuredCommands returns the commands of a reply following
+// commandSchema, or false when text is not such a reply.
+func structuredCommands(text string) ([]string, bool) {
+	text = reply.JSON(text)
+	if !strings.HasPrefix(text, "{") {
+		return nil, false
+	}
+	var r structuredReply
+	if err := json.Unmarshal([]byte(text), &r); err != nil || r.Commands == nil {
+		return nil, false
+	}
+	var cmds []string
+	for _, c := range r.Commands {
+		if cmd := SanitizeCommand(c.Cmd); cmd != "" {
+			cmds = append(cmds, cmd)
+		}
+	}
+	return cmds, true
+}
@@ -0,0 +1,215 @@
+package ai
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// systemProbeTimeout bounds each program run to describe the system.
+const systemProbeTimeout = time.Second
+
+// readSystemInfo returns the name and version of the system, such as
+// "Ubuntu 24.04.1 LTS", "macOS 14.5" or "Windows 11 Pro 23H2 (build
+// 22631)", or "" when it can't tell.
+func readSystemInfo() string {
+	switch runtime.GOOS {
+	case "linux":
+		for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+			if name := readOSRelease(path); name != "" {
+				return name
+			}
+		}
+		return readIssue()
+	case "darwin":
+		var name, version string
+		for line := range strings.Lines(probe("sw_vers")) {
+			key, value, _ := strings.Cut(line, ":")
+			switch strings.TrimSpace(key) {
+			case "ProductName":
+				name = strings.TrimSpace(value)
+			case "ProductVersion":
+				version = strings.TrimSpace(value)
+			}
+		}
+		return strings.TrimSpace(name + " " + version)
+	case "windows":
+		return windowsVersion()
+	}
+	return probe("uname", "-sr")
+}
+
+// readOSRelease returns the distribution named by an os-release file: its
+// PRETTY_NAME, or else its NAME and VERSION_ID.
+func readOSRelease(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	fields := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+		if !ok || strings.HasPrefix(key, "#") {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		fields[key] = value
+	}
+	if fields["PRETTY_NAME"] != "" {
+		return fields["PRETTY_NAME"]
+	}
+	return strings.TrimSpace(fields["NAME"] + " " + fields["VERSION_ID"])
+}
+
+// readIssue returns the greeting of /etc/issue without its escapes, for
+// systems without an os-release file.
+func readIssue() string {
+	data, err := os.ReadFile("/etc/issue")
+	if err != nil {
+		return ""
+	}
+	content := strings.ReplaceAll(string(data), "\\n", "")
+	content = strings.ReplaceAll(content, "\\l", "")
+	return strings.TrimSpace(content)
+}
+
+// coreutilsFlavor returns which implementation of ls, sed, find and the
+// other core utilities the system has, as their flags differ: "GNU",
+// "BSD" or "BusyBox". It returns "" on Windows and when it can't tell.
+func coreutilsFlavor() string {
+	if runtime.GOOS == "windows" {
+		return ""
+	}
+	path, err := exec.LookPath("ls")
+	if err != nil {
+		return ""
+	}
+	if target, err := filepath.EvalSymlinks(path); err == nil && filepath.Base(target) == "busybox" {
+		return "BusyBox"
+	}
+	version := probe(path, "--version")
+	switch {
+	case strings.Contains(version, "GNU"):
+		return "GNU"
+	case strings.Contains(version, "BusyBox"):
+		return "BusyBox"
+	case runtime.GOOS == "darwin" || strings.HasSuffix(runtime.GOOS, "bsd") || runtime.GOOS == "dragonfly":
+		return "BSD"
+	}
+	return ""
+}
+
+// probe runs a program and returns its output, or "" when it fails.
+func probe(name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), systemProbeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// detectVirtualization returns what the system runs in when it isn't bare
+// metal, such as "Docker container", "WSL 2" or "virtual machine (KVM)",
+// or "" when it seems to be or can't tell.
+func detectVirtualization() string {
+	switch runtime.GOOS {
+	case "linux":
+		return linuxVirtualization()
+	case "darwin":
+		if strings.Contains(probe("sysctl", "-n", "machdep.cpu.features"), "VMM") {
+			return "virtual machine"
+		}
+	case "windows":
+		return windowsVirtualization()
+	}
+	return ""
+}
+
+// vmVendors maps what the firmware of a virtual machine calls its maker or
+// product to the name of the hypervisor.
+var vmVendors = []struct{ marker, name string }{
+	{"VirtualBox", "VirtualBox"},
+	{"VMware", "VMware"},
+	{"KVM", "KVM"},
+	{"QEMU", "QEMU"},
+	{"Microsoft Corporation", "Hyper-V"},
+	{"Xen", "Xen"},
+	{"Parallels", "Parallels"},
+	{"Amazon EC2", "Amazon EC2"},
+	{"Google Compute Engine", "Google Compute Engine"},
+	{"BHYVE", "bhyve"},
+}
+
+// linuxVirtualization detects containers from the marker files Docker and
+// Podman leave and from the cgroups of the first process, WSL from the
+// kernel release, and virtual machines from the DMI firmware strings or,
+// failing those, the CPU's hypervisor flag.
+func linuxVirtualization() string {
+	switch {
+	case fileExists("/.dockerenv"):
+		return "Docker container"
+	case fileExists("/run/.containerenv"):
+		return "Podman container"
+	}
+	if c := os.Getenv("container"); c != "" {
+		return c + " container"
+	}
+	if cgroup, err := os.ReadFile("/proc/1/cgroup"); err == nil {
+		for _, name := range []string{"kubepods", "docker", "containerd", "lxc"} {
+			if strings.Contains(string(cgroup), name) {
+				return name + " container"
+			}
+		}
+	}
+	if release, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil && strings.Contains(strings.ToLower(string(release)), "microsoft") {
+		if strings.Contains(string(release), "WSL2") || fileExists("/run/WSL") {
+			return "WSL 2"
+		}
+		return "WSL 1"
+	}
+	var firmware []string
+	for _, f := range []string{"sys_vendor", "product_name"} {
+		if data, err := os.ReadFile("/sys/class/dmi/id/" + f); err == nil {
+			firmware = append(firmware, strings.TrimSpace(string(data)))
+		}
+	}
+	if name := vmVendor(strings.Join(firmware, " ")); name != "" {
+		return "virtual machine (" + name + ")"
+	}
+	if cpuinfo, err := os.ReadFile("/proc/cpuinfo"); err == nil && strings.Contains(string(cpuinfo), " hypervisor") {
+		return "virtual machine"
+	}
+	return ""
+}
+
+// vmVendor returns the hypervisor the firmware strings name, or "". Hyper-V
+// only counts when the product is a virtual machine, since Microsoft makes
+// hardware too.
+func vmVendor(firmware string) string {
+	for _, v := range vmVendors {
+		if strings.Contains(firmware, v.marker) && (v.marker != "Microsoft Corporation" || strings.Contains(firmware, "Virtual Machine")) {
+			return v.name
+		}
+	}
+	return ""
+}
+
+// fileExists reports whether there is a file at path.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
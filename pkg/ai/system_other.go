@@ -0,0 +1,8 @@
+//go:build !windows
+
+package ai
+
+// windowsVersion and windowsVirtualization are only called on Windows.
+func windowsVersion() string { return "" }
+
+func windowsVirtualization() string { return "" }
@@ -0,0 +1,51 @@
+package ai
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// windowsVersion returns the edition, release and build of Windows from the
+// registry, such as "Windows 11 Pro 23H2 (build 22631)".
+func windowsVersion() string {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion`, registry.QUERY_VALUE)
+	if err != nil {
+		return probe("cmd", "/c", "ver")
+	}
+	defer k.Close()
+	name, _, _ := k.GetStringValue("ProductName")
+	release, _, err := k.GetStringValue("DisplayVersion")
+	if err != nil {
+		release, _, _ = k.GetStringValue("ReleaseId")
+	}
+	build, _, _ := k.GetStringValue("CurrentBuild")
+	// Windows 11 still calls itself Windows 10 here; its builds start at
+	// 22000.
+	if n, _ := strconv.Atoi(build); n >= 22000 {
+		name = strings.Replace(name, "Windows 10", "Windows 11", 1)
+	}
+	info := strings.TrimSpace(name + " " + release)
+	if build != "" {
+		info += fmt.Sprintf(" (build %s)", build)
+	}
+	return info
+}
+
+// windowsVirtualization returns "virtual machine" and the hypervisor when
+// the BIOS strings in the registry name one, or "".
+func windowsVirtualization() string {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `HARDWARE\DESCRIPTION\System\BIOS`, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer k.Close()
+	maker, _, _ := k.GetStringValue("SystemManufacturer")
+	product, _, _ := k.GetStringValue("SystemProductName")
+	if name := vmVendor(maker + " " + product); name != "" {
+		return "virtual machine (" + name + ")"
+	}
+	return ""
+}
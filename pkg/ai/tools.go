@@ -0,0 +1,142 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// maxToolRounds caps how many tool-call round trips a single API call may take.
+	maxToolRounds = 4
+	// maxListEntries caps the number of entries returned by list_dir.
+	maxListEntries = 200
+)
+
+// toolDef describes a function tool in the responses API format.
+type toolDef struct {
+	Type        string         `json:"type"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+// functionCallOutput returns the result of a tool call to the model.
+type functionCallOutput struct {
+	Type   string `json:"type"`
+	CallID string `json:"call_id"`
+	Output string `json:"output"`
+}
+
+// localTools are the read-only tools offered to the model with --tools.
+var localTools = []toolDef{
+	{
+		Type:        "function",
+		Name:        "list_dir",
+		Description: "List the entries of a directory below the current working directory. Directories end with '/', files show their size in bytes.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"path": map[string]any{
+					"type":        "string",
+					"description": "Directory path relative to the current working directory, e.g. \".\" or \"src\".",
+				},
+			},
+			"required":             []string{"path"},
+			"additionalProperties": false,
+		},
+	},
+}
+
+// functionCalls returns the tool calls requested in a response.
+func functionCalls(rr responseResp) []outputItem {
+	var calls []outputItem
+	for _, it := range rr.Output {
+		if it.Type == "function_call" {
+			calls = append(calls, it)
+		}
+	}
+	return calls
+}
+
+// runLocalTool executes a tool call and returns its output as text. Errors are
+// reported to the model as output rather than aborting the request.
+func runLocalTool(name, arguments string) string {
+	switch name {
+	case "list_dir":
+		var args struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "error: invalid arguments: " + err.Error()
+		}
+		out, err := listDir(args.Path)
+		if err != nil {
+			return "error: " + err.Error()
+		}
+		return out
+	default:
+		return "error: unknown tool " + name
+	}
+}
+
+// listDir lists a directory inside the working directory. Paths escaping the
+// working directory are rejected so the model can't browse the rest of the machine.
+func listDir(path string) (string, error) {
+	if path == "" {
+		path = "."
+	}
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("absolute paths are not allowed: %s", path)
+	}
+	clean := filepath.Clean(path)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path outside the working directory: %s", path)
+	}
+
+	// Resolve symlinks so a link can't lead outside the working directory either.
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(wd)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(wd, clean))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path outside the working directory: %s", path)
+	}
+
+	entries, err := os.ReadDir(resolved)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, e := range entries {
+		if i == maxListEntries {
+			fmt.Fprintf(&b, "... %d more entries\n", len(entries)-maxListEntries)
+			break
+		}
+		if e.IsDir() {
+			b.WriteString(e.Name() + "/\n")
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			b.WriteString(e.Name() + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "%s\t%d\n", e.Name(), info.Size())
+	}
+	if b.Len() == 0 {
+		return "(empty directory)", nil
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,239 @@
+package reply
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// codeBlockRe extracts the body of the first code fence, whatever its
+	// language, and also of one the reply was cut off in. As in Markdown,
+	// the fences stand on lines of their own.
+	codeBlockRe = regexp.MustCompile("(?s)(?:^|\n)[ \t]*```[\\w+-]*[ \t]*\n(.*?)(?:\n[ \t]*```[ \t]*(?:\n|$)|$)")
+	// inlineCodeRe matches a span of inline code, such as `ls -la`.
+	inlineCodeRe = regexp.MustCompile("```([^`\n]+)```|`([^`\n]+)`")
+	// listMarkerRe matches the number or bullet of a list item.
+	listMarkerRe = regexp.MustCompile(`^(?:\d+[.)]|[-*•])\s+`)
+	// labelRe matches a label such as "bash:" or "**Command:**" put before
+	// a command.
+	labelRe = regexp.MustCompile(`^(?:\*\*)?(?i:bash|sh|zsh|fish|shell|terminal|console|command|powershell|pwsh|cmd)(?:\*\*)?\s*:(?:\*\*)?(?:\s+|$)`)
+	// promptRe matches a shell prompt such as "$ ", "% " or
+	// "PS C:\Users\me> ".
+	promptRe = regexp.MustCompile(`^(?:[$%>] |PS(?: [^>]*)?> )`)
+	// refusalRe matches the usual openings of a model declining a task.
+	refusalRe = regexp.MustCompile(`(?i)^(?:i'm sorry|i am sorry|sorry|i can(?:'|no)t|i cannot|i'm (?:not able|unable)|i am (?:not able|unable)|i won't|i will not|as an ai|unfortunately)\b`)
+	// sentenceRe matches a line of plain words ending like a sentence,
+	// which no command looks like.
+	sentenceRe = regexp.MustCompile(`^[A-Z][a-z]*(?:,? [A-Za-z']+){3,}[.!?:]$`)
+	// wordsRe matches a line made of nothing but words and punctuation,
+	// starting with a capital, which is prose once its inline code is
+	// taken out.
+	wordsRe = regexp.MustCompile(`^[A-Z][A-Za-z']*(?:[,:;]? [A-Za-z']+)*[.!?:]?$`)
+)
+
+// Command reduces a reply to the single command it holds: the first
+// command of its first code block, or else of the reply itself. Lines of
+// prose before it are skipped, and so are a list number or bullet, a label
+// such as "bash:" and a prompt marker such as "$ " or "PS C:\> " before it.
+// A command the reply only mentions in a sentence, between backticks, is
+// taken from the sentence. A command usually ends with its first line, but
+// loops, here-documents and continued lines are kept whole, newlines
+// included. A reply that holds no command, such as a refusal or a sentence
+// of prose, yields "".
+func Command(text string) string {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if m := codeBlockRe.FindStringSubmatch(text); m != nil {
+		text = strings.TrimSpace(m[1])
+	}
+
+	lines := strings.Split(text, "\n")
+	for len(lines) > 0 {
+		more := len(lines) > 1
+		line := stripMarkers(lines[0])
+		code := stripMarkers(inlineCode(line))
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';' || line == "```":
+		case code != "" && more && strings.HasSuffix(line, ":"):
+			// It introduces the lines after it.
+		case code != "":
+			// Inline code holding only a comment isn't a command either.
+			if code[0] != '#' && code[0] != ';' {
+				return code
+			}
+		case more && (looksLikeProse(line) || strings.HasSuffix(line, ":") && wordsRe.MatchString(line)):
+		default:
+			lines[0] = line
+			// A stray fence ends the command, even inside an open quote.
+			for i, l := range lines[1:] {
+				if strings.HasPrefix(strings.TrimSpace(l), "```") {
+					lines = lines[:i+1]
+					break
+				}
+			}
+			lines = lines[:commandExtent(lines)]
+			for i, line := range lines {
+				lines[i] = strings.TrimRight(line, " \t\r")
+			}
+			// A continuation may have taken in blank lines at the end.
+			if cmd := strings.TrimRight(strings.Join(lines, "\n"), "\n"); !looksLikeProse(cmd) {
+				return cmd
+			}
+			return ""
+		}
+		lines = lines[1:]
+	}
+	return ""
+}
+
+// stripMarkers removes what may stand before a command on its line: list
+// numbers and bullets, labels and prompts, in any order, as in
+// "1. bash: $ ls".
+func stripMarkers(line string) string {
+	line = strings.TrimSpace(line)
+	for prev := ""; line != prev; {
+		prev = line
+		line = listMarkerRe.ReplaceAllString(line, "")
+		line = labelRe.ReplaceAllString(line, "")
+		line = promptRe.ReplaceAllString(line, "")
+		line = strings.TrimSpace(line)
+	}
+	return line
+}
+
+// inlineCode returns the command a line gives in inline code: all of the
+// line when it is a single span, the span it starts with, as in a list of
+// commands each followed by what it does, or the longest span of a
+// sentence. Otherwise, as for a command using `...` for substitution, it
+// returns "".
+func inlineCode(line string) string {
+	spans := inlineCodeRe.FindAllStringSubmatchIndex(line, -1)
+	if spans == nil {
+		return ""
+	}
+	code := func(m []int) string {
+		if m[2] >= 0 {
+			return strings.TrimSpace(line[m[2]:m[3]])
+		}
+		return strings.TrimSpace(line[m[4]:m[5]])
+	}
+	if spans[0][0] == 0 {
+		return code(spans[0])
+	}
+	if !wordsRe.MatchString(inlineCodeRe.ReplaceAllString(line, "it")) {
+		return ""
+	}
+	longest := ""
+	for _, m := range spans {
+		if c := code(m); len(c) > len(longest) {
+			longest = c
+		}
+	}
+	return longest
+}
+
+// looksLikeProse reports whether line reads as a message to the user rather
+// than as a command.
+func looksLikeProse(line string) bool {
+	line = strings.ReplaceAll(strings.TrimSpace(line), "’", "'")
+	return refusalRe.MatchString(line) || sentenceRe.MatchString(line)
+}
+
+// heredocRe matches the delimiter of a here-document following "<<" or
+// "<<-", quoted or not.
+var heredocRe = regexp.MustCompile(`^(-?)\s*(?:'([^']+)'|"([^"]+)"|\\?([A-Za-z_][A-Za-z0-9_]*))`)
+
+// compoundOpeners and compoundClosers start and end the compound commands
+// that may span lines: loops, conditionals and brace groups.
+var (
+	compoundOpeners = map[string]bool{"if": true, "case": true, "for": true, "while": true, "until": true, "select": true, "{": true}
+	compoundClosers = map[string]bool{"fi": true, "esac": true, "done": true, "}": true}
+)
+
+// commandExtent returns how many of lines, starting with the first, make up
+// one command. It goes on past a line ending in a continuation (a backslash,
+// PowerShell's backtick, a pipe, || or &&), through the body of a
+// here-document, and to the end of a quoted string, loop, conditional or
+// brace group left open. Keywords are only counted where a command starts,
+// so `echo done` doesn't end a loop.
+func commandExtent(lines []string) int {
+	var heredocs []string // delimiters of here-documents still open
+	var quote byte        // the quote character of a string left open
+	depth := 0
+	for i, line := range lines {
+		if len(heredocs) > 0 {
+			if strings.TrimLeft(strings.TrimRight(line, " \t\r"), "\t") == heredocs[0] {
+				heredocs = heredocs[1:]
+			}
+		} else {
+			start := true // the next word starts a command
+			var word strings.Builder
+			endWord := func() {
+				w := word.String()
+				word.Reset()
+				if w == "" {
+					return
+				}
+				// Braces also delimit PowerShell script blocks, wherever
+				// they stand.
+				switch {
+				case w == "{" || start && compoundOpeners[w]:
+					depth++
+				case w == "}" || start && compoundClosers[w]:
+					depth--
+				}
+				start = w == "then" || w == "do" || w == "else" || w == "elif" || w == "!" || w == "{" ||
+					start && compoundOpeners[w] && w != "for" && w != "case" && w != "select"
+			}
+			for j := 0; j < len(line); j++ {
+				c := line[j]
+				switch {
+				case quote != 0:
+					if c == quote {
+						quote = 0
+					} else if c == '\\' && quote == '"' {
+						j++
+					}
+				case c == '\\':
+					j++
+				case c == '\'' || c == '"':
+					quote = c
+				case c == '#' && word.Len() == 0:
+					j = len(line)
+				case strings.HasPrefix(line[j:], "<<<"):
+					endWord()
+					j += 2 // a here-string, which ends with the line
+				case strings.HasPrefix(line[j:], "<<"):
+					endWord()
+					if m := heredocRe.FindStringSubmatch(line[j+2:]); m != nil {
+						heredocs = append(heredocs, m[2]+m[3]+m[4])
+						j += 1 + len(m[0])
+					}
+				case c == ';' || c == '&' || c == '|' || c == '(' || c == ')':
+					endWord()
+					start = true
+				case c == ' ' || c == '\t' || c == '\r':
+					endWord()
+				default:
+					word.WriteByte(c)
+				}
+			}
+			endWord()
+		}
+		if len(heredocs) == 0 && quote == 0 && depth <= 0 && !continues(line) {
+			return i + 1
+		}
+	}
+	return len(lines)
+}
+
+// continues reports whether line ends in a way that carries the command on
+// to the next line.
+func continues(line string) bool {
+	line = strings.TrimRight(line, " \t\r")
+	for _, end := range []string{"\\", " `", "|", "&&"} {
+		if strings.HasSuffix(line, end) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+// Package reply reads what a language model answered. Models rarely reply
+// exactly as asked: a command comes wrapped in a code fence, after a line
+// of introduction, as the first item of a numbered list, between inline
+// backticks in a sentence, or labelled "bash:"; JSON comes fenced as well.
+// The functions here dig the command or document out of such replies.
+package reply
+
+import (
+	"regexp"
+	"strings"
+)
+
+// jsonBlockRe extracts a JSON document the model wrapped in a code fence.
+var jsonBlockRe = regexp.MustCompile("(?s)```(?:json)?\\s*\\n(.*?)\\n\\s*```")
+
+// JSON returns the JSON document of a reply, without the code fence the
+// model may have wrapped it in. It doesn't check that the result is JSON.
+func JSON(text string) string {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if m := jsonBlockRe.FindStringSubmatch(text); m != nil {
+		text = strings.TrimSpace(m[1])
+	}
+	return text
+}
@@ -0,0 +1,82 @@
+package reply
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files with the current results")
+
+// goldenSep separates the reply from the expected result in a golden file.
+const goldenSep = "\n-- want --\n"
+
+// TestGolden parses each reply in testdata and compares the result with
+// what the file expects: JSON for files named json_*, Command otherwise.
+// Run with -update to record new results.
+func TestGolden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no golden files")
+	}
+	for _, path := range files {
+		name := strings.TrimSuffix(filepath.Base(path), ".golden")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, want, ok := strings.Cut(string(data), goldenSep)
+			if !ok {
+				t.Fatalf("%s: no %q line", path, strings.TrimSpace(goldenSep))
+			}
+			parse := Command
+			if strings.HasPrefix(name, "json_") {
+				parse = JSON
+			}
+			got := parse(text)
+			if *update {
+				if err := os.WriteFile(path, []byte(text+goldenSep+got+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if want = strings.TrimSuffix(want, "\n"); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// FuzzParse checks that no reply makes the parsers panic, and that what
+// Command extracts parses back to itself, bare or in a code fence.
+func FuzzParse(f *testing.F) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "*.golden"))
+	for _, path := range files {
+		if data, err := os.ReadFile(path); err == nil {
+			text, _, _ := strings.Cut(string(data), goldenSep)
+			f.Add(text)
+		}
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		JSON(text)
+		cmd := Command(text)
+		if cmd == "" {
+			return
+		}
+		if cmd != strings.TrimSpace(cmd) {
+			t.Errorf("Command(%q) = %q, not trimmed", text, cmd)
+		}
+		if again := Command(cmd); again != cmd {
+			t.Errorf("Command(%q) = %q, but Command(%q) = %q", text, cmd, cmd, again)
+		}
+		if fenced := Command("```sh\n" + cmd + "\n```"); fenced != cmd {
+			t.Errorf("Command(%q) = %q, but fenced it parses as %q", text, cmd, fenced)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/brainexe/ai/pkg/ai"
+	"golang.org/x/term"
+)
+
+var (
+	// placeholderRe matches a placeholder the model left for a value the
+	// task doesn't give, such as <FILENAME> or <PORT>.
+	placeholderRe = regexp.MustCompile(`<([A-Z][A-Z0-9_]*)>`)
+	// plainWordRe and plainPowerShellRe match values the shell takes
+	// literally without quotes.
+	plainWordRe       = regexp.MustCompile(`^[A-Za-z0-9_./:=@%+,-]+$`)
+	plainPowerShellRe = regexp.MustCompile(`^[A-Za-z0-9_./\\:][A-Za-z0-9_./\\:-]*$`)
+)
+
+// placeholders returns the distinct placeholder names in cmd, in order of
+// first appearance.
+func placeholders(cmd string) []string {
+	var names []string
+	for _, m := range placeholderRe.FindAllStringSubmatch(cmd, -1) {
+		if !slices.Contains(names, m[1]) {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// withoutPlaceholders replaces each placeholder with its bare name, so
+// that checks reading cmd as shell code don't take the angle brackets for
+// redirections.
+func withoutPlaceholders(cmd string) string {
+	return placeholderRe.ReplaceAllString(cmd, "$1")
+}
+
+// fillPlaceholders asks for the value of each placeholder in cmd and
+// substitutes it, quoted to suit where it appears. On a terminal the value
+// is edited in place and Tab completes file paths. It reports false when
+// the user cancelled.
+func fillPlaceholders(ui *os.File, cmd string) (string, bool, error) {
+	names := placeholders(cmd)
+	if len(names) == 0 {
+		return cmd, true, nil
+	}
+	values := map[string]string{}
+	for _, name := range names {
+		prompt := fmt.Sprintf("Value for <%s>: ", name)
+		var value string
+		if menuInteractive(ui) {
+			state, err := term.MakeRaw(int(os.Stdin.Fd()))
+			if err != nil {
+				return "", false, err
+			}
+			v, ok, err := editLineWith(ui, stdinReader, prompt, "", completePath)
+			_ = term.Restore(int(os.Stdin.Fd()), state)
+			if err != nil || !ok {
+				return "", false, err
+			}
+			value = v
+		} else {
+			fmt.Fprint(ui, prompt)
+			line, err := stdinReader.ReadString('\n')
+			if err != nil && line == "" {
+				return "", false, nil
+			}
+			value = strings.TrimSpace(line)
+		}
+		values[name] = value
+	}
+
+	quote, escape := quoteFor, byte('\\')
+	switch ai.DialectOf(targetShell()) {
+	case ai.DialectPowerShell:
+		quote, escape = quotePowerShell, '`'
+	case ai.DialectNushell:
+		quote = quoteNushell
+	case ai.DialectXonsh:
+		quote = quoteXonsh
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range placeholderRe.FindAllStringSubmatchIndex(cmd, -1) {
+		b.WriteString(cmd[last:m[0]])
+		b.WriteString(quote(values[cmd[m[2]:m[3]]], quoteContext(cmd[:m[0]], escape)))
+		last = m[1]
+	}
+	b.WriteString(cmd[last:])
+	return b.String(), true, nil
+}
+
+// fill has the user fill in the placeholders of cmd, reporting false when
+// they cancelled or asking failed.
+func (s *session) fill(cmd string) (string, bool) {
+	filled, ok, err := fillPlaceholders(s.ui, cmd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return "", false
+	}
+	if !ok {
+		fmt.Fprintln(os.Stderr, "Aborted.")
+	}
+	return filled, ok
+}
+
+// quoteContext returns the quote, ' or ", that is open at the end of
+// prefix, or 0 when there is none. escape is the shell's escape character.
+func quoteContext(prefix string, escape byte) byte {
+	var open byte
+	for i := 0; i < len(prefix); i++ {
+		switch c := prefix[i]; {
+		case open == '\'':
+			if c == '\'' {
+				open = 0
+			}
+		case c == escape:
+			i++
+		case c == open:
+			open = 0
+		case open == 0 && (c == '\'' || c == '"'):
+			open = c
+		}
+	}
+	return open
+}
+
+// quoteFor quotes value so the shell reads it literally inside the given
+// open quote, or unquoted when quote is 0. Unquoted, a leading ~/ is kept
+// outside the quotes so it still expands to the home directory.
+func quoteFor(value string, quote byte) string {
+	switch quote {
+	case '\'':
+		return strings.ReplaceAll(value, "'", `'\''`)
+	case '"':
+		return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(value)
+	}
+	if rest, ok := strings.CutPrefix(value, "~/"); ok {
+		return "~/" + quoteFor(rest, 0)
+	}
+	if plainWordRe.MatchString(value) {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// quotePowerShell is quoteFor for PowerShell, which doubles single quotes
+// and escapes with backticks.
+func quotePowerShell(value string, quote byte) string {
+	switch quote {
+	case '\'':
+		return strings.ReplaceAll(value, "'", "''")
+	case '"':
+		return strings.NewReplacer("`", "``", `"`, "`\"", "$", "`$").Replace(value)
+	}
+	if plainPowerShellRe.MatchString(value) {
+		return value
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// quoteNushell is quoteFor for Nushell, whose single-quoted strings are
+// raw and can't hold a single quote, so those are dropped, and whose
+// double-quoted strings take backslash escapes.
+func quoteNushell(value string, quote byte) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	switch quote {
+	case '\'':
+		return strings.ReplaceAll(value, "'", "")
+	case '"':
+		return escaped
+	}
+	if plainWordRe.MatchString(value) {
+		return value
+	}
+	return `"` + escaped + `"`
+}
+
+// quoteXonsh is quoteFor for xonsh, whose quoted strings are Python's:
+// both kinds take backslash escapes.
+func quoteXonsh(value string, quote byte) string {
+	switch quote {
+	case '\'', '"':
+		return strings.NewReplacer(`\`, `\\`, string(quote), `\`+string(quote)).Replace(value)
+	}
+	if plainWordRe.MatchString(value) {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value) + "'"
+}
+
+// completePath completes text as a file path. It returns the completed text
+// and, when the completion is ambiguous, the candidates to show.
+func completePath(text string) (string, []string) {
+	dir, base := filepath.Split(text)
+	listDir := dir
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(dir, "~/") {
+		listDir = filepath.Join(home, dir[2:])
+	}
+	entries, err := os.ReadDir(cmp.Or(listDir, "."))
+	if err != nil {
+		return text, nil
+	}
+	var matches []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if e.IsDir() {
+			name += "/"
+		}
+		matches = append(matches, name)
+	}
+	switch len(matches) {
+	case 0:
+		return text, nil
+	case 1:
+		return dir + matches[0], nil
+	}
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	if len(prefix) > len(base) {
+		return dir + prefix, nil
+	}
+	return text, matches
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/brainexe/ai/pkg/ai"
+	"github.com/brainexe/ai/pkg/reply"
+)
+
+// planMaxSteps bounds how many steps a plan may have.
+const planMaxSteps = 20
+
+// planStep is one entry of the plan the model returns for --plan.
+type planStep struct {
+	Command     string `json:"command"`
+	Description string `json:"description"`
+}
+
+// plan implements --plan: the model breaks the task into ordered steps,
+// which are shown as a whole and then run one at a time, each after
+// confirmation. The first failing step aborts the rest. With -y, steps that
+// need no extra caution run without asking.
+func (s *session) plan(task string) int {
+	reply, ok := s.complete(buildPlanPrompt(task, s.client.Environment, s.cfg.PromptExtra))
+	if !ok {
+		return 1
+	}
+	steps, err := parsePlan(reply)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: the model returned no usable plan:", err)
+		s.log.Info("unusable plan", "reply", reply)
+		return 1
+	}
+
+	commands := make([]string, len(steps))
+	for i, st := range steps {
+		commands[i] = st.Command
+	}
+	if s.flags.dryRun {
+		s.audit(auditRecord{Mode: "plan", Task: task, Suggestions: commands})
+		for i, st := range steps {
+			if reason := cautionReason(s.cfg, st.Command); reason != "" {
+				fmt.Fprintf(os.Stderr, "Warning: step %d looks destructive (%s).\n", i+1, reason)
+			}
+			fmt.Println(st.Command)
+		}
+		return dryRunExitCode
+	}
+
+	fmt.Fprintln(s.ui, "Plan:")
+	for i, st := range steps {
+		fmt.Fprintf(s.ui, "  %d) %s\n", i+1, st.Command)
+		if st.Description != "" {
+			fmt.Fprintf(s.ui, "     %s\n", paint(st.Description, ansiDim, colorEnabled(s.ui)))
+		}
+	}
+
+	for i, st := range steps {
+		fmt.Fprintf(s.ui, "Step %d/%d: %s\n", i+1, len(steps), st.Command)
+		rec := auditRecord{Mode: "plan", Task: task, Suggestions: commands, Command: st.Command}
+		if !approveCommand(s.cfg, st.Command, !s.flags.yes, "Run it?") {
+			s.audit(rec)
+			fmt.Fprintf(os.Stderr, "Stopped; %d of %d steps were run.\n", i, len(steps))
+			return 1
+		}
+		code := s.auditRun(rec, func() int {
+			if err := runCommand(st.Command); err != nil {
+				return exitCode(err)
+			}
+			return 0
+		})
+		if code != 0 {
+			if rest := len(steps) - i - 1; rest > 0 {
+				fmt.Fprintf(os.Stderr, "Step %d failed (exit %d); skipping the remaining %d.\n", i+1, code, rest)
+			}
+			return code
+		}
+	}
+	return 0
+}
+
+// buildPlanPrompt asks for task as an ordered list of commands in JSON.
+func buildPlanPrompt(task string, ctx map[string]string, extra string) string {
+	var b strings.Builder
+	b.WriteString("You are a shell assistant that plans multi-step tasks.\n")
+	b.WriteString("Break the task into the shortest ordered list of shell commands for " + ai.ShellDialect(ctx["shell"]) + " that accomplishes it.\n")
+	b.WriteString("Rules:\n")
+	b.WriteString("- Reply with JSON only: {\"steps\": [{\"command\": \"...\", \"description\": \"...\"}]}.\n")
+	b.WriteString("- Each command is a single line and runs in the current working directory; later steps may rely on earlier ones.\n")
+	b.WriteString("- Each description is one short sentence saying what the step does.\n")
+	b.WriteString("- Avoid destructive actions (rm -rf, chmod -R, sudo, moving/deleting) unless explicitly requested.\n")
+	fmt.Fprintf(&b, "- Use at most %d steps.\n", planMaxSteps)
+	ai.WritePreferences(&b, ctx)
+	if extra = strings.TrimSpace(extra); extra != "" {
+		b.WriteString("\nAdditional instructions:\n")
+		b.WriteString(extra)
+		b.WriteString("\n")
+	}
+	ai.WriteEnvironment(&b, ctx)
+	b.WriteString("\nTask:\n")
+	b.WriteString(task)
+	b.WriteString("\n")
+	return b.String()
+}
+
+// parsePlan decodes the model's plan, tolerating a surrounding code fence.
+func parsePlan(text string) ([]planStep, error) {
+	text = reply.JSON(text)
+	var p struct {
+		Steps []planStep `json:"steps"`
+	}
+	if err := json.Unmarshal([]byte(text), &p); err != nil {
+		return nil, err
+	}
+	var steps []planStep
+	for _, st := range p.Steps {
+		st.Command = strings.TrimSpace(st.Command)
+		st.Description = strings.TrimSpace(st.Description)
+		if st.Command == "" {
+			continue
+		}
+		if strings.Contains(st.Command, "\n") {
+			return nil, fmt.Errorf("step %q spans several lines", st.Command)
+		}
+		steps = append(steps, st)
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("no steps")
+	}
+	if len(steps) > planMaxSteps {
+		return nil, fmt.Errorf("%d steps, more than the %d allowed", len(steps), planMaxSteps)
+	}
+	return steps, nil
+}
@@ -0,0 +1,26 @@
+//go:build !unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// runForeground runs cmd in the foreground. Ctrl-C reaches the command
+// through the console, so ai ignores it meanwhile and reports the command's
+// exit status instead.
+func runForeground(cmd *exec.Cmd) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+	return cmd.Run()
+}
+
+// listenPrivate listens on the unix socket path; Windows has no umask, so
+// the socket is restricted once it exists.
+func listenPrivate(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
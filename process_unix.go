@@ -0,0 +1,141 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// runForeground runs cmd the way a shell runs a job: in a process group of
+// its own that owns the terminal while it runs, so Ctrl-C, Ctrl-\ and
+// Ctrl-Z reach the command and everything it started rather than ai.
+// SIGINT, SIGTERM and SIGHUP sent to ai are passed on to the group. When
+// the command is suspended ai suspends too, and resumes it on fg.
+func runForeground(cmd *exec.Cmd) error {
+	tty := foregroundTerminal()
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if tty >= 0 {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = tty
+	}
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sig)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pgid := cmd.Process.Pid
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case s := <-sig:
+				syscall.Kill(-pgid, s.(syscall.Signal))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Wait for the command ourselves, since exec.Cmd.Wait doesn't return
+	// when it stops.
+	var status syscall.WaitStatus
+	var err error
+	for {
+		_, err = syscall.Wait4(pgid, &status, syscall.WUNTRACED, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || !status.Stopped() {
+			break
+		}
+		if tty < 0 {
+			continue // without a terminal only a signal sent to it resumes it
+		}
+		setForeground(tty, syscall.Getpgrp())
+		suspend()
+		setForeground(tty, pgid)
+		syscall.Kill(-pgid, syscall.SIGCONT)
+	}
+	close(done)
+	if tty >= 0 {
+		setForeground(tty, syscall.Getpgrp())
+	}
+	// The process is reaped already; Wait only finishes copying its output.
+	cmd.Wait()
+	switch {
+	case err != nil:
+		return err
+	case status.Exited() && status.ExitStatus() == 0:
+		return nil
+	}
+	return &waitError{status}
+}
+
+// suspend stops ai's process group as Ctrl-Z would and returns once it is
+// continued. It returns at once when no shell is there to continue it.
+func suspend() {
+	if !underJobControl() {
+		return
+	}
+	cont := make(chan os.Signal, 1)
+	signal.Notify(cont, syscall.SIGCONT)
+	defer signal.Stop(cont)
+	syscall.Kill(0, syscall.SIGTSTP)
+	<-cont
+}
+
+// underJobControl reports whether ai's parent runs it as a job, in a process
+// group of its own in the same session, as shells with job control do. The
+// system discards stop signals sent to other groups like ai's.
+func underJobControl() bool {
+	ppid := os.Getppid()
+	pgrp, err := syscall.Getpgid(ppid)
+	if err != nil || pgrp == syscall.Getpgrp() {
+		return false
+	}
+	sid, err := unix.Getsid(ppid)
+	own, ownErr := unix.Getsid(0)
+	return err == nil && ownErr == nil && sid == own
+}
+
+// foregroundTerminal returns the descriptor of the terminal ai runs in the
+// foreground of, or -1 when it has none, for example in a pipeline run in
+// the background.
+func foregroundTerminal() int {
+	for _, f := range []*os.File{os.Stdin, os.Stdout, os.Stderr} {
+		fd := int(f.Fd())
+		if !term.IsTerminal(fd) {
+			continue
+		}
+		pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+		if err == nil && pgrp == syscall.Getpgrp() {
+			return fd
+		}
+	}
+	return -1
+}
+
+// setForeground hands the terminal tty to the process group pgrp. ai may
+// be in the background by then, where the terminal would otherwise stop it
+// for trying.
+func setForeground(tty, pgrp int) {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	unix.IoctlSetPointerInt(tty, unix.TIOCSPGRP, pgrp)
+}
+
+// listenPrivate listens on the unix socket path, created with no access for
+// other users from the start rather than restricted once it exists.
+func listenPrivate(path string) (net.Listener, error) {
+	old := syscall.Umask(0o077)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
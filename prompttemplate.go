@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// promptData is what a prompt template can use.
+type promptData struct {
+	Task         string            // the task as the user gave it
+	Context      map[string]string // the environment context, such as .Context.shell
+	Environment  string            // the context as the built-in prompt renders it
+	Instructions string            // prompt_extra, global and project
+	Prefer       []string          // the preferences from prefer
+	Config       map[string]string // the settings `ai config list` shows, such as .Config.model
+	Default      string            // the built-in prompt, to wrap or amend
+}
+
+// promptTemplatePath resolves the prompt_template setting: ~/ is the home
+// directory, and relative paths are relative to the directory of the global
+// config file.
+func promptTemplatePath(setting string) (string, error) {
+	if rest, ok := strings.CutPrefix(setting, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, rest), nil
+	}
+	if filepath.IsAbs(setting) {
+		return setting, nil
+	}
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), setting), nil
+}
+
+// loadPromptTemplate parses the template file at path and tries it on env,
+// so mistakes such as a misspelled field show up before any request.
+func loadPromptTemplate(path string, cfg config, env map[string]string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(path)).
+		Funcs(template.FuncMap{"join": strings.Join}).
+		Option("missingkey=zero").
+		Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := renderPrompt(tmpl, cfg, "list files", env, cfg.PromptExtra); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderPrompt executes tmpl for task in the environment env.
+func renderPrompt(tmpl *template.Template, cfg config, task string, env map[string]string, instructions string) (string, error) {
+	var section strings.Builder
+	ai.WriteEnvironment(&section, env)
+	settings := make(map[string]string)
+	for _, kv := range configEntries(cfg) {
+		settings[kv[0]] = kv[1]
+	}
+	var b strings.Builder
+	err := tmpl.Execute(&b, promptData{
+		Task:         task,
+		Context:      env,
+		Environment:  strings.TrimSpace(section.String()),
+		Instructions: instructions,
+		Prefer:       cfg.Prefer,
+		Config:       settings,
+		Default:      ai.BuildPrompt(task, env, instructions),
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(b.String()) == "" {
+		return "", errors.New("the template produced an empty prompt")
+	}
+	return b.String(), nil
+}
+
+// usePromptTemplate has the session's client build its prompts from the
+// template set as prompt_template, if any. A template that fails on a
+// request is reported and the built-in prompt used instead.
+func (s *session) usePromptTemplate() error {
+	if s.cfg.PromptTemplate == "" {
+		return nil
+	}
+	path, err := promptTemplatePath(s.cfg.PromptTemplate)
+	if err != nil {
+		return fmt.Errorf("prompt_template: %w", err)
+	}
+	tmpl, err := loadPromptTemplate(path, s.cfg, s.client.Environment)
+	if err != nil {
+		return fmt.Errorf("prompt_template: %w", err)
+	}
+	s.client.PromptBuilder = func(task string, env map[string]string, instructions string) string {
+		prompt, err := renderPrompt(tmpl, s.cfg, task, env, instructions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: prompt_template: %v; using the built-in prompt\n", err)
+			return ai.BuildPrompt(task, env, instructions)
+		}
+		return prompt
+	}
+	return nil
+}
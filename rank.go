@@ -0,0 +1,115 @@
+package main
+
+import (
+	"cmp"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// sameProgramWeight is how much a past pick counts for a suggestion that
+// runs the same program with different arguments, relative to an exact
+// match.
+const sameProgramWeight = 0.25
+
+var taskWordRe = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// taskStopWords carry no meaning about which command fits a task.
+var taskStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "from": true, "into": true,
+	"that": true, "this": true, "all": true, "are": true, "how": true, "what": true,
+	"which": true, "show": true, "list": true, "get": true, "find": true,
+}
+
+// arrange puts cmds in the order they are offered: past picks for similar
+// tasks first, and commands using programs that aren't installed last.
+func (s *session) arrange(task string, cmds []string) []string {
+	return demoteMissing(s.rankByHistory(task, cmds))
+}
+
+// rankByHistory orders cmds so the ones the user picked before for similar
+// tasks come first, keeping the model's order among equals. It does nothing
+// when the history is turned off.
+func (s *session) rankByHistory(task string, cmds []string) []string {
+	if len(cmds) < 2 || !s.cfg.keepHistory() || s.past == nil {
+		return cmds
+	}
+	scores := historyScores(s.past(), task, cmds)
+	ranked := slices.Clone(cmds)
+	slices.SortStableFunc(ranked, func(a, b string) int { return cmp.Compare(scores[b], scores[a]) })
+	return ranked
+}
+
+// historyScores rates each of cmds by the past picks for tasks sharing words
+// with task: each counts with the share of words the tasks have in common,
+// in full when it is the same command and partly when it runs the same
+// program.
+func historyScores(past []historyEntry, task string, cmds []string) map[string]float64 {
+	words := taskWords(task)
+	scores := map[string]float64{}
+	if len(words) == 0 {
+		return scores
+	}
+	programs := make([]string, len(cmds))
+	for i, c := range cmds {
+		programs[i] = programOf(c)
+	}
+	for _, e := range past {
+		sim := overlap(words, taskWords(e.Task))
+		if sim == 0 {
+			continue
+		}
+		picked := strings.Join(strings.Fields(e.Command), " ")
+		program := programOf(e.Command)
+		for i, c := range cmds {
+			switch {
+			case strings.Join(strings.Fields(c), " ") == picked:
+				scores[c] += sim
+			case programs[i] != "" && programs[i] == program:
+				scores[c] += sim * sameProgramWeight
+			}
+		}
+	}
+	return scores
+}
+
+// taskWords returns the distinct meaningful words of a task, lowercased.
+func taskWords(task string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range taskWordRe.FindAllString(strings.ToLower(task), -1) {
+		if len(w) > 2 && !taskStopWords[w] {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+// overlap is the Jaccard similarity of two word sets: the words they share
+// over all the words either has.
+func overlap(a, b map[string]bool) float64 {
+	shared := 0
+	for w := range a {
+		if b[w] {
+			shared++
+		}
+	}
+	if shared == 0 {
+		return 0
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// programOf returns the program cmd starts with, without wrappers such as
+// sudo, or "" when there is none.
+func programOf(cmd string) string {
+	segments := shellSegments(cmd)
+	if len(segments) == 0 {
+		return ""
+	}
+	args := stripWrappers(segments[0])
+	if len(args) == 0 {
+		return ""
+	}
+	return filepath.Base(args[0])
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// replHistoryTurns is how many earlier turns are sent with each task.
+	replHistoryTurns = 10
+	// replOutputTurns is how many of the most recent turns include their
+	// captured output; older turns only carry the command and exit code.
+	replOutputTurns = 2
+)
+
+// replTurn is one completed task of an interactive session.
+type replTurn struct {
+	task     string
+	command  string // "" when nothing was run
+	exitCode int
+	output   string
+}
+
+// repl runs the interactive mode: each line read is a task, answered with the
+// earlier turns of the session as context. Commands run with their output
+// captured so the next turn can build on it. first, if not empty, is the
+// opening task.
+func (s *session) repl(first string) int {
+	limit, err := captureLimit()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	fmt.Fprintln(s.ui, `Interactive session; enter a task, or "exit" to quit.`)
+
+	var turns []replTurn
+	task := strings.TrimSpace(first)
+	for {
+		if task == "" {
+			fmt.Fprint(s.ui, "ai> ")
+			line, err := stdinReader.ReadString('\n')
+			if errors.Is(err, io.EOF) && line == "" {
+				fmt.Fprintln(s.ui)
+				return 0
+			}
+			if err != nil && !errors.Is(err, io.EOF) {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				return 1
+			}
+			task = strings.TrimSpace(line)
+			if task == "exit" || task == "quit" {
+				return 0
+			}
+			if task == "" {
+				continue
+			}
+		}
+
+		turn := replTurn{task: task}
+		task = ""
+		if !s.checkSecrets(turn.task) {
+			continue
+		}
+		s.attachFiles(turn.task, os.Stderr)
+		cmd, _ := s.choose(sessionTask(turns, turn.task))
+		rec := auditRecord{Mode: "interactive", Task: turn.task, Suggestions: s.suggested, Command: cmd}
+		if cmd != "" {
+			var ok bool
+			if cmd, ok = s.fill(cmd); ok {
+				rec.Command = cmd
+			}
+		}
+		if cmd == "" || !s.confirmRun(cmd) {
+			s.audit(rec)
+			turns = append(turns, turn)
+			continue
+		}
+
+		fmt.Fprintln(s.ui, cmd)
+		out := newTailBuffer(limit)
+		turn.command = cmd
+		turn.exitCode = s.auditRun(rec, func() int {
+			if err := runCommandCapture(cmd, out); err != nil {
+				return exitCode(err)
+			}
+			return 0
+		})
+		s.remember(turn.task, cmd, &turn.exitCode)
+		s.addToShellHistory(cmd)
+		turn.output = redactSecrets(out.String())
+		if turn.exitCode != 0 {
+			fmt.Fprintf(s.ui, "[exit %d]\n", turn.exitCode)
+		}
+		turns = append(turns, turn)
+	}
+}
+
+// sessionTask prefixes task with a summary of the recent turns.
+func sessionTask(turns []replTurn, task string) string {
+	if len(turns) == 0 {
+		return task
+	}
+	turns = turns[max(len(turns)-replHistoryTurns, 0):]
+
+	var b strings.Builder
+	b.WriteString("This task is part of an interactive session. Earlier turns, oldest first:\n")
+	for i, t := range turns {
+		fmt.Fprintf(&b, "\n%d. Task: %s\n", i+1, t.task)
+		if t.command == "" {
+			b.WriteString("   No command was run.\n")
+			continue
+		}
+		fmt.Fprintf(&b, "   Command: %s\n   Exit code: %d\n", t.command, t.exitCode)
+		if i >= len(turns)-replOutputTurns && strings.TrimSpace(t.output) != "" {
+			fmt.Fprintf(&b, "   Output:\n%s\n", indent(strings.TrimRight(t.output, "\n"), "     "))
+		}
+	}
+	b.WriteString("\nCurrent task (it may refer to the turns above):\n")
+	b.WriteString(task)
+	return b.String()
+}
+
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// runReport is the document --json writes to stdout once a task is done,
+// for wrappers, editors and CI jobs to read instead of the human output.
+type runReport struct {
+	Task        string             `json:"task"`
+	Context     map[string]string  `json:"context"` // the environment details sent with the prompt
+	Provider    string             `json:"provider"`
+	Model       string             `json:"model,omitempty"`
+	Cached      bool               `json:"cached,omitempty"` // suggestions reused from an earlier identical request
+	Suggestions []reportSuggestion `json:"suggestions"`
+	Reply       string             `json:"reply,omitempty"`     // the model's reply when it suggested no command
+	Command     string             `json:"command,omitempty"`   // picked; "" when none was
+	ExitCode    *int               `json:"exit_code,omitempty"` // nil when the command didn't run
+	Status      int                `json:"status"`              // ai's own exit status
+	Timings     reportTimings      `json:"timings"`
+	Usage       ai.Usage           `json:"usage"`
+	CostUSD     *float64           `json:"cost_usd,omitempty"` // nil when the price of a model is unknown
+	explained   map[string]string  // --explain-all notes by command
+	start       time.Time
+	costUSD     float64
+	costKnown   bool
+}
+
+// reportSuggestion is a suggested command with its risk rating, the models
+// that suggested it and, with --explain-all, what it does.
+type reportSuggestion struct {
+	Command     string   `json:"command"`
+	Risk        string   `json:"risk"` // low, medium or high
+	RiskReason  string   `json:"risk_reason,omitempty"`
+	Explanation string   `json:"explanation,omitempty"`
+	Models      []string `json:"models,omitempty"` // the models that suggested it
+}
+
+// reportTimings says where the time of a run went, in milliseconds.
+type reportTimings struct {
+	ModelMS   int64 `json:"model_ms"`   // waiting for the model
+	CommandMS int64 `json:"command_ms"` // running the picked command
+	TotalMS   int64 `json:"total_ms"`
+}
+
+// newRunReport starts the report for task.
+func (s *session) newRunReport(task string) *runReport {
+	r := &runReport{
+		Task:      task,
+		Context:   s.client.Environment,
+		Provider:  s.providerName(),
+		Model:     s.flags.model,
+		start:     time.Now(),
+		costKnown: true,
+		explained: map[string]string{},
+	}
+	if c, ok := s.client.Provider.(ai.Checker); ok {
+		r.Model = c.ModelName()
+	}
+	return r
+}
+
+// waited adds the time since start to the time spent waiting for the model.
+func (s *session) waited(start time.Time) {
+	if s.report != nil {
+		s.report.Timings.ModelMS += time.Since(start).Milliseconds()
+	}
+}
+
+// reportUsage adds a request's token usage and estimated cost to the report.
+func (s *session) reportUsage(usage ai.Usage, usd float64, known bool) {
+	if s.report != nil {
+		s.report.Usage = s.report.Usage.Add(usage)
+		s.report.costUSD += usd
+		s.report.costKnown = s.report.costKnown && known
+	}
+}
+
+// explained keeps the --explain-all notes for cmds for the report.
+func (s *session) explained(cmds, notes []string) {
+	if s.report == nil {
+		return
+	}
+	for i, note := range notes {
+		if note != "" {
+			s.report.explained[cmds[i]] = note
+		}
+	}
+}
+
+// writeReport completes the report with everything suggested for the task
+// and ai's exit status, and writes it to stdout. It returns status.
+func (s *session) writeReport(status int) int {
+	r := s.report
+	r.Status = status
+	r.Suggestions = []reportSuggestion{}
+	for _, cmd := range s.suggested {
+		level, reason := commandRisk(cmd)
+		r.Suggestions = append(r.Suggestions, reportSuggestion{
+			Command:     cmd,
+			Risk:        level.String(),
+			RiskReason:  reason,
+			Explanation: r.explained[cmd],
+			Models:      s.sources.of(cmd),
+		})
+	}
+	if r.costKnown {
+		r.CostUSD = &r.costUSD
+	}
+	r.Timings.TotalMS = time.Since(r.start).Milliseconds()
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return status
+}
@@ -0,0 +1,956 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// dryRunExitCode is returned by --dry-run so scripts can tell that the
+// suggestions were printed but nothing was executed.
+const dryRunExitCode = 3
+
+// runTask is the default command: suggest commands for a task, let the user
+// pick one and run it. It returns the process exit code.
+func runTask(args []string) int {
+	flags, err := parseFlags(args, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2 // the flag package has already reported the error
+	}
+
+	if flags.inputFile != "" && len(flags.task) > 0 {
+		fmt.Fprintln(os.Stderr, "Error: use either --input-file or a task description, not both")
+		return 2
+	}
+	if flags.inputFile != "" && flags.savedTask != "" {
+		fmt.Fprintln(os.Stderr, "Error: use either --input-file or --task, not both")
+		return 2
+	}
+	if flags.interactive && flags.print {
+		fmt.Fprintln(os.Stderr, "Error: --interactive can't be combined with --print")
+		return 2
+	}
+	if flags.agent && (flags.interactive || flags.print || flags.dryRun) {
+		fmt.Fprintln(os.Stderr, "Error: --agent can't be combined with --interactive, --print or --dry-run")
+		return 2
+	}
+	if flags.plan && (flags.interactive || flags.print || flags.agent) {
+		fmt.Fprintln(os.Stderr, "Error: --plan can't be combined with --interactive, --print or --agent")
+		return 2
+	}
+	if flags.json && (flags.interactive || flags.agent || flags.plan) {
+		fmt.Fprintln(os.Stderr, "Error: --json can't be combined with --interactive, --agent or --plan")
+		return 2
+	}
+	if flags.choose > 0 && (flags.yes || flags.dryRun || flags.interactive || flags.agent || flags.plan) {
+		fmt.Fprintln(os.Stderr, "Error: --choose can't be combined with --yes, --dry-run, --interactive, --agent or --plan")
+		return 2
+	}
+	if flags.fanOut != "" && (flags.provider != "" || flags.model != "" || flags.profile != "") {
+		fmt.Fprintln(os.Stderr, "Error: --fan-out can't be combined with --provider, --model or --profile")
+		return 2
+	}
+	if flags.inputFile == "" && flags.savedTask == "" && len(flags.task) == 0 && !flags.interactive {
+		fmt.Fprintln(os.Stderr, "Error: missing task description (see ai --help)")
+		return 2
+	}
+
+	task := strings.Join(flags.task, " ")
+	if flags.inputFile != "" {
+		var err error
+		task, err = readTaskFile(flags.inputFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 2
+		}
+	}
+	if strings.TrimSpace(task) == "" && !flags.interactive && flags.savedTask == "" {
+		fmt.Fprintln(os.Stderr, "Error: task description is empty")
+		return 2
+	}
+
+	s, code := newSession(flags)
+	if s == nil {
+		return code
+	}
+	if flags.savedTask != "" {
+		var err error
+		if task, err = expandTask(s.cfg.Tasks, flags.savedTask, flags.task); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 2
+		}
+		if task == "" && !flags.interactive {
+			fmt.Fprintln(os.Stderr, "Error: task description is empty")
+			return 2
+		}
+	}
+
+	if flags.showRedacted {
+		s.attachFiles(task, os.Stderr)
+		return s.showRedacted(task)
+	}
+	if flags.interactive {
+		return s.repl(task)
+	}
+
+	if !s.checkSecrets(task) {
+		return 1
+	}
+	s.attachFiles(task, os.Stderr)
+	if flags.agent {
+		return s.agent(task)
+	}
+	if flags.plan {
+		return s.plan(task)
+	}
+	if flags.json {
+		s.report = s.newRunReport(task)
+		return s.writeReport(s.pickAndRun(task))
+	}
+	// Flags that pick a command ask for one, so piped data doesn't turn
+	// their task into a question; an answer passed to eval would run as a
+	// command.
+	if stdinPiped() && !flags.print && !flags.yes && flags.choose == 0 && !flags.dryRun {
+		return s.answer(task)
+	}
+	return s.pickAndRun(task)
+}
+
+// session holds what is needed to turn tasks into commands; runTask uses it
+// once and the interactive mode once per turn.
+type session struct {
+	flags  *cliFlags
+	cfg    config
+	client *ai.Client        // provider, environment context and prompt extras
+	env    map[string]string // the context of every request, before attachments and the budget
+	budget tokenBudget
+	ledger *usageLedger
+	ui     *os.File // menu and prompts
+
+	auditLog  *os.File              // nil when there is no audit log
+	suggested []string              // everything the last choose offered, for the audit log
+	past      func() []historyEntry // the history, read on first use; nil when unavailable
+	report    *runReport            // nil unless --json is set
+	sources   *commandSources       // which models suggested what choose offered
+	log       *slog.Logger          // what -v and --log-file ask for
+}
+
+// newSession loads the configuration, provider and token budget selected by
+// flags. On failure it reports the error and returns nil with the exit code.
+func newSession(flags *cliFlags) (*session, int) {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return nil, 2
+	}
+	for _, w := range cfg.warnings {
+		fmt.Fprintln(os.Stderr, "Warning:", w)
+	}
+	if err := cfg.selectProfile(flags.profile); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return nil, 2
+	}
+	var provider ai.Provider
+	if cfg.spread = fanOutEntries(cfg, flags); cfg.spread != nil {
+		provider, err = resolveFanOut(cfg, cfg.spread, flags.opts)
+	} else {
+		provider, err = resolveProvider(cfg, flags.provider, flags.model, flags.opts)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return nil, 2
+	}
+	if flags.opts.Seed != nil && cfg.spread == nil {
+		switch name := resolveProviderName(cfg, flags.provider); name {
+		case "openai", "azure", "anthropic":
+			fmt.Fprintf(os.Stderr, "Warning: --seed is ignored by the %s provider, whose API has no seed parameter\n", name)
+		}
+	}
+
+	budget, err := loadBudget(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return nil, 2
+	}
+	// Saving a ledger that couldn't be read would replace the usage
+	// recorded so far, and the budget couldn't be enforced meanwhile.
+	// Without a state directory nothing was recorded to begin with, which
+	// only matters when a budget has to be enforced.
+	ledger, err := loadUsage()
+	switch {
+	case err == nil:
+	case errors.Is(err, errNoStateDir) && (!budget.enabled() || flags.ignoreBudget):
+		fmt.Fprintln(os.Stderr, "Warning: token usage won't be recorded:", err)
+	case errors.Is(err, errNoStateDir):
+		fmt.Fprintf(os.Stderr, "Error: the token budget can't be enforced: %v; set XDG_STATE_HOME or HOME, or pass --ignore-budget\n", err)
+		return nil, 2
+	default:
+		fmt.Fprintf(os.Stderr, "Error: token usage: %v; fix or delete the file to start over\n", err)
+		return nil, 2
+	}
+	log, err := newLogger(flags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return nil, 2
+	}
+	// Without its audit log nothing may run, so an unwritable one is fatal.
+	var auditLog *os.File
+	if path := auditLogPath(cfg); path != "" {
+		if auditLog, err = openAuditLog(path); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return nil, 2
+		}
+	}
+
+	// Validated when the config was loaded.
+	_ = flags.ctxOpts.enable(cfg.Context)
+	env := gatherContext(flags.ctxOpts)
+	maps.Copy(env, gatherMCPContext(cfg.MCPServers, os.Stderr))
+	if dir, err := contextScriptDir(); err == nil {
+		for name, text := range gatherScriptContext(dir, os.Stderr) {
+			if _, taken := env[name]; taken {
+				fmt.Fprintf(os.Stderr, "Warning: context script %s: %q is already in the context; rename the script\n", name, name)
+				continue
+			}
+			env[name] = text
+		}
+	}
+	if len(cfg.Prefer) > 0 {
+		env["user_preferences"] = strings.Join(cfg.Prefer, "; ")
+	}
+	if len(flags.notes) > 0 {
+		env["user_notes"] = strings.Join(flags.notes, "; ")
+	}
+	redactEnvironment(env)
+	s := &session{
+		flags:  flags,
+		cfg:    cfg,
+		client: &ai.Client{Provider: provider, Instructions: cfg.PromptExtra},
+		env:    env,
+		budget: budget,
+		ledger: ledger,
+		ui:     os.Stdout,
+
+		auditLog: auditLog,
+		log:      log,
+		sources:  newCommandSources(),
+		past: sync.OnceValue(func() []historyEntry {
+			entries, _ := loadHistory()
+			return entries
+		}),
+	}
+	s.client.Environment = s.fitEnvironment(env)
+	if err := s.usePromptTemplate(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return nil, 2
+	}
+	// Canned replies cost nothing, and caching them would hide edits to
+	// the fixture.
+	if resolveProviderName(cfg, flags.provider) == "mock" {
+		flags.noCache = true
+	}
+	// With --print, stdout carries only the chosen command, so everything
+	// meant for the user goes to stderr instead.
+	if flags.print {
+		s.ui = os.Stderr
+	}
+	// With --json, stdout carries only the report, so the command's output
+	// goes to stderr as well.
+	if flags.json {
+		s.ui = os.Stderr
+		commandStdout = os.Stderr
+	}
+	return s, 0
+}
+
+// checkSecrets warns when task looks like it contains a credential and
+// reports whether it may be sent.
+func (s *session) checkSecrets(task string) bool {
+	if kinds := findSecrets(task); len(kinds) > 0 && !s.flags.force {
+		fmt.Fprintf(os.Stderr, "Warning: the task appears to contain a secret (%s); it will be sent to the API.\n", strings.Join(kinds, ", "))
+		if !confirm("Send it anyway?") {
+			fmt.Fprintln(os.Stderr, "Aborted. Remove the secret from the task or pass --force.")
+			return false
+		}
+	}
+	return true
+}
+
+// pickAndRun lets the user choose a suggestion for task and runs it, or with
+// --print writes it to stdout. It returns the process exit code.
+func (s *session) pickAndRun(task string) int {
+	choice, code := s.choose(task)
+	rec := auditRecord{Mode: "run", Task: task, Suggestions: s.suggested, Command: choice}
+	if choice == "" {
+		s.audit(rec)
+		return code
+	}
+	choice, ok := s.fill(choice)
+	if !ok {
+		s.audit(rec)
+		return 1
+	}
+	rec.Command = choice
+	if !s.confirmRun(choice) {
+		s.audit(rec)
+		return 1
+	}
+	if s.report != nil {
+		s.report.Command = choice
+	}
+
+	if s.flags.print {
+		s.audit(rec)
+		s.remember(task, choice, nil)
+		if s.report == nil {
+			fmt.Println(choice)
+		}
+		return 0
+	}
+
+	// Echo the command for transparency
+	fmt.Fprintln(commandStdout, choice)
+
+	// Execute with inherited stdio so it behaves like calling directly
+	start := time.Now()
+	code = s.auditRun(rec, func() int {
+		if !s.cfg.explainFailures() {
+			if err := runCommand(choice); err != nil {
+				return exitCode(err)
+			}
+			return 0
+		}
+		return s.runExplainingFailure(choice)
+	})
+	if s.report != nil {
+		s.report.ExitCode = &code
+		s.report.Timings.CommandMS = time.Since(start).Milliseconds()
+	}
+	s.remember(task, choice, &code)
+	s.addToShellHistory(choice)
+	return code
+}
+
+// choose generates suggestions for task and returns the one the user picks.
+// When nothing was picked it returns "" and the exit code to use.
+func (s *session) choose(task string) (string, int) {
+	// Each pass generates suggestions and lets the user pick one. Asking to
+	// regenerate or refine from the menu starts another pass that carries
+	// the feedback so far.
+	// The first pass may reuse a recent answer to the same request; later
+	// passes were asked for because the user wants something new.
+	var feedback []followUp
+	s.suggested = nil
+	s.sources = newCommandSources()
+	for round := 0; ; round++ {
+		roundTask := taskWithFollowUps(task, feedback)
+		commands, cached := []string(nil), false
+		if round == 0 {
+			commands, cached = s.cachedCommands(roundTask)
+			if s.report != nil {
+				s.report.Cached = cached
+			}
+		}
+		if !cached && s.showsGrowingMenu() {
+			sel, shown, ok := s.chooseGrowing(roundTask)
+			s.suggested = append(s.suggested, shown...)
+			if !ok {
+				return "", 1
+			}
+			if sel.command != "" {
+				return sel.command, 0
+			}
+			feedback = append(feedback, feedbackFrom(sel, shown)...)
+			continue
+		}
+
+		if !cached {
+			var ok bool
+			commands, ok = s.generate(roundTask, s.flags.numCommands)
+			if !ok {
+				return "", 1
+			}
+			var unparsable string
+			if commands, unparsable = dropUnparsable(commands); len(commands) == 0 {
+				fmt.Fprintf(os.Stderr, "No suggestion is valid shell syntax (%s)\n", unparsable)
+				return "", 1
+			}
+			s.cacheCommands(roundTask, commands)
+		}
+		if s.flags.judge {
+			commands = s.judge(task, commands)
+		}
+		s.suggested = append(s.suggested, commands...)
+		if s.flags.yes {
+			commands = commands[:1]
+		}
+
+		if s.flags.dryRun {
+			for i, cmd := range commands {
+				if reason := cautionReason(s.cfg, cmd); reason != "" {
+					fmt.Fprintf(os.Stderr, "Warning: suggestion %d looks destructive (%s).\n", i+1, reason)
+				}
+				if s.report == nil {
+					fmt.Println(cmd)
+				}
+			}
+			return "", dryRunExitCode
+		}
+
+		if s.flags.yes {
+			return commands[0], 0
+		}
+		if n := s.flags.choose; n > 0 {
+			if n > len(commands) {
+				fmt.Fprintf(os.Stderr, "Error: --choose %d, but there are only %d suggestions\n", n, len(commands))
+				return "", 1
+			}
+			return commands[n-1], 0
+		}
+		if len(commands) == 1 && s.pickSingle(commands[0]) {
+			return commands[0], 0
+		}
+		var notes []string
+		if s.flags.explainAll {
+			notes = s.rationales(task, commands)
+			s.explained(commands, notes)
+		}
+		sel, err := selectCommand(s.ui, commands, notes, s.flags.compare, s.sources.label)
+		if !selectionOK(err) {
+			return "", 1
+		}
+		if sel.command != "" {
+			return sel.command, 0
+		}
+		feedback = append(feedback, feedbackFrom(sel, commands)...)
+	}
+}
+
+// pickSingle reports whether cmd, the only suggestion left, is used without
+// showing the menu, as single_suggestion says. With "confirm" the user is
+// asked first, unless the safety checks will ask anyway; declining shows the
+// menu, which can still regenerate or refine.
+func (s *session) pickSingle(cmd string) bool {
+	switch s.cfg.SingleSuggestion {
+	case "menu":
+		return false
+	case "confirm":
+		if cautionReason(s.cfg, cmd) != "" {
+			return true
+		}
+		fmt.Fprintf(s.ui, "Only suggestion: %s\n", highlightCommand(cmd, colorEnabled(s.ui)))
+		question := "Run it?"
+		if s.flags.print {
+			question = "Use it?"
+		}
+		return confirm(question)
+	}
+	return true
+}
+
+// selectionOK reports an error from the selection menu to the user and
+// returns whether there was none.
+func selectionOK(err error) bool {
+	if errors.Is(err, errAborted) {
+		fmt.Fprintln(os.Stderr, "Aborted.")
+		return false
+	}
+	if errors.Is(err, errNoTerminal) {
+		fmt.Fprintln(os.Stderr, "Error: stdin is not a terminal, so no suggestion can be picked from the menu; pass --yes to use the first one, --choose <n> to use the nth, or --dry-run to list them")
+		return false
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Selection error:", err)
+		return false
+	}
+	return true
+}
+
+// feedbackFrom returns the follow-up carried by a request to regenerate or
+// refine the suggestions shown in the menu, if any.
+func feedbackFrom(sel menuChoice, shown []string) []followUp {
+	switch {
+	case sel.correction != "":
+		return []followUp{{suggestions: shown, note: sel.correction}}
+	case sel.hint != "":
+		return []followUp{{note: sel.hint}}
+	}
+	return nil
+}
+
+// showsGrowingMenu reports whether the menu can open with the first
+// suggestions and take in the rest as they arrive. Modes that need every
+// suggestion up front, and logging to the terminal, which would garble the
+// menu, wait for all calls instead.
+func (s *session) showsGrowingMenu() bool {
+	f := s.flags
+	return f.numCommands > 1 && !f.yes && !f.dryRun && !f.explainAll && !f.judge && f.choose == 0 && !f.compare && !s.logsToTerminal() && menuInteractive(s.ui)
+}
+
+// chooseGrowing generates suggestions for task and shows the menu as soon as
+// the first call has answered, adding the suggestions of the other calls as
+// they come in. It returns the user's choice and the suggestions shown, or
+// false when nothing was generated or the menu failed.
+func (s *session) chooseGrowing(task string) (menuChoice, []string, bool) {
+	if !s.withinBudget() {
+		return menuChoice{}, nil, false
+	}
+
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	ctx, view := s.watch(ctx)
+
+	// The provider reports each call on arrived as it completes; once the
+	// menu is up, merged lists are handed to it on more.
+	n := s.flags.numCommands
+	arrived := make(chan ai.Result, n)
+	ctx = ai.WithResults(ctx, func(r ai.Result) {
+		if view != nil {
+			view.callDone(r)
+		}
+		arrived <- r
+	})
+	var genErr error
+	finished := false // every call answered before the user chose
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, genErr = s.client.Generate(ctx, ai.Task{Description: task, N: n})
+		finished = ctx.Err() == nil
+		close(arrived)
+	}()
+
+	var usage ai.Usage
+	var usd float64
+	known := true
+	var declined string // the first reply without a command
+	account := func(r ai.Result) {
+		declined = cmp.Or(declined, r.Declined())
+		usage = usage.Add(r.Usage)
+		c, ok := callsCost([]ai.Result{r})
+		usd, known = usd+c, known && ok
+	}
+	start := time.Now()
+	var commands []string
+	var dropped string // why the first dropped suggestion was dropped
+	usable := func(r ai.Result) []string {
+		s.sources.add(r)
+		cmds, blocked := s.cfg.dropBlocked(r.Commands)
+		cmds, unparsable := dropUnparsable(cmds)
+		dropped = cmp.Or(dropped, blocked, unparsable)
+		return cmds
+	}
+	// A single suggestion may be used without the menu, so the menu waits
+	// for a second one unless single_suggestion asks for it regardless.
+	waitForTwo := s.cfg.SingleSuggestion != "menu"
+	allArrived := true
+	for r := range arrived {
+		account(r)
+		if r.Error == nil {
+			commands = s.arrange(task, ai.DedupCommands(append(commands, usable(r)...)))
+		}
+		if len(commands) > 1 || len(commands) == 1 && !waitForTwo {
+			allArrived = false
+			break
+		}
+	}
+	if view != nil {
+		view.clear()
+	}
+	s.waited(start)
+
+	var shown []string
+	var sel menuChoice
+	var selErr error
+	if len(commands) == 1 && allArrived && s.pickSingle(commands[0]) {
+		sel, shown = menuChoice{command: commands[0]}, commands
+	} else if len(commands) > 0 {
+		more := make(chan []string)
+		merged := make(chan struct{})
+		go func() {
+			defer close(merged)
+			for r := range arrived {
+				account(r)
+				if r.Error != nil {
+					continue
+				}
+				next := s.arrange(task, ai.DedupCommands(append(slices.Clone(commands), usable(r)...)))
+				if len(next) == len(commands) {
+					continue
+				}
+				select {
+				case more <- next:
+					commands = next
+				case <-ctx.Done():
+				}
+			}
+		}()
+		sel, selErr = selectGrowing(s.ui, commands, s.sources.label, more)
+		// Calls still running when the user has decided are not needed.
+		cancel()
+		<-merged
+		shown = commands
+	}
+	<-done
+
+	s.recordUsage(usage, usd, known)
+	if len(shown) == 0 {
+		if genErr != nil {
+			reportAPIError(genErr)
+		} else if dropped != "" {
+			fmt.Fprintf(os.Stderr, "Every suggestion was dropped (%s)\n", dropped)
+		} else {
+			s.noCommands(declined)
+		}
+		return menuChoice{}, nil, false
+	}
+	if finished {
+		s.cacheCommands(task, shown)
+	}
+	return sel, shown, selectionOK(selErr)
+}
+
+// generate makes n API calls for task within the token budget and returns
+// the combined, deduplicated commands. Failures are reported to the user and
+// yield false.
+func (s *session) generate(task string, n int) ([]string, bool) {
+	if !s.withinBudget() {
+		return nil, false
+	}
+
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	ctx, view := s.watch(ctx)
+	start := time.Now()
+	results, err := s.client.Generate(ctx, ai.Task{Description: task, N: n})
+	if view != nil {
+		view.clear()
+	}
+	s.waited(start)
+	if err != nil {
+		reportAPIError(err)
+		return nil, false
+	}
+	if len(results) == 0 {
+		s.noCommands("")
+		return nil, false
+	}
+	usd, known := callsCost(results[1:])
+	s.recordUsage(results[0].Usage, usd, known)
+	for _, r := range results[1:] {
+		s.sources.add(r)
+	}
+	if len(results[0].Commands) == 0 {
+		var declined string
+		for _, r := range results[1:] {
+			declined = cmp.Or(declined, r.Declined())
+		}
+		s.noCommands(declined)
+		return nil, false
+	}
+	commands, blocked := s.cfg.dropBlocked(results[0].Commands)
+	if len(commands) == 0 {
+		fmt.Fprintf(os.Stderr, "Every suggestion was blocked (%s)\n", blocked)
+		return nil, false
+	}
+	commands = s.arrange(task, commands)
+
+	s.logResults(results)
+	return commands, true // combined/aggregated commands
+}
+
+// noCommands tells the user that no command was suggested, showing the
+// model's reply instead when it declined the task or answered in prose.
+func (s *session) noCommands(declined string) {
+	if declined == "" {
+		fmt.Fprintln(os.Stderr, "No commands generated")
+		return
+	}
+	if s.report != nil {
+		s.report.Reply = declined
+	}
+	fmt.Fprintln(os.Stderr, "The model replied without suggesting a command:")
+	fmt.Fprintln(os.Stderr, declined)
+}
+
+// watch shows the progress of the request made with ctx on the terminal,
+// streaming the reply unless --no-stream is set. It returns the context to
+// make the request with and the view to clear once it is done, or nil when
+// stderr isn't a terminal. The view is drawn on stderr so that it never
+// ends up in the output of ai itself.
+func (s *session) watch(ctx context.Context) (context.Context, *liveView) {
+	view := newLiveView(os.Stderr)
+	if view == nil {
+		return ctx, nil
+	}
+	ctx = ai.WithCalls(ctx, view.setCalls)
+	ctx = ai.WithResults(ctx, view.callDone)
+	if !s.flags.noStream {
+		ctx = ai.WithStream(ctx, view.update)
+	}
+	return ctx, view
+}
+
+// complete sends prompt as a single free-form request within the token
+// budget and returns the reply text. Failures are reported to the user and
+// yield false.
+func (s *session) complete(prompt string) (string, bool) {
+	if !s.withinBudget() {
+		return "", false
+	}
+
+	ctx, cancel := s.requestContext()
+	defer cancel()
+	_, view := s.watch(ctx)
+	start := time.Now()
+	result, err := s.client.Provider.Complete(ctx, prompt)
+	if view != nil {
+		view.clear()
+	}
+	s.waited(start)
+	usd, known := callsCost([]ai.Result{result})
+	s.recordUsage(result.Usage, usd, known)
+	if err != nil {
+		reportAPIError(err)
+		return "", false
+	}
+	s.log.Info("reply received", "model", result.Model, "elapsed", result.Duration, "retries", result.Retries,
+		"input_tokens", result.Usage.InputTokens, "output_tokens", result.Usage.OutputTokens,
+		"cost", describeCost(usd, known), "budget", s.budget.describe(s.ledger, time.Now()))
+	if len(result.RawResponse) > 0 {
+		s.log.Debug("raw response", "body", result.RawResponse)
+	}
+	return strings.TrimSpace(result.Text), true
+}
+
+// cacheKey identifies a request for suggestions to task: the prompt with
+// its environment details plus everything that selects and tunes the model.
+func (s *session) cacheKey(task string) string {
+	model := s.flags.model
+	if c, ok := s.client.Provider.(ai.Checker); ok {
+		model = c.ModelName()
+	}
+	var active profile
+	if s.cfg.active != nil {
+		active = *s.cfg.active
+	}
+	baseURL := firstNonEmpty(active.BaseURL, os.Getenv("AI_BASE_URL"), s.cfg.BaseURL)
+	opts := fmt.Sprintf("n=%d tools=%t", s.flags.numCommands, s.flags.opts.Tools)
+	if s.flags.opts.Seed != nil {
+		opts += fmt.Sprintf(" seed=%d", *s.flags.opts.Seed)
+	}
+	prompt := s.client.Prompt(ai.Task{Description: task})
+	return cacheKey(s.providerName(), model, baseURL, opts, prompt)
+}
+
+// providerName names the provider requests go to, or with fan_out the
+// profiles and providers they are spread over.
+func (s *session) providerName() string {
+	if s.cfg.spread != nil {
+		return strings.Join(s.cfg.spread, ", ")
+	}
+	return resolveProviderName(s.cfg, s.flags.provider)
+}
+
+// cachedCommands returns recent suggestions for the same request, unless
+// --no-cache is set.
+func (s *session) cachedCommands(task string) ([]string, bool) {
+	if s.flags.noCache {
+		return nil, false
+	}
+	e, ok := loadCached(s.cacheKey(task), time.Now())
+	if !ok {
+		return nil, false
+	}
+	// Deny patterns may have been added since the suggestions were cached.
+	commands, _ := s.cfg.dropBlocked(e.Commands)
+	if len(commands) == 0 {
+		return nil, false
+	}
+	s.log.Info("using cached suggestions (--no-cache to ask again)", "age", time.Since(e.Created).Round(time.Second))
+	return s.arrange(task, commands), true
+}
+
+// cacheCommands saves suggestions for task so an identical request can
+// reuse them.
+func (s *session) cacheCommands(task string, commands []string) {
+	if s.flags.noCache {
+		return
+	}
+	if err := storeCached(s.cacheKey(task), commands, time.Now()); err != nil {
+		s.log.Warn("could not cache suggestions", "error", err)
+	}
+}
+
+// recordUsage adds a request's token usage and estimated cost to the
+// ledger and saves it.
+func (s *session) recordUsage(usage ai.Usage, usd float64, known bool) {
+	s.reportUsage(usage, usd, known)
+	s.ledger.add(time.Now(), usage, usd, known)
+	if err := s.ledger.save(time.Now()); err != nil {
+		s.log.Warn("could not record token usage", "error", err)
+	}
+}
+
+// requestContext returns the context for one request to the model, bounded
+// by --deadline when it is set and cancelled by Ctrl-C.
+func (s *session) requestContext() (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if s.flags.deadline > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), s.flags.deadline)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	cancelOnInterrupt(ctx, cancel)
+	return ai.WithLogger(ctx, s.log), cancel
+}
+
+// withinBudget reports whether another request fits the token budget,
+// telling the user when it doesn't.
+func (s *session) withinBudget() bool {
+	if s.flags.ignoreBudget {
+		return true
+	}
+	if err := s.budget.check(s.ledger, time.Now()); err != nil {
+		if s.budget.Warn {
+			fmt.Fprintln(os.Stderr, "Warning:", err)
+			return true
+		}
+		fmt.Fprintln(os.Stderr, "Error:", err, "(use --ignore-budget to override)")
+		return false
+	}
+	return true
+}
+
+// confirmRun asks before running a command that needs caution and reports
+// whether to go ahead. A multi-line command, of which the menu shows only
+// the first line, is shown whole and asked about unless --yes or --choose
+// picked it.
+func (s *session) confirmRun(cmd string) bool {
+	if strings.Contains(cmd, "\n") && !s.flags.yes && s.flags.choose == 0 {
+		fmt.Fprintln(s.ui, "Command:")
+		fmt.Fprintln(s.ui, "  "+highlightCommand(strings.ReplaceAll(cmd, "\n", "\n  "), colorEnabled(s.ui)))
+		// A command needing caution is asked about below instead.
+		if cautionReason(s.cfg, cmd) == "" && !s.cfg.allowed(cmd) {
+			question := "Run it?"
+			if s.flags.print {
+				question = "Use it?"
+			}
+			if !confirm(question) {
+				fmt.Fprintln(os.Stderr, "Aborted.")
+				return false
+			}
+			return true
+		}
+	}
+	if !approveCommand(s.cfg, cmd, false, "Run it anyway?") {
+		fmt.Fprintln(os.Stderr, "Aborted.")
+		return false
+	}
+	return true
+}
+
+// approveCommand warns about a command that needs caution and asks whether
+// to run it: blocked commands never run and allowed ones always do,
+// high-risk commands only run after the user types "yes", those matching a
+// confirm pattern after y. Other commands are asked about only when always
+// is set.
+func approveCommand(cfg config, cmd string, always bool, question string) bool {
+	if reason := cfg.denyReason(cmd); reason != "" {
+		fmt.Fprintf(os.Stderr, "Refused: this command is blocked (%s).\n", reason)
+		return false
+	}
+	if cfg.allowed(cmd) {
+		return true
+	}
+	if level, reason := commandRisk(cmd); level == riskHigh {
+		fmt.Fprintf(os.Stderr, "%s this command is high risk (%s).\n", paint("Warning:", ansiHighRisk, colorEnabled(os.Stderr)), reason)
+		return confirmTyped(question, "yes")
+	}
+	if reason := cfg.confirmReason(cmd); reason != "" {
+		fmt.Fprintf(os.Stderr, "Warning: this command looks destructive (%s).\n", reason)
+		return confirm(question)
+	}
+	return !always || confirm(question)
+}
+
+// exitCode maps an error from running a command to the exit code to report.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return statusCode(status)
+		}
+		return exitErr.ExitCode()
+	}
+	var waitErr *waitError
+	if errors.As(err, &waitErr) {
+		return statusCode(waitErr.status)
+	}
+	fmt.Fprintln(os.Stderr, "Execution error:", err)
+	return 1
+}
+
+// cautionReason reports why cmd needs caution: it is blocked, or it needs
+// confirmation before running because it is high risk or matches one of
+// the configured confirm patterns without being allowed.
+func cautionReason(cfg config, cmd string) string {
+	if reason := cfg.denyReason(cmd); reason != "" {
+		return reason
+	}
+	if cfg.allowed(cmd) {
+		return ""
+	}
+	if level, reason := commandRisk(cmd); level == riskHigh {
+		return reason
+	}
+	return cfg.confirmReason(cmd)
+}
+
+// followUp is feedback given from the menu: a correction to the listed
+// suggestions, or, without suggestions, a hint for fresh ones.
+type followUp struct {
+	suggestions []string
+	note        string
+}
+
+// taskWithFollowUps appends the feedback from earlier rounds to the task so
+// the model can refine its answer instead of starting over.
+func taskWithFollowUps(task string, feedback []followUp) string {
+	if len(feedback) == 0 {
+		return task
+	}
+	var b strings.Builder
+	b.WriteString(task)
+	b.WriteString("\n\nEarlier rounds:\n")
+	for _, f := range feedback {
+		if len(f.suggestions) == 0 {
+			fmt.Fprintf(&b, "- The user asked for different suggestions: %s\n", f.note)
+			continue
+		}
+		b.WriteString("- You suggested:\n")
+		for _, cmd := range f.suggestions {
+			fmt.Fprintf(&b, "    %s\n", cmd)
+		}
+		fmt.Fprintf(&b, "  The user replied: %s\n", f.note)
+	}
+	b.WriteString("Answer the task again, taking the user's replies into account.")
+	return b.String()
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// shellSegments splits a command line into simple commands, each a list of
+// words, the way a POSIX shell would tokenize it: quotes group words and are
+// removed, and unquoted ; & | and newlines separate commands. Redirection
+// operators are emitted as their own words. The bodies of $(...) and `...`
+// substitutions are returned as additional segments since the shell executes
+// them even inside double quotes. The bodies of here-documents are data and
+// are skipped.
+func shellSegments(cmd string) [][]string {
+	var segments [][]string
+	var words []string
+	var word strings.Builder
+	inWord := false
+	// Here-documents whose delimiter word comes next or whose body starts
+	// after the current line.
+	var heredocs []heredoc
+	delimNext := false
+
+	flushWord := func() {
+		if inWord {
+			if delimNext {
+				heredocs[len(heredocs)-1].delim = word.String()
+				delimNext = false
+			}
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	flushSegment := func() {
+		flushWord()
+		if len(words) > 0 {
+			segments = append(segments, words)
+			words = nil
+		}
+	}
+	nested := func(body string) {
+		segments = append(segments, shellSegments(body)...)
+	}
+
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case c == '\\':
+			if i+1 < len(cmd) {
+				i++
+				word.WriteByte(cmd[i])
+			}
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(cmd[i+1:], '\'')
+			if end < 0 {
+				end = len(cmd) - i - 1
+			}
+			word.WriteString(cmd[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(cmd) && cmd[i] != '"'; i++ {
+				switch {
+				case cmd[i] == '\\' && i+1 < len(cmd):
+					i++
+					word.WriteByte(cmd[i])
+				case cmd[i] == '$' && i+1 < len(cmd) && cmd[i+1] == '(':
+					body, n := substitutionBody(cmd[i+2:])
+					nested(body)
+					word.WriteString(cmd[i : i+2+n])
+					i += 1 + n
+				case cmd[i] == '`':
+					end := strings.IndexByte(cmd[i+1:], '`')
+					if end < 0 {
+						end = len(cmd) - i - 1
+					}
+					nested(cmd[i+1 : i+1+end])
+					i += end + 1
+				default:
+					word.WriteByte(cmd[i])
+				}
+			}
+			inWord = true
+		case c == '$' && i+1 < len(cmd) && cmd[i+1] == '(':
+			body, n := substitutionBody(cmd[i+2:])
+			nested(body)
+			word.WriteString(cmd[i : i+2+n])
+			i += 1 + n
+			inWord = true
+		case c == '`':
+			end := strings.IndexByte(cmd[i+1:], '`')
+			if end < 0 {
+				end = len(cmd) - i - 1
+			}
+			nested(cmd[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '\n':
+			flushSegment()
+			for _, h := range heredocs {
+				i = h.skipBody(cmd, i)
+			}
+			heredocs = nil
+		case c == ';' || c == '&' || c == '|' || c == '(' || c == ')':
+			flushSegment()
+		case c == '>' || c == '<':
+			flushWord()
+			op := string(c)
+			if i+1 < len(cmd) && cmd[i+1] == c {
+				op += string(c)
+				i++
+			}
+			if op == "<<" {
+				switch {
+				case i+1 < len(cmd) && cmd[i+1] == '<':
+					// A here-string takes a word, not a body.
+					op += "<"
+					i++
+				case i+1 < len(cmd) && cmd[i+1] == '-':
+					i++
+					heredocs = append(heredocs, heredoc{tabs: true})
+					delimNext = true
+				default:
+					heredocs = append(heredocs, heredoc{})
+					delimNext = true
+				}
+			}
+			words = append(words, op)
+		case c == ' ' || c == '\t':
+			flushWord()
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	flushSegment()
+	return segments
+}
+
+// heredoc is a here-document: the word ending its body and, for <<-,
+// whether leading tabs are stripped from its lines.
+type heredoc struct {
+	delim string
+	tabs  bool
+}
+
+// skipBody returns the index of the newline ending the body of h, which
+// starts after the newline at i in cmd, or the end of cmd when it isn't
+// ended.
+func (h heredoc) skipBody(cmd string, i int) int {
+	for i < len(cmd) {
+		end := strings.IndexByte(cmd[i+1:], '\n')
+		if end < 0 {
+			return len(cmd)
+		}
+		line := cmd[i+1 : i+1+end]
+		i += 1 + end
+		if h.tabs {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == h.delim {
+			return i
+		}
+	}
+	return i
+}
+
+// substitutionBody returns the contents of a $( ... ) substitution starting
+// just after the opening parenthesis, and the number of bytes consumed
+// including the closing parenthesis.
+func substitutionBody(s string) (string, int) {
+	depth := 1
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s[:i], i + 1
+			}
+		}
+	}
+	return s, len(s)
+}
+
+// commandWrappers run the command that follows them; their own flags are skipped.
+var commandWrappers = map[string]bool{
+	"sudo": true, "doas": true, "env": true, "nohup": true, "time": true,
+	"command": true, "exec": true, "builtin": true, "xargs": true, "nice": true,
+}
+
+// wrapperValueFlags are wrapper options that consume the following word.
+var wrapperValueFlags = map[string]bool{
+	"sudo -u": true, "sudo -g": true, "sudo -C": true, "sudo -D": true, "sudo -h": true,
+	"sudo -p": true, "sudo -r": true, "sudo -t": true, "sudo -U": true,
+	"doas -u": true, "doas -C": true, "nice -n": true, "xargs -I": true, "xargs -n": true,
+	"xargs -P": true, "xargs -L": true, "xargs -d": true, "xargs -s": true, "xargs -E": true,
+}
+
+// riskLevel rates how much harm a command can do if it isn't what the user
+// wanted.
+type riskLevel int
+
+const (
+	riskLow    riskLevel = iota // reads or creates things
+	riskMedium                  // changes or removes things that can be recovered, or runs as root
+	riskHigh                    // destroys data or the system in ways that can't be undone
+)
+
+func (l riskLevel) String() string {
+	switch l {
+	case riskHigh:
+		return "high"
+	case riskMedium:
+		return "medium"
+	}
+	return "low"
+}
+
+// shellNames are the shells that run a script piped into them.
+var shellNames = map[string]bool{
+	"sh": true, "bash": true, "zsh": true, "dash": true, "ksh": true, "fish": true,
+}
+
+// psDownloaders are the PowerShell cmdlets and aliases that fetch URLs.
+var psDownloaders = map[string]bool{
+	"invoke-webrequest": true, "iwr": true, "invoke-restmethod": true, "irm": true,
+}
+
+// psRemovers are Remove-Item and its aliases other than rm, whose POSIX
+// flags are checked on their own.
+var psRemovers = map[string]bool{
+	"remove-item": true, "ri": true, "del": true, "erase": true, "rd": true,
+}
+
+// commandRisk statically rates cmd and says why, without running anything.
+// High risk covers what destructiveReason reports, downloads piped into a
+// shell and shutting the machine down; medium covers running as root,
+// deleting or overwriting files, and stopping processes or services.
+func commandRisk(cmd string) (riskLevel, string) {
+	level, reason := riskLow, ""
+	raise := func(l riskLevel, r string) {
+		if l > level {
+			level, reason = l, r
+		}
+	}
+	segments := shellSegments(cmd)
+	downloaded := false
+	for _, words := range segments {
+		if r := destructiveSegment(words); r != "" {
+			raise(riskHigh, r)
+		}
+		args := stripWrappers(words)
+		if len(args) == 0 {
+			continue
+		}
+		name := filepath.Base(args[0])
+		switch lower := strings.ToLower(name); {
+		case name == "curl" || name == "wget" || psDownloaders[lower]:
+			downloaded = true
+		case downloaded && shellNames[name] && (len(args) == 1 || strings.HasPrefix(args[1], "-")):
+			raise(riskHigh, "runs a downloaded script in "+name)
+		case downloaded && (lower == "invoke-expression" || lower == "iex"):
+			raise(riskHigh, "runs a downloaded script with "+name)
+		}
+		raise(segmentRisk(words, args))
+	}
+	return level, reason
+}
+
+// segmentRisk rates one simple command whose effective command, without
+// wrappers such as sudo, is args, for the risks destructiveSegment doesn't
+// cover.
+func segmentRisk(words, args []string) (riskLevel, string) {
+	nushell := ai.DialectOf(targetShell()) == ai.DialectNushell
+	for i, w := range words {
+		// In Nushell > compares; it redirects with out> instead.
+		redirect := w == ">"
+		if nushell {
+			redirect = w == "out>" || w == "o>"
+		}
+		// Devices are destructiveSegment's, or harmless like /dev/null.
+		if redirect && i+1 < len(words) && !strings.HasPrefix(words[i+1], "/dev/") {
+			return riskMedium, "overwrites " + words[i+1]
+		}
+	}
+	name := filepath.Base(args[0])
+	switch name {
+	case "shutdown", "reboot", "poweroff", "halt":
+		return riskHigh, name + " stops the machine"
+	case "rm", "rmdir", "unlink", "truncate":
+		return riskMedium, name + " removes data"
+	case "mv":
+		return riskMedium, "mv may overwrite files"
+	case "kill", "pkill", "killall":
+		return riskMedium, name + " stops processes"
+	case "su", "pkexec":
+		return riskMedium, "runs as another user"
+	case "systemctl":
+		if len(args) > 1 && slices.Contains([]string{"stop", "restart", "disable", "mask", "kill"}, args[1]) {
+			return riskMedium, "systemctl " + args[1] + " changes running services"
+		}
+	case "git":
+		if len(args) > 1 && (args[1] == "clean" ||
+			args[1] == "reset" && hasLongFlag(args[2:], "--hard") ||
+			args[1] == "push" && (hasLongFlag(args[2:], "--force") || shortFlags(args[2:])['f'])) {
+			return riskMedium, "git " + args[1] + " discards changes"
+		}
+	}
+	// PowerShell commands are case-insensitive.
+	switch lower := strings.ToLower(name); {
+	case lower == "stop-computer" || lower == "restart-computer":
+		return riskHigh, name + " stops the machine"
+	case psRemovers[lower]:
+		return riskMedium, name + " removes data"
+	case lower == "move-item":
+		return riskMedium, name + " may overwrite files"
+	case lower == "stop-process":
+		return riskMedium, name + " stops processes"
+	case lower == "stop-service" || lower == "restart-service" || lower == "set-service":
+		return riskMedium, name + " changes running services"
+	}
+	for _, w := range words[:len(words)-len(args)] {
+		if n := filepath.Base(w); n == "sudo" || n == "doas" {
+			return riskMedium, "runs as root with " + n
+		}
+	}
+	return riskLow, ""
+}
+
+// destructiveReason reports why cmd looks destructive, or "" if it doesn't.
+// It works on shell words rather than raw substrings, so quoted text such as
+// echo "rm -rf" is ignored while rm -r -f and sudo rm -fr are caught.
+func destructiveReason(cmd string) string {
+	for _, words := range shellSegments(cmd) {
+		if reason := destructiveSegment(words); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+func destructiveSegment(words []string) string {
+	// Redirecting into a block device overwrites it regardless of the command.
+	for i, w := range words {
+		if (w == ">" || w == ">>") && i+1 < len(words) && isDeviceTarget(words[i+1]) {
+			return "redirects output into device " + words[i+1]
+		}
+	}
+
+	args := stripWrappers(words)
+	if len(args) == 0 {
+		return ""
+	}
+	name := filepath.Base(args[0])
+	flags := shortFlags(args[1:])
+
+	switch {
+	case name == "rm":
+		recursive := flags['r'] || flags['R'] || hasLongFlag(args[1:], "--recursive")
+		force := flags['f'] || hasLongFlag(args[1:], "--force")
+		if recursive && force {
+			return "rm with recursive and force flags"
+		}
+	case name == "chmod" || name == "chown" || name == "chgrp":
+		if flags['R'] || hasLongFlag(args[1:], "--recursive") {
+			return "recursive " + name
+		}
+	case strings.HasPrefix(name, "mkfs"), name == "wipefs", name == "shred", name == "fdisk", name == "sfdisk", name == "parted":
+		return name + " modifies disks or destroys data"
+	case name == "find":
+		for i, a := range args[1:] {
+			switch a {
+			case "-delete":
+				return "find -delete removes matching files"
+			case "-exec", "-execdir", "-ok", "-okdir":
+				sub := args[i+2:]
+				for j, w := range sub {
+					if w == ";" || w == "+" {
+						sub = sub[:j]
+						break
+					}
+				}
+				if reason := destructiveSegment(sub); reason != "" {
+					return reason
+				}
+			}
+		}
+	case psRemovers[strings.ToLower(name)]:
+		if hasPowerShellParam(args[1:], "recurse") && hasPowerShellParam(args[1:], "force") {
+			return name + " with -Recurse and -Force"
+		}
+	case slices.Contains([]string{"format-volume", "clear-disk", "initialize-disk", "remove-partition"}, strings.ToLower(name)):
+		return name + " modifies disks or destroys data"
+	case name == "dd":
+		for _, a := range args[1:] {
+			if strings.HasPrefix(a, "of=") {
+				return "dd writing to " + strings.TrimPrefix(a, "of=")
+			}
+		}
+	}
+	return ""
+}
+
+// stripWrappers drops leading variable assignments and wrapper commands such
+// as sudo or xargs, along with their options, returning the effective command.
+func stripWrappers(words []string) []string {
+	for len(words) > 0 {
+		w := words[0]
+		switch {
+		case strings.Contains(w, "=") && !strings.HasPrefix(w, "="):
+			words = words[1:]
+		case commandWrappers[filepath.Base(w)]:
+			name := filepath.Base(w)
+			words = words[1:]
+			for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+				if wrapperValueFlags[name+" "+words[0]] && len(words) > 1 {
+					words = words[1:]
+				}
+				words = words[1:]
+			}
+		default:
+			return words
+		}
+	}
+	return words
+}
+
+// shortFlags collects single-letter options, expanding combined forms like -rf.
+// Parsing stops at "--", after which everything is an operand.
+func shortFlags(args []string) map[byte]bool {
+	flags := map[byte]bool{}
+	for _, a := range args {
+		if a == "--" {
+			break
+		}
+		if len(a) < 2 || a[0] != '-' || a[1] == '-' {
+			continue
+		}
+		for i := 1; i < len(a); i++ {
+			flags[a[i]] = true
+		}
+	}
+	return flags
+}
+
+func hasLongFlag(args []string, flag string) bool {
+	for _, a := range args {
+		if a == "--" {
+			return false
+		}
+		if a == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPowerShellParam reports whether args pass the PowerShell parameter
+// param, which may be abbreviated and given in any case, as in -rec or
+// -Force:$true.
+func hasPowerShellParam(args []string, param string) bool {
+	for _, a := range args {
+		a, _, _ = strings.Cut(strings.ToLower(a), ":")
+		if len(a) > 1 && a[0] == '-' && strings.HasPrefix(param, a[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDeviceTarget(path string) bool {
+	if !strings.HasPrefix(path, "/dev/") {
+		return false
+	}
+	switch path {
+	case "/dev/null", "/dev/stdout", "/dev/stderr", "/dev/tty", "/dev/zero":
+		return false
+	}
+	return !strings.HasPrefix(path, "/dev/fd/")
+}
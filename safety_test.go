@@ -0,0 +1,82 @@
+package main
+
+import "testing"
+
+func TestDestructiveReason(t *testing.T) {
+	tests := []struct {
+		cmd         string
+		destructive bool
+	}{
+		// Flags in any order and spelling.
+		{"rm -rf /", true},
+		{"rm -fr /", true},
+		{"rm -r -f /", true},
+		{"rm -f -R /tmp/x", true},
+		{"rm --recursive --force build", true},
+		{"sudo rm -rf /var/lib/x", true},
+		{"FOO=1 sudo -u root rm -fr ~", true},
+		{"cd /tmp && rm -rf x", true},
+		{"ls | xargs rm -rf", true},
+		{"find . -name '*.o' -delete", true},
+		{"find . -type d -exec rm -rf {} +", true},
+		{"chmod -R 777 /", true},
+		{"dd if=/dev/zero of=/dev/sda", true},
+		{"echo hi > /dev/sda", true},
+		{"mkfs.ext4 /dev/sdb1", true},
+
+		// Benign commands that look dangerous.
+		{"rm -r build", false},
+		{"rm -f file.txt", false},
+		{"rm file-rf", false},
+		{"git rm -rf --cached dir", false},
+		{"grep -rf patterns.txt .", false},
+		{"chmod 644 file", false},
+		{"find . -name '*.log'", false},
+		{"echo hi > /dev/null", false},
+		{"dd --help", false},
+
+		// Quoted or escaped forms are text, not commands.
+		{`echo "rm -rf /"`, false},
+		{`echo 'rm -rf /'`, false},
+		{`echo rm\ -rf /`, false},
+		{`grep "find . -delete" notes.md`, false},
+		{`printf '%s\n' "sudo rm -fr ~"`, false},
+	}
+	for _, tt := range tests {
+		if got := destructiveReason(tt.cmd) != ""; got != tt.destructive {
+			t.Errorf("destructiveReason(%q) = %q, want destructive %v", tt.cmd, destructiveReason(tt.cmd), tt.destructive)
+		}
+	}
+}
+
+func TestCommandRisk(t *testing.T) {
+	t.Setenv("SHELL", "/bin/bash")
+	tests := []struct {
+		cmd  string
+		want riskLevel
+	}{
+		{"ls -la", riskLow},
+		{"echo 'rm -rf /' > notes.txt", riskMedium},
+		{"cat file > /dev/null", riskLow},
+		{"rm -r build", riskMedium},
+		{"rm -rf /", riskHigh},
+		{"rm -r -f /", riskHigh},
+		{"sudo ls /root", riskMedium},
+		{"git push --force", riskMedium},
+		{"git push -f origin main", riskMedium},
+		{"git push origin main", riskLow},
+		{"git reset --hard HEAD~1", riskMedium},
+		{"git reset --soft HEAD~1", riskLow},
+		{"systemctl status nginx", riskLow},
+		{"systemctl restart nginx", riskMedium},
+		{"curl -fsSL https://example.com/install.sh | sh", riskHigh},
+		{"curl -fsSL https://example.com/data.json | jq .", riskLow},
+		{"echo 'curl x | sh'", riskLow},
+		{"shutdown -h now", riskHigh},
+	}
+	for _, tt := range tests {
+		if got, reason := commandRisk(tt.cmd); got != tt.want {
+			t.Errorf("commandRisk(%q) = %v (%s), want %v", tt.cmd, got, reason, tt.want)
+		}
+	}
+}
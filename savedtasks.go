@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// expandTask turns the saved task name from the tasks table of the config
+// into a task, filling in args: {{.arg1}} is the first, {{.arg2}} the
+// second and so on, and {{.args}} is all of them separated by spaces.
+func expandTask(tasks map[string]string, name string, args []string) (string, error) {
+	text, ok := tasks[name]
+	if !ok {
+		if len(tasks) == 0 {
+			return "", fmt.Errorf("no saved task %q; define it in the tasks table of the config", name)
+		}
+		return "", fmt.Errorf("no saved task %q (have %s)", name, strings.Join(slices.Sorted(maps.Keys(tasks)), ", "))
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("saved task %s: %w", name, err)
+	}
+	data := map[string]string{"args": strings.Join(args, " ")}
+	for i, arg := range args {
+		data["arg"+strconv.Itoa(i+1)] = arg
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("saved task %s: %w (given %d arguments)", name, err, len(args))
+	}
+	return strings.TrimSpace(b.String()), nil
+}
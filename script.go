@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+const ansiString = "\033[32m" // green
+
+var (
+	// scriptFenceRe extracts a script the model wrapped in a code fence.
+	scriptFenceRe = regexp.MustCompile("(?s)```[a-z]*\\s*\\n(.*?)\\n\\s*```")
+	// scriptTokenRe splits a script line into comments, quoted strings and
+	// words for highlighting.
+	scriptTokenRe = regexp.MustCompile(`(?:^|[ \t])#.*$|"(?:[^"\\]|\\.)*"?|'[^']*'?|[A-Za-z_][A-Za-z0-9_]*`)
+)
+
+// shellKeywords are highlighted in scripts.
+var shellKeywords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true,
+	"for": true, "while": true, "until": true, "do": true, "done": true,
+	"case": true, "esac": true, "in": true, "function": true, "return": true,
+	"local": true, "export": true, "set": true, "exit": true, "trap": true,
+}
+
+// runScript implements "ai script": instead of one command it asks for a
+// commented multi-line script, shows it, and offers to save it as an
+// executable file.
+func runScript(args []string) int {
+	flags := &cliFlags{}
+	fs := newProviderFlagSet("ai script", flags)
+	output := fs.String("o", "", "save the script to `file` without asking")
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: ai script [flags] <task>")
+		fmt.Fprintln(out, "\nWrite a commented shell script for a task and offer to save it.")
+		fmt.Fprintln(out, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	task := strings.TrimSpace(strings.Join(fs.Args(), " "))
+	if task == "" {
+		fs.Usage()
+		return 2
+	}
+
+	s, code := newSession(flags)
+	if s == nil {
+		return code
+	}
+	if !s.checkSecrets(task) {
+		return 1
+	}
+	s.attachFiles(task, os.Stderr)
+	reply, ok := s.complete(buildScriptPrompt(task, s.client.Environment, s.cfg.PromptExtra))
+	if !ok {
+		return 1
+	}
+	script := extractScript(reply)
+	if script == "" {
+		fmt.Fprintln(os.Stderr, "No script generated")
+		return 1
+	}
+
+	// Piped or redirected, stdout gets just the script.
+	if *output == "" && !stdoutTerminal() {
+		fmt.Print(script)
+		return 0
+	}
+	printScript(os.Stdout, script, colorEnabled(os.Stdout))
+	for _, line := range strings.Split(script, "\n") {
+		if reason := cautionReason(s.cfg, line); reason != "" {
+			fmt.Fprintf(os.Stderr, "Warning: the script contains a command that looks destructive (%s):\n  %s\n", reason, strings.TrimSpace(line))
+		}
+	}
+
+	path := *output
+	if path == "" {
+		fmt.Fprint(os.Stderr, "Save as (empty to skip): ")
+		line, _ := stdinReader.ReadString('\n')
+		if path = strings.TrimSpace(line); path == "" {
+			return 0
+		}
+	}
+	if err := saveScript(path, script); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// stdoutTerminal reports whether stdout is a terminal, regardless of
+// NO_COLOR.
+func stdoutTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// saveScript writes script to path, asking before it replaces a file and
+// before making the new file executable.
+func saveScript(path, script string) error {
+	if _, err := os.Stat(path); err == nil && !confirm(fmt.Sprintf("%s exists. Overwrite it?", path)) {
+		return errors.New("not saved")
+	}
+	if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Saved", path)
+	if confirm("Make it executable?") {
+		if err := os.Chmod(path, 0o755); err != nil {
+			return err
+		}
+		if !strings.ContainsRune(path, filepath.Separator) {
+			path = "." + string(filepath.Separator) + path
+		}
+		fmt.Fprintln(os.Stderr, "Run it with", path)
+	}
+	return nil
+}
+
+// extractScript returns the script in the model's reply, without a
+// surrounding code fence and ending in a newline.
+func extractScript(reply string) string {
+	text := strings.TrimSpace(reply)
+	if m := scriptFenceRe.FindStringSubmatch(text); m != nil {
+		text = strings.TrimSpace(m[1])
+	}
+	if text == "" {
+		return ""
+	}
+	return text + "\n"
+}
+
+// printScript writes script with line numbers and, with color, comments
+// dimmed, keywords in bold and quoted strings in green.
+func printScript(w *os.File, script string, color bool) {
+	lines := strings.Split(strings.TrimSuffix(script, "\n"), "\n")
+	width := len(fmt.Sprint(len(lines)))
+	for i, line := range lines {
+		fmt.Fprintf(w, "%s  %s\n", paint(fmt.Sprintf("%*d", width, i+1), ansiDim, color), highlightShell(line, color))
+	}
+}
+
+// highlightShell colors one line of shell code.
+func highlightShell(line string, color bool) string {
+	if !color {
+		return line
+	}
+	return scriptTokenRe.ReplaceAllStringFunc(line, func(tok string) string {
+		switch {
+		case strings.HasPrefix(strings.TrimLeft(tok, " \t"), "#"):
+			return paint(tok, ansiDim, color)
+		case strings.HasPrefix(tok, `"`), strings.HasPrefix(tok, "'"):
+			return paint(tok, ansiString, color)
+		case shellKeywords[tok]:
+			return paint(tok, ansiBold, color)
+		}
+		return tok
+	})
+}
+
+// buildScriptPrompt asks for a commented script that accomplishes task.
+func buildScriptPrompt(task string, ctx map[string]string, extra string) string {
+	var b strings.Builder
+	b.WriteString("You are a shell script writer.\n")
+	b.WriteString("Write a complete script for " + ai.ShellDialect(ctx["shell"]) + " that accomplishes the task.\n")
+	b.WriteString("Rules:\n")
+	switch ai.DialectOf(ctx["shell"]) {
+	case ai.DialectPowerShell:
+		b.WriteString("- Start with `$ErrorActionPreference = 'Stop'`.\n")
+		b.WriteString("- Add short comments explaining each section.\n")
+		b.WriteString("- Avoid destructive actions (Remove-Item -Recurse -Force, Format-Volume, moving/deleting) unless explicitly requested.\n")
+		b.WriteString("- Use cmdlets and utilities available on Windows.\n")
+	case ai.DialectNushell:
+		b.WriteString("- Start with the shebang line `#!/usr/bin/env nu`.\n")
+		b.WriteString("- Add short comments explaining each section.\n")
+		b.WriteString("- Avoid destructive actions (rm -r, sudo, moving/deleting) unless explicitly requested.\n")
+		b.WriteString("- Prefer Nushell's own commands over external utilities.\n")
+	case ai.DialectXonsh:
+		b.WriteString("- Start with the shebang line `#!/usr/bin/env xonsh` and `$RAISE_SUBPROC_ERROR = True`.\n")
+		b.WriteString("- Add short comments explaining each section.\n")
+		b.WriteString("- Avoid destructive actions (rm -rf, chmod -R, sudo, moving/deleting) unless explicitly requested.\n")
+		b.WriteString("- Use utilities commonly available on Linux/macOS.\n")
+	default:
+		b.WriteString("- Start with a shebang line and `set -eu`.\n")
+		b.WriteString("- Add short comments explaining each section.\n")
+		b.WriteString("- Avoid destructive actions (rm -rf, chmod -R, sudo, moving/deleting) unless explicitly requested.\n")
+		b.WriteString("- Use utilities commonly available on Linux/macOS.\n")
+	}
+	b.WriteString("- Reply with the script only, no explanation before or after it.\n")
+	ai.WritePreferences(&b, ctx)
+	if extra = strings.TrimSpace(extra); extra != "" {
+		b.WriteString("\nAdditional instructions:\n")
+		b.WriteString(extra)
+		b.WriteString("\n")
+	}
+	ai.WriteEnvironment(&b, ctx)
+	b.WriteString("\nTask:\n")
+	b.WriteString(task)
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// secretPattern recognizes one kind of credential.
+type secretPattern struct {
+	name string
+	re   *regexp.Regexp
+	// keep is set when the first group of re, such as the name a password
+	// is assigned to, stays when the secret is redacted.
+	keep bool
+}
+
+// secretPatterns are checked in order; more specific key formats come before
+// the generic ones so the reported kind is as precise as possible. The
+// generic ones skip values that start with "[", so they leave the
+// placeholders of earlier ones alone.
+var secretPatterns = []secretPattern{
+	// A key cut off before its END line is redacted to the end of the text.
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----(?s:.*?-----END [A-Z ]*PRIVATE KEY-----|.*)`), false},
+	{"Anthropic API key", regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`), false},
+	{"OpenAI API key", regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`), false},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`), false},
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), false},
+	{"Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`), false},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`), false},
+	{"JWT", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`), false},
+	{"credentials in URL", regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:[^/\s@]+@`), false},
+	{"bearer token", regexp.MustCompile(`(?i)(\bbearer\s+)[A-Za-z0-9._~+/-]{20,}=*`), true},
+	{"password or token assignment", regexp.MustCompile(`(?i)(\b(?:[a-z0-9]+[_-])*(?:password|passwd|pwd|secret|token|api[_-]?key|key)(?:[_-][a-z0-9]+)*\s*[:=]\s*)[^\s\[]\S{5,}`), true},
+	{"password option", regexp.MustCompile(`(?i)(--(?:password|passwd|token|secret|api-key)\s+)[^\s\[-]\S{5,}`), true},
+}
+
+// findSecrets returns the kinds of secrets that appear in s, in pattern order.
+func findSecrets(s string) []string {
+	var kinds []string
+	for _, p := range secretPatterns {
+		if p.re.MatchString(s) {
+			kinds = append(kinds, p.name)
+		}
+	}
+	return kinds
+}
+
+// redactSecrets replaces everything in s that looks like a secret with a
+// placeholder naming its kind, such as "[redacted GitHub token]".
+func redactSecrets(s string) string {
+	for _, p := range secretPatterns {
+		if p.keep {
+			s = p.re.ReplaceAllString(s, "${1}[redacted "+p.name+"]")
+		} else {
+			s = p.re.ReplaceAllLiteralString(s, "[redacted "+p.name+"]")
+		}
+	}
+	return s
+}
+
+// redactedRe matches the placeholders redactSecrets leaves.
+var redactedRe = regexp.MustCompile(`\[redacted ([^\]]+)\]`)
+
+// redactEnvironment redacts the secrets in every entry of env, the last
+// pass over the context before it is sent: most sources redact what they
+// gather, but not all of them can tell a secret from the rest.
+func redactEnvironment(env map[string]string) {
+	for k, v := range env {
+		env[k] = redactSecrets(v)
+	}
+}
+
+// describeRedactions lists, for each entry of env with redacted secrets,
+// the entry and the kinds of secrets, such as "git_remotes (credentials
+// in URL)".
+func describeRedactions(env map[string]string) []string {
+	var list []string
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		var kinds []string
+		for _, m := range redactedRe.FindAllStringSubmatch(env[k], -1) {
+			if !slices.Contains(kinds, m[1]) {
+				kinds = append(kinds, m[1])
+			}
+		}
+		if len(kinds) > 0 {
+			list = append(list, fmt.Sprintf("%s (%s)", k, strings.Join(kinds, ", ")))
+		}
+	}
+	return list
+}
+
+// showRedacted prints, for --show-redacted, the context the session would
+// send with task and the input piped to it, as it would be sent, followed by
+// the secrets that were redacted. Nothing is sent. It returns the process
+// exit code.
+func (s *session) showRedacted(task string) int {
+	env := s.client.Environment
+	fmt.Fprintln(s.ui, "Context that would be sent:")
+	for _, k := range slices.Sorted(maps.Keys(env)) {
+		if v := strings.TrimRight(env[k], "\n"); strings.Contains(v, "\n") {
+			fmt.Fprintf(s.ui, "- %s:\n%s\n", k, indent(v, "    "))
+		} else if v != "" {
+			fmt.Fprintf(s.ui, "- %s: %s\n", k, v)
+		}
+	}
+	redacted := describeRedactions(env)
+	if stdinPiped() {
+		limit, err := captureLimit()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 2
+		}
+		input, err := readPipedInput(limit)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			return 2
+		}
+		fmt.Fprintf(s.ui, "\nPiped input:\n%s\n", indent(strings.TrimRight(input, "\n"), "    "))
+		redacted = append(redacted, describeRedactions(map[string]string{"piped input": input})...)
+	}
+	fmt.Fprintln(s.ui)
+	if len(redacted) == 0 {
+		fmt.Fprintln(s.ui, "Nothing was redacted.")
+	} else {
+		fmt.Fprintln(s.ui, "Redacted:", strings.Join(redacted, ", "))
+	}
+	if kinds := findSecrets(task); len(kinds) > 0 {
+		fmt.Fprintf(s.ui, "The task itself appears to contain a secret (%s); tasks are sent as written.\n", strings.Join(kinds, ", "))
+	}
+	return 0
+}
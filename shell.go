@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// configuredShell is the shell setting of the last config loaded.
+var configuredShell string
+
+// targetShell returns the shell suggestions are written for and run in:
+// AI_SHELL, else the shell setting, else the login shell. Setting one lets
+// commands target a shell other than the one ai is started from, such as
+// Nushell from zsh.
+func targetShell() string {
+	return firstNonEmpty(os.Getenv("AI_SHELL"), configuredShell, ai.DefaultShell())
+}
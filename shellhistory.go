@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+const (
+	// historyTailBytes bounds how much of the history file is read.
+	historyTailBytes = 256 * 1024
+	// maxHistoryTools caps how many tool names are sent as a preference hint.
+	maxHistoryTools = 10
+	// minHistoryUses is how often a tool must appear to count as preferred.
+	minHistoryUses = 2
+	// defaultRecentCommands and maxRecentCommands are how many of the last
+	// commands --ctx recent sends by default and at most.
+	defaultRecentCommands = 10
+	maxRecentCommands     = 50
+	// recentCommandBytes cuts each recent command sent.
+	recentCommandBytes = 200
+)
+
+// ignoredHistoryTools are builtins and ubiquitous commands that say nothing
+// about the user's tool preferences.
+var ignoredHistoryTools = map[string]bool{
+	"cd": true, "ls": true, "echo": true, "exit": true, "clear": true, "history": true,
+	"pwd": true, "export": true, "source": true, ".": true, "alias": true, "unset": true,
+	"set": true, "true": true, "false": true, "ai": true, "which": true, "type": true,
+	"man": true, "fg": true, "bg": true, "jobs": true, "exec": true, "eval": true,
+}
+
+var (
+	toolNameRe = regexp.MustCompile(`^[A-Za-z0-9_+-][A-Za-z0-9._+-]{0,31}$`)
+	// bashTimestampRe and zshExtendedRe recognize history files written
+	// with timestamps, so appended entries can match them.
+	bashTimestampRe = regexp.MustCompile(`(?m)^#\d+$`)
+	zshExtendedRe   = regexp.MustCompile(`(?m)^: \d+:\d+;`)
+)
+
+// historyFile returns the history file of the given shell, honoring $HISTFILE.
+func historyFile(shell string) string {
+	if f := os.Getenv("HISTFILE"); f != "" {
+		return f
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	switch ai.ShellName(shell) {
+	case "zsh":
+		return filepath.Join(home, ".zsh_history")
+	case "fish":
+		return filepath.Join(home, ".local", "share", "fish", "fish_history")
+	case "powershell", "pwsh":
+		// PSReadLine keeps one command per line.
+		dir := filepath.Join(home, ".local", "share", "powershell")
+		if appData := os.Getenv("APPDATA"); runtime.GOOS == "windows" && appData != "" {
+			dir = filepath.Join(appData, "Microsoft", "Windows", "PowerShell")
+		}
+		return filepath.Join(dir, "PSReadLine", "ConsoleHost_history.txt")
+	default:
+		return filepath.Join(home, ".bash_history")
+	}
+}
+
+// readHistoryTail returns the commands from the last historyTailBytes of path,
+// oldest first, understanding bash, zsh extended and fish history formats.
+func readHistoryTail(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	partial := info.Size() > historyTailBytes
+	if partial {
+		if _, err := f.Seek(-historyTailBytes, io.SeekEnd); err != nil {
+			return nil, err
+		}
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if partial {
+		// Drop the first, most likely cut-off line.
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		}
+	}
+
+	var cmds []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 0, 64*1024), historyTailBytes)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, "when:"):
+			// bash timestamps and fish metadata
+			continue
+		case strings.HasPrefix(line, ": ") && strings.Contains(line, ";"):
+			// zsh extended history: ": <start>:<elapsed>;<command>"
+			line = line[strings.IndexByte(line, ';')+1:]
+		case strings.HasPrefix(line, "- cmd: "):
+			line = strings.TrimPrefix(line, "- cmd: ")
+		}
+		cmds = append(cmds, line)
+	}
+	return cmds, sc.Err()
+}
+
+// frequentTools returns the most used command names in cmds, most frequent
+// first. Only the first word of each pipeline stage is considered.
+func frequentTools(cmds []string) []string {
+	counts := map[string]int{}
+	for _, c := range cmds {
+		for _, words := range shellSegments(c) {
+			args := stripWrappers(words)
+			if len(args) == 0 {
+				continue
+			}
+			name := args[0]
+			if !toolNameRe.MatchString(name) || ignoredHistoryTools[name] {
+				continue
+			}
+			counts[name]++
+		}
+	}
+
+	tools := make([]string, 0, len(counts))
+	for name, n := range counts {
+		if n >= minHistoryUses {
+			tools = append(tools, name)
+		}
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		if counts[tools[i]] != counts[tools[j]] {
+			return counts[tools[i]] > counts[tools[j]]
+		}
+		return tools[i] < tools[j]
+	})
+	if len(tools) > maxHistoryTools {
+		tools = tools[:maxHistoryTools]
+	}
+	return tools
+}
+
+// gatherHistoryTools returns the user's most used tools as a comma-separated
+// list. Full history lines are never returned.
+func gatherHistoryTools(shell string) string {
+	path := historyFile(shell)
+	if path == "" {
+		return ""
+	}
+	cmds, err := readHistoryTail(path)
+	if err != nil {
+		return ""
+	}
+	return strings.Join(frequentTools(cmds), ", ")
+}
+
+// gatherRecentCommands returns the last n commands of the user's shell
+// history, oldest first and one per line, each cut to recentCommandBytes
+// with secrets redacted.
+func gatherRecentCommands(shell string, n int) string {
+	path := historyFile(shell)
+	if path == "" {
+		return ""
+	}
+	cmds, err := readHistoryTail(path)
+	if err != nil {
+		return ""
+	}
+	cmds = cmds[max(len(cmds)-n, 0):]
+	for i, c := range cmds {
+		if len(c) > recentCommandBytes {
+			c = strings.ToValidUTF8(c[:recentCommandBytes], "") + "…"
+		}
+		cmds[i] = redactSecrets(c)
+	}
+	return strings.Join(cmds, "\n")
+}
+
+// appendShellHistory adds cmd to the history file of shell as that shell
+// would write it: bash and zsh entries get a timestamp when the file already
+// uses them, fish entries always do.
+func appendShellHistory(shell, cmd string, now time.Time) error {
+	path := historyFile(shell)
+	if path == "" {
+		return errors.New("no history file")
+	}
+	var tail []byte
+	if cmds, err := os.ReadFile(path); err == nil {
+		tail = cmds[max(len(cmds)-4096, 0):]
+	}
+
+	var entry string
+	switch filepath.Base(shell) {
+	case "zsh":
+		// zsh marks continued lines with a trailing backslash.
+		cmd = strings.ReplaceAll(cmd, "\n", "\\\n")
+		if zshExtendedRe.Match(tail) {
+			entry = fmt.Sprintf(": %d:0;%s\n", now.Unix(), cmd)
+		} else {
+			entry = cmd + "\n"
+		}
+	case "fish":
+		cmd = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(cmd)
+		entry = fmt.Sprintf("- cmd: %s\n  when: %d\n", cmd, now.Unix())
+	default:
+		if bashTimestampRe.Match(tail) {
+			entry = fmt.Sprintf("#%d\n%s\n", now.Unix(), cmd)
+		} else {
+			entry = cmd + "\n"
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(entry); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// addToShellHistory appends cmd, which just ran, to the user's shell history
+// when append_shell_history is set.
+func (s *session) addToShellHistory(cmd string) {
+	if !s.cfg.appendShellHistory() {
+		return
+	}
+	if err := appendShellHistory(targetShell(), cmd, time.Now()); err != nil {
+		fmt.Fprintln(os.Stderr, "Warning: could not add the command to your shell history:", err)
+	}
+}
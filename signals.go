@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// exitInterrupted is the exit status after Ctrl-C, as shells report it.
+const exitInterrupted = 130
+
+// interrupted records that Ctrl-C cancelled a request, so that ai exits
+// with exitInterrupted whatever the code path reports.
+var interrupted atomic.Bool
+
+// cancelOnInterrupt calls cancel when Ctrl-C is pressed before ctx is done,
+// so in-flight requests are abandoned instead of ai being killed outright.
+func cancelOnInterrupt(ctx context.Context, cancel context.CancelFunc) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		defer signal.Stop(sig)
+		select {
+		case <-sig:
+			interrupted.Store(true)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// reportAPIError tells the user why a request failed, or only that it was
+// interrupted when Ctrl-C cancelled it.
+func reportAPIError(err error) {
+	if interrupted.Load() && errors.Is(err, context.Canceled) {
+		fmt.Fprintln(os.Stderr, "\nInterrupted.")
+		return
+	}
+	fmt.Fprintln(os.Stderr, "API error:", err)
+}
+
+// waitError reports a command that ai waited for itself and that did not
+// exit successfully, like *exec.ExitError does for exec.Cmd.Wait.
+type waitError struct {
+	status syscall.WaitStatus
+}
+
+func (e *waitError) Error() string {
+	if e.status.Signaled() {
+		return "signal: " + e.status.Signal().String()
+	}
+	return fmt.Sprintf("exit status %d", e.status.ExitStatus())
+}
+
+// statusCode returns the exit code a shell would report for status: a
+// command killed by a signal counts as 128+signal.
+func statusCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// commandSources records which models suggested each command, so that the
+// menu, the log and --json can tell them apart when the calls of a request
+// went to more than one model. It is safe for concurrent use, as the menu
+// reads it while later calls are still being added.
+type commandSources struct {
+	mu     sync.Mutex
+	models map[string][]string // by command, in order of arrival
+	seen   map[string]bool     // every model that answered
+}
+
+func newCommandSources() *commandSources {
+	return &commandSources{models: map[string][]string{}, seen: map[string]bool{}}
+}
+
+// add records the commands of the successful call r as suggested by its
+// model.
+func (c *commandSources) add(r ai.Result) {
+	if r.Error != nil || r.Model == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen[r.Model] = true
+	for _, cmd := range r.Commands {
+		if !slices.Contains(c.models[cmd], r.Model) {
+			c.models[cmd] = append(c.models[cmd], r.Model)
+		}
+	}
+}
+
+// of returns the models that suggested cmd.
+func (c *commandSources) of(cmd string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.models[cmd])
+}
+
+// label returns the models that suggested cmd for its menu entry, or ""
+// while every suggestion came from the same model.
+func (c *commandSources) label(cmd string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.seen) < 2 {
+		return ""
+	}
+	return strings.Join(c.models[cmd], ", ")
+}
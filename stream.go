@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+	"golang.org/x/term"
+)
+
+// spinnerInterval is how often the spinner advances while nothing has
+// arrived yet.
+const spinnerInterval = 100 * time.Millisecond
+
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// liveView shows on one terminal line a spinner with the time elapsed and
+// the calls still outstanding, then the command being generated, taken from
+// whichever call started answering first, until clear is called.
+type liveView struct {
+	mu       sync.Mutex
+	out      *os.File
+	width    int
+	start    time.Time
+	calls    int // concurrent calls made, or 0 while unknown
+	finished int
+	frame    int
+	call     int // the call being shown, or -1 before any text arrived
+	shown    string
+	closed   bool
+	stop     chan struct{}
+}
+
+// newLiveView returns a view drawing on out, or nil when out is not a
+// terminal.
+func newLiveView(out *os.File) *liveView {
+	if !term.IsTerminal(int(out.Fd())) {
+		return nil
+	}
+	width, _, err := term.GetSize(int(out.Fd()))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	v := &liveView{out: out, width: width, start: time.Now(), call: -1, stop: make(chan struct{})}
+	v.mu.Lock()
+	v.spin()
+	v.mu.Unlock()
+	go func() {
+		t := time.NewTicker(spinnerInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-v.stop:
+				return
+			case <-t.C:
+				v.mu.Lock()
+				if v.call < 0 && !v.closed {
+					v.frame++
+					v.spin()
+				}
+				v.mu.Unlock()
+			}
+		}
+	}()
+	return v
+}
+
+// spin draws the spinner line. The caller holds v.mu.
+func (v *liveView) spin() {
+	line := fmt.Sprintf("%c Generating… %.1fs", spinnerFrames[v.frame%len(spinnerFrames)], time.Since(v.start).Seconds())
+	switch outstanding := v.calls - v.finished; {
+	case v.calls <= 1:
+	case outstanding == 1:
+		line += ", 1 call outstanding"
+	default:
+		line += fmt.Sprintf(", %d calls outstanding", outstanding)
+	}
+	v.draw(line)
+}
+
+// draw replaces the view's line with line, cut to the terminal width. The
+// caller holds v.mu.
+func (v *liveView) draw(line string) {
+	if r := []rune(line); len(r) > v.width-1 {
+		line = string(r[:max(v.width-2, 0)]) + "…"
+	}
+	if line == v.shown {
+		return
+	}
+	v.shown = line
+	fmt.Fprint(v.out, "\r"+ansiClearLine+line)
+}
+
+// setCalls is the ai.CallsFunc of the view.
+func (v *liveView) setCalls(calls int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.calls = calls
+}
+
+// callDone is the ai.ResultFunc of the view.
+func (v *liveView) callDone(ai.Result) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.finished++
+}
+
+// update is the streamFunc of the view.
+func (v *liveView) update(call int, text string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed || (v.call >= 0 && call != v.call) {
+		return
+	}
+	cmd := ai.PartialCommand(text)
+	if cmd == "" {
+		return
+	}
+	v.call = call
+	v.draw("› " + cmd)
+}
+
+// clear removes the view's line so the menu can take its place.
+func (v *liveView) clear() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.closed {
+		return
+	}
+	v.closed = true
+	close(v.stop)
+	fmt.Fprint(v.out, "\r"+ansiClearLine)
+}
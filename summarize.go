@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// bytesPerToken is a rough estimate used to size input against the
+	// token budget; English text and logs average about four bytes a token.
+	bytesPerToken = 4
+	// summarizeChunkBytes is how much input one summarizing request carries.
+	summarizeChunkBytes = 48 * 1024
+	// summarizeMaxChunks bounds the requests for one summary; longer input
+	// is cut from the front, since logs usually end with what matters.
+	summarizeMaxChunks = 8
+)
+
+// runSummarize implements "ai summarize": it reads command output from
+// stdin and prints a short summary of it. Arguments, if any, say what the
+// summary should focus on.
+func runSummarize(args []string) int {
+	flags := &cliFlags{}
+	fs := newProviderFlagSet("ai summarize", flags)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintln(out, "Usage: <command> | ai summarize [flags] [focus]")
+		fmt.Fprintln(out, "\nSummarize piped output, such as a build log, optionally focusing on")
+		fmt.Fprintln(out, "something in particular (\"ai summarize which tests failed\").")
+		fmt.Fprintln(out, "\nFlags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if !stdinPiped() {
+		fmt.Fprintln(os.Stderr, "Error: pipe the output to summarize into ai summarize")
+		return 2
+	}
+
+	s, code := newSession(flags)
+	if s == nil {
+		return code
+	}
+	limit := summarizeChunkBytes * summarizeMaxChunks
+	if left, ok := s.budget.remaining(s.ledger, time.Now()); ok && !flags.ignoreBudget {
+		// Leave half the remaining budget for prompts and replies.
+		limit = min(limit, max(left*bytesPerToken/2, 1))
+	}
+	input, err := readPipedInput(limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	if strings.TrimSpace(input) == "" {
+		fmt.Fprintln(os.Stderr, "Error: no input to summarize")
+		return 2
+	}
+
+	focus := strings.Join(fs.Args(), " ")
+	chunks := splitChunks(input, summarizeChunkBytes)
+	if len(chunks) == 1 {
+		summary, ok := s.complete(buildSummaryPrompt(focus, chunks[0], ""))
+		if !ok {
+			return 1
+		}
+		fmt.Println(summary)
+		return 0
+	}
+
+	// Summarize each chunk, then summarize the partial summaries.
+	parts := make([]string, 0, len(chunks))
+	for i, chunk := range chunks {
+		part, ok := s.complete(buildSummaryPrompt(focus, chunk, fmt.Sprintf("This is part %d of %d of the output.", i+1, len(chunks))))
+		if !ok {
+			return 1
+		}
+		parts = append(parts, fmt.Sprintf("Part %d:\n%s", i+1, part))
+	}
+	summary, ok := s.complete(buildSummaryPrompt(focus, strings.Join(parts, "\n\n"), "These are summaries of consecutive parts of one output; combine them into one summary."))
+	if !ok {
+		return 1
+	}
+	fmt.Println(summary)
+	return 0
+}
+
+// splitChunks cuts s into pieces of at most size bytes, at line breaks
+// where possible.
+func splitChunks(s string, size int) []string {
+	var chunks []string
+	for len(s) > size {
+		cut := strings.LastIndexByte(s[:size], '\n') + 1
+		if cut == 0 {
+			cut = size
+		}
+		chunks = append(chunks, s[:cut])
+		s = s[cut:]
+	}
+	return append(chunks, s)
+}
+
+// buildSummaryPrompt asks for a concise summary of output; note describes
+// which part of the whole it is, if it is not all of it.
+func buildSummaryPrompt(focus, output, note string) string {
+	var b strings.Builder
+	b.WriteString("Summarize the following command output for a user on the command line.\n")
+	b.WriteString("Rules:\n")
+	b.WriteString("- Be concise: a few sentences or a short list.\n")
+	b.WriteString("- Lead with errors, failures and warnings, quoting the key lines.\n")
+	b.WriteString("- Plain text only, no Markdown headings.\n")
+	if focus != "" {
+		b.WriteString("- Focus on: " + focus + "\n")
+	}
+	if note != "" {
+		b.WriteString("\n" + note + "\n")
+	}
+	b.WriteString("\nOutput:\n")
+	b.WriteString(output)
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syntaxCheckTimeout bounds one parse-only run of the shell.
+const syntaxCheckTimeout = 2 * time.Second
+
+// parseOnlyArgs returns the arguments that make shell parse the command
+// following them without running it, or nil when it has no such mode.
+func parseOnlyArgs(shell string) []string {
+	switch filepath.Base(shell) {
+	case "sh", "bash", "zsh", "dash", "ksh", "mksh", "yash":
+		return []string{"-n", "-c"}
+	case "fish":
+		return []string{"--no-execute", "-c"}
+	}
+	return nil
+}
+
+// syntaxError reports why shell can't parse cmd. It returns nil when the
+// command parses, and also when the shell can't be asked: it has no
+// parse-only mode, isn't installed or doesn't answer in time.
+func syntaxError(shell, cmd string) error {
+	args := parseOnlyArgs(shell)
+	if args == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), syntaxCheckTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	c := exec.CommandContext(ctx, shell, append(args, cmd)...)
+	c.Stderr = &stderr
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if err == nil || !errors.As(err, &exitErr) || ctx.Err() != nil {
+		return nil
+	}
+	msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+	if msg == "" {
+		msg = fmt.Sprintf("exit status %d", exitErr.ExitCode())
+	}
+	return fmt.Errorf("%s can't parse it: %s", filepath.Base(shell), msg)
+}
+
+// dropUnparsable returns cmds without the ones the user's shell can't
+// parse, such as truncated replies with an unclosed quote, and why the
+// first of those was dropped. The shell checks the commands in parallel.
+func dropUnparsable(cmds []string) ([]string, string) {
+	shell := targetShell()
+	errs := make([]error, len(cmds))
+	var wg sync.WaitGroup
+	for i, cmd := range cmds {
+		wg.Go(func() { errs[i] = syntaxError(shell, withoutPlaceholders(cmd)) })
+	}
+	wg.Wait()
+
+	var kept []string
+	var reason string
+	for i, cmd := range cmds {
+		if errs[i] == nil {
+			kept = append(kept, cmd)
+		} else if reason == "" {
+			reason = errs[i].Error()
+		}
+	}
+	return kept, reason
+}
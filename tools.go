@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brainexe/ai/pkg/ai"
+)
+
+// shellBuiltins are builtins and reserved words of the common shells,
+// which need no program on $PATH.
+var shellBuiltins = map[string]bool{
+	".": true, ":": true, "[": true, "[[": true, "((": true, "alias": true, "bg": true,
+	"break": true, "builtin": true, "cd": true, "command": true, "continue": true,
+	"declare": true, "dirs": true, "echo": true, "eval": true, "exec": true, "exit": true,
+	"export": true, "false": true, "fc": true, "fg": true, "getopts": true, "hash": true,
+	"history": true, "jobs": true, "kill": true, "let": true, "local": true, "popd": true,
+	"print": true, "printf": true, "pushd": true, "pwd": true, "read": true, "readonly": true,
+	"return": true, "set": true, "setopt": true, "shift": true, "shopt": true, "source": true,
+	"test": true, "time": true, "times": true, "trap": true, "true": true, "type": true,
+	"typeset": true, "ulimit": true, "umask": true, "unalias": true, "unset": true,
+	"wait": true, "whence": true,
+}
+
+// commandPrefixes are reserved words that may start a simple command
+// without being its program.
+var commandPrefixes = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "while": true, "until": true,
+	"do": true, "!": true, "{": true,
+}
+
+// shellClauses start or end a compound command; the rest of their segment
+// names no program.
+var shellClauses = map[string]bool{
+	"for": true, "select": true, "case": true, "esac": true, "in": true, "function": true,
+	"fi": true, "done": true, "}": true,
+}
+
+// inventoryTools are the programs the prompt says are or aren't installed:
+// those models like to suggest that are often missing, package and service
+// managers, and the tools of common trades.
+var inventoryTools = []string{
+	"fd", "rg", "eza", "exa", "bat", "jq", "yq", "fzf", "tree", "ncdu", "htop", "pv",
+	"parallel", "rsync", "gdate", "gsed", "gawk", "gfind", "gstat", "python3",
+	"docker", "podman", "kubectl", "helm", "terraform", "git", "gh", "curl", "wget",
+	"ffmpeg", "magick", "convert", "7z", "zip", "node", "go", "aws", "gcloud", "az",
+	"brew", "apt", "dnf", "yum", "pacman", "apk", "zypper", "snap", "flatpak", "nix",
+	"systemctl", "launchctl", "journalctl",
+}
+
+// toolInventoryTTL is how long the inventory of installed tools is reused
+// before $PATH is searched again.
+const toolInventoryTTL = 24 * time.Hour
+
+// toolInventory records which of inventoryTools were found on $PATH.
+type toolInventory struct {
+	Created   time.Time `json:"created"`
+	Path      string    `json:"path"`  // the $PATH searched
+	Tools     string    `json:"tools"` // inventoryTools, comma-separated
+	Installed []string  `json:"installed"`
+	Missing   []string  `json:"missing"`
+}
+
+var (
+	lookPathMu    sync.Mutex
+	lookPathCache = map[string]bool{}
+)
+
+// installed reports whether name is a program on $PATH, or a path to one.
+// Answers are cached since the menu asks on every redraw.
+func installed(name string) bool {
+	lookPathMu.Lock()
+	defer lookPathMu.Unlock()
+	found, ok := lookPathCache[name]
+	if !ok {
+		_, err := exec.LookPath(name)
+		found = err == nil
+		lookPathCache[name] = found
+	}
+	return found
+}
+
+// missingTools returns the programs cmd runs that aren't installed, in
+// order of appearance. Names that are expanded by the shell, such as $EDITOR
+// or ~/bin/tool, are not checked. Aliases and functions count as missing:
+// commands run in a non-interactive shell, which doesn't define them.
+// PowerShell and Nushell commands aren't checked, as most are built into
+// the shell rather than programs.
+func missingTools(cmd string) []string {
+	if d := ai.DialectOf(targetShell()); d == ai.DialectPowerShell || d == ai.DialectNushell {
+		return nil
+	}
+	var missing []string
+	for _, words := range shellSegments(cmd) {
+		for len(words) > 0 && commandPrefixes[words[0]] {
+			words = words[1:]
+		}
+		if len(words) == 0 || shellClauses[words[0]] {
+			continue
+		}
+		args := stripWrappers(words)
+		if len(args) == 0 {
+			continue
+		}
+		name := args[0]
+		if shellBuiltins[name] || strings.ContainsAny(name, "$`~*?<>") || slices.Contains(missing, name) {
+			continue
+		}
+		if !installed(name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// demoteMissing moves the commands that use programs which aren't
+// installed after the others, keeping the order within both groups.
+func demoteMissing(cmds []string) []string {
+	var ready, missing []string
+	for _, cmd := range cmds {
+		if len(missingTools(cmd)) > 0 {
+			missing = append(missing, cmd)
+		} else {
+			ready = append(ready, cmd)
+		}
+	}
+	return append(ready, missing...)
+}
+
+// takeToolInventory returns which of inventoryTools are installed and
+// which aren't, so the model can use the ones there are and avoid the rest.
+// The answer is kept in the cache directory for toolInventoryTTL, or until
+// $PATH or the list changes, so the search doesn't slow every request.
+func takeToolInventory(now time.Time) toolInventory {
+	var path string
+	if dir, err := os.UserCacheDir(); err == nil {
+		path = filepath.Join(dir, "ai", "tools.json")
+	}
+	tools := strings.Join(inventoryTools, ",")
+	if data, err := os.ReadFile(path); err == nil {
+		var inv toolInventory
+		if json.Unmarshal(data, &inv) == nil && inv.Path == os.Getenv("PATH") && inv.Tools == tools && now.Sub(inv.Created) < toolInventoryTTL {
+			return inv
+		}
+	}
+	inv := toolInventory{Created: now, Path: os.Getenv("PATH"), Tools: tools}
+	for _, name := range inventoryTools {
+		if installed(name) {
+			inv.Installed = append(inv.Installed, name)
+		} else {
+			inv.Missing = append(inv.Missing, name)
+		}
+	}
+	if data, err := json.Marshal(inv); err == nil && path != "" && os.MkdirAll(filepath.Dir(path), 0o700) == nil {
+		_ = os.WriteFile(path, data, 0o600)
+	}
+	return inv
+}
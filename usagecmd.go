@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// runUsage implements `ai usage`: the tokens and estimated cost recorded
+// for each day of the current month, with totals and the remaining budget.
+func runUsage(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: ai usage")
+		return 2
+	}
+	ledger, err := loadUsage()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	budget, err := loadBudget(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 2
+	}
+	printUsage(os.Stdout, ledger, budget, time.Now())
+	return 0
+}
+
+// printUsage writes the usage report for the month containing now.
+func printUsage(w io.Writer, l *usageLedger, b tokenBudget, now time.Time) {
+	prefix := now.Format("2006-01-")
+	var days []string
+	for _, day := range slices.Sorted(maps.Keys(l.Days)) {
+		if strings.HasPrefix(day, prefix) {
+			days = append(days, day)
+		}
+	}
+	if len(days) == 0 {
+		fmt.Fprintln(w, "No usage recorded this month.")
+	} else {
+		fmt.Fprintf(w, "%-10s  %8s  %10s  %10s  %10s  %10s\n", "Date", "Requests", "Input", "Output", "Tokens", "Est. cost")
+	}
+	var month dayUsage
+	monthTokens, unknownSplit := 0, false
+	for _, day := range days {
+		d, ok := l.Details[day]
+		tokens := l.Days[day]
+		monthTokens += tokens
+		if !ok {
+			// Recorded before usage details were kept.
+			unknownSplit = true
+			fmt.Fprintf(w, "%-10s  %8s  %10s  %10s  %10d  %10s\n", day, "-", "-", "-", tokens, "-")
+			continue
+		}
+		month.Requests += d.Requests
+		month.InputTokens += d.InputTokens
+		month.OutputTokens += d.OutputTokens
+		month.Cost += d.Cost
+		month.Unpriced += d.Unpriced
+		fmt.Fprintf(w, "%-10s  %8d  %10d  %10d  %10d  %10s\n", day, d.Requests, d.InputTokens, d.OutputTokens, tokens, dayCost(d))
+	}
+
+	today := l.Details[now.Format(dayLayout)]
+	fmt.Fprintf(w, "\nToday:      %d tokens, estimated cost %s\n", l.daily(now), dayCost(today))
+	fmt.Fprintf(w, "This month: %d tokens, estimated cost %s\n", monthTokens, dayCost(month))
+	if unknownSplit {
+		fmt.Fprintln(w, "Days marked - were recorded before costs were tracked and aren't in the cost total.")
+	}
+	if month.Unpriced > 0 {
+		fmt.Fprintf(w, "%d requests used models without a known price and aren't in the cost total.\n", month.Unpriced)
+	}
+	if b.enabled() {
+		fmt.Fprintf(w, "Token budget: %s\n", b.describe(l, now))
+	}
+}
+
+// dayCost renders the estimated cost of recorded usage.
+func dayCost(d dayUsage) string {
+	return fmt.Sprintf("$%.4f", d.Cost)
+}